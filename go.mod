@@ -2,4 +2,10 @@ module github.com/marad/frontmatter
 
 go 1.24.1
 
-require github.com/goccy/go-yaml v1.18.0
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/goccy/go-yaml v1.18.0
+	github.com/itchyny/gojq v0.12.19
+)
+
+require github.com/itchyny/timefmt-go v0.1.8 // indirect
@@ -2,18 +2,152 @@ package main
 
 import (
 	"bufio"
+	"cmp"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"html"
 	"io"
+	"io/fs"
+	"maps"
+	"math"
+	"math/big"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/BurntSushi/toml"
 	yaml "github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	yamlparser "github.com/goccy/go-yaml/parser"
+	"github.com/itchyny/gojq"
 )
 
 const frontmatterSeparator = "---"
 
+// configFileName is the project configuration file looked up from the working directory upwards
+const configFileName = ".frontmatter.yaml"
+
+// defaultsFileName holds directory-level values cascading to every file beneath it
+const defaultsFileName = "_defaults.yaml"
+
+// ignoreFileName lists gitignore-style patterns skipped by directory walks
+const ignoreFileName = ".frontmatterignore"
+
+// cacheDirName is the project-local directory holding caches that can be safely deleted
+const cacheDirName = ".frontmatter-cache"
+
+// parseCacheFileName is the file in cacheDirName storing parsed frontmatter
+const parseCacheFileName = "frontmatter.gob"
+
+// progressFileName is the file in cacheDirName recording the progress of a bulk write,
+// read back by --resume. It holds one JSON object per line.
+const progressFileName = "progress.jsonl"
+
+// linkCacheFileName is the file in cacheDirName storing the results of --check-links
+const linkCacheFileName = "links.json"
+
+// trashDirName is the project-local store of frontmatter blocks removed with delete --trash
+const trashDirName = ".frontmatter-trash"
+
+// defaultCommitTemplate is the --git-commit message used when -m is not given
+const defaultCommitTemplate = "frontmatter {command}: {keys}"
+
+// writtenFiles lists the content files written so far, for --git-commit
+var writtenFiles []string
+
+// activePlan collects the writes of a command run by plan instead of performing them
+var activePlan *Plan
+
+// redactedPlaceholder replaces secret values in output unless --show-secrets is passed
+const redactedPlaceholder = "***"
+
+// languageStopwords holds frequent function words used by the body language detector
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "with", "for", "was", "on", "are", "this", "you", "not", "be", "have"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "mit", "sich", "auf", "ein", "eine", "den", "dem", "zu", "auch", "wir", "von"},
+	"fr": {"le", "la", "les", "et", "est", "des", "une", "un", "du", "que", "pas", "pour", "dans", "qui", "sur", "avec", "nous", "vous"},
+	"es": {"el", "la", "los", "las", "y", "es", "que", "del", "una", "por", "con", "para", "como", "pero", "su", "muy", "está", "se"},
+	"it": {"il", "la", "di", "che", "è", "e", "non", "per", "una", "sono", "della", "con", "gli", "anche", "come", "più", "questo", "nel"},
+	"pt": {"o", "a", "os", "que", "e", "não", "do", "da", "em", "um", "uma", "para", "com", "mais", "por", "como", "mas", "isso"},
+	"nl": {"de", "het", "een", "en", "is", "van", "niet", "dat", "ik", "op", "te", "zijn", "met", "voor", "ook", "maar", "wel", "er"},
+	"pl": {"i", "w", "nie", "na", "się", "jest", "to", "że", "z", "do", "jak", "ale", "co", "tak", "od", "po", "są", "dla"},
+}
+
+// secretPatterns detect credentials that should never be stored in frontmatter values
+var secretPatterns = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"AWS access key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"bearer token", regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]{20,}=*`)},
+	{"private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+	{"GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"JSON web token", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+}
+
+// lintRule inspects the frontmatter of one file and returns the problems it finds
+type lintRule struct {
+	name  string
+	check func(filePath string, data map[string]any) []string
+}
+
+// lintRules are run by lint and check
+var lintRules = []lintRule{
+	{name: "no-secrets", check: lintSecrets},
+	{name: "value-patterns", check: lintPatterns},
+	{name: "frontmatter-size", check: lintFrontmatterSize},
+	{name: "url-syntax", check: lintURLs},
+}
+
+// frontmatterByteBudget is set by --max-frontmatter-bytes and overrides the config budget
+var frontmatterByteBudget int64
+
+// oversizedFiles are the files the frontmatter-size rule flagged, for the closing report
+var oversizedFiles []fileSize
+
+// fileSize is the size of one file's frontmatter block in bytes
+type fileSize struct {
+	Path string
+	Size int64
+}
+
+// largestOffendersShown is how many files the oversized frontmatter report lists
+const largestOffendersShown = 10
+
+// contentExtensions lists file extensions picked up when walking directories
+var contentExtensions = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".mdx":      true,
+	".html":     true,
+	".htm":      true,
+	".txt":      true,
+}
+
 // FrontmatterInfo contains information about frontmatter position in file
 type FrontmatterInfo struct {
 	Content  string
@@ -22,6 +156,99 @@ type FrontmatterInfo struct {
 	HasFM    bool
 }
 
+// DocumentJSON is the whole-document interchange representation used by json/unjson
+type DocumentJSON struct {
+	Frontmatter map[string]any `json:"frontmatter"`
+	Body        string         `json:"body"`
+	Path        string         `json:"path"`
+}
+
+// Config is the project configuration read from .frontmatter.yaml
+type Config struct {
+	Dir                 string                 `yaml:"-"`
+	Schemas             []SchemaRule           `yaml:"schemas"`
+	Immutable           []string               `yaml:"immutable"`
+	Secrets             []string               `yaml:"secrets"`
+	Patterns            map[string]string      `yaml:"patterns"`
+	Enums               map[string][]any       `yaml:"enums"`
+	Unique              []string               `yaml:"unique"`
+	Presets             map[string][]string    `yaml:"presets"`
+	Hooks               map[string][]string    `yaml:"hooks"`
+	Rules               []ConsistencyRule      `yaml:"rules"`
+	MaxFrontmatterBytes int64                  `yaml:"maxFrontmatterBytes"`
+	Permalink           string                 `yaml:"permalink"`
+	Meta                map[string]string      `yaml:"meta"`
+	Queries             map[string]string      `yaml:"queries"`
+	Aliases             map[string]string      `yaml:"aliases"`
+	Types               map[string]ContentType `yaml:"types"`
+	TypeKey             string                 `yaml:"typeKey"`
+	Locales             []string               `yaml:"locales"`
+	Formats             map[string]string      `yaml:"formats"`
+	DurationFormat      string                 `yaml:"durationFormat"`
+	TimeFormat          string                 `yaml:"timeFormat"`
+	GeoFormat           string                 `yaml:"geoFormat"`
+	Decimals            []string               `yaml:"decimals"`
+}
+
+// ConsistencyRule relates fields within one file. When all When values match (or
+// When is empty), the Require keys must be present and Key must be After or Before
+// another date key and Equal the value of an expression such as title or slugify(title).
+type ConsistencyRule struct {
+	Name    string         `yaml:"name"`
+	When    map[string]any `yaml:"when"`
+	Require []string       `yaml:"require"`
+	Key     string         `yaml:"key"`
+	After   string         `yaml:"after"`
+	Before  string         `yaml:"before"`
+	Equals  string         `yaml:"equals"`
+}
+
+// ContentType configures one kind of content, such as posts or recipes. A file has the
+// type its type key names, else the first type (by name) whose Paths globs match it,
+// else the type sharing the schema its schemas rule picks. Fields are the keys board and
+// export show for files of the type when --type is given without --fields.
+type ContentType struct {
+	Paths    []string       `yaml:"paths"`
+	Schema   string         `yaml:"schema"`
+	Defaults map[string]any `yaml:"defaults"`
+	Fields   []string       `yaml:"fields"`
+}
+
+// SchemaRule maps a path glob (relative to the config directory) to a schema file
+type SchemaRule struct {
+	Path   string `yaml:"path"`
+	Schema string `yaml:"schema"`
+}
+
+// Schema is the JSON Schema subset used to validate frontmatter
+type Schema struct {
+	Type                 string             `yaml:"type"`
+	Required             []string           `yaml:"required"`
+	Properties           map[string]*Schema `yaml:"properties"`
+	AdditionalProperties *bool              `yaml:"additionalProperties"`
+	Items                *Schema            `yaml:"items"`
+	Enum                 []any              `yaml:"enum"`
+	Pattern              string             `yaml:"pattern"`
+	Format               string             `yaml:"format"`
+	Default              any                `yaml:"default"`
+	ReadOnly             bool               `yaml:"readOnly"`
+	Secret               bool               `yaml:"secret"`
+	Unique               bool               `yaml:"unique"`
+}
+
+// TrashEntry is a frontmatter block removed by delete --trash, kept for restore
+type TrashEntry struct {
+	Path        string    `json:"path"`
+	DeletedAt   time.Time `json:"deleted_at"`
+	Frontmatter string    `json:"frontmatter"`
+}
+
+// Snapshot captures the frontmatter of a set of files at one point in time
+type Snapshot struct {
+	CreatedAt time.Time                 `json:"created_at"`
+	Files     map[string]map[string]any `json:"files"`
+}
+
 // ExitError represents an error with a specific exit code
 type ExitError struct {
 	Code    int
@@ -55,662 +282,12772 @@ func run(args []string) error {
 	command := args[0]
 	args = args[1:]
 
+	switch command {
+	case "--help", "-h":
+		printUsage()
+		return nil
+	case "--version":
+		return handleVersion(args)
+	}
+	if help := findCommand(command); help != nil && wantsHelp(args) {
+		printCommandHelp(help)
+		return nil
+	}
+
 	dryRun := false
+	gitCommit := false
+	commitTemplate := ""
 
 	// Parse global flags like --dry-run
 	processedArgs := []string{}
-	for _, arg := range args {
-		switch arg {
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
 		case "--dry-run":
 			dryRun = true
+		case "--no-cache":
+			parseCacheDisabled = true
+		case "--format":
+			// --format yaml-file is global; other --format values belong to the command
+			if i+1 < len(args) && args[i+1] == "yaml-file" {
+				yamlFileMode = true
+				i++
+			} else {
+				processedArgs = append(processedArgs, arg)
+			}
+		case "--locale":
+			if i+1 >= len(args) {
+				return fmt.Errorf("flag --locale requires a value")
+			}
+			i++
+			if err := setDateLocales(args[i]); err != nil {
+				return err
+			}
+		case "--git-commit":
+			gitCommit = true
+		case "-m":
+			if i+1 >= len(args) {
+				return fmt.Errorf("flag -m requires a value")
+			}
+			i++
+			commitTemplate = args[i]
 		default:
 			processedArgs = append(processedArgs, arg)
 		}
 	}
 	args = processedArgs
+	if commitTemplate != "" && !gitCommit {
+		return fmt.Errorf("-m can only be used with --git-commit")
+	}
+
+	err := dispatch(command, args, dryRun)
+	saveParseCache()
+	if err != nil {
+		return err
+	}
+	if gitCommit && !dryRun {
+		return commitWrittenFiles(command, commitTemplate)
+	}
+	return nil
+}
 
+// dispatch runs the handler of a command
+func dispatch(command string, args []string, dryRun bool) error {
 	switch command {
 	case "get":
 		return handleGet(args)
+	case "has":
+		return handleHas(args)
+	case "len":
+		return handleLen(args)
 	case "set":
 		return handleSet(args, dryRun)
+	case "copy":
+		return handleCopy(args, dryRun)
+	case "rename":
+		return handleRename(args, dryRun)
 	case "delete":
 		return handleDelete(args, dryRun)
+	case "remove":
+		return handleRemove(args, dryRun)
+	case "insert":
+		return handleInsert(args, dryRun)
+	case "dedupe":
+		return handleDedupe(args, dryRun)
+	case "sort":
+		return handleSort(args, dryRun)
+	case "json":
+		return handleJSON(args)
+	case "unjson":
+		return handleUnjson(args, dryRun)
+	case "replace-all":
+		return handleReplaceAll(args, dryRun)
+	case "import-html":
+		return handleImportHTML(args, dryRun)
+	case "migrate-from":
+		return handleMigrateFrom(args, dryRun)
+	case "import-props":
+		return handleImportProps(args, dryRun)
+	case "git-meta":
+		return handleGitMeta(args, dryRun)
+	case "history":
+		return handleHistory(args)
+	case "blame":
+		return handleBlame(args)
+	case "resolve":
+		return handleResolve(args, dryRun)
+	case "merge3":
+		return handleMerge3(args, dryRun)
+	case "plan":
+		return handlePlan(args)
+	case "apply":
+		return handleApply(args, dryRun)
+	case "compute":
+		return handleCompute(args, dryRun)
+	case "ids":
+		return handleIDs(args, dryRun)
+	case "stale":
+		return handleStale(args, dryRun)
+	case "grep":
+		return handleGrep(args)
+	case "search", "query":
+		return handleSearch(args)
+	case "missing":
+		return handleMissing(args)
+	case "scheduled":
+		return handleScheduled(args)
+	case "suggest":
+		return handleSuggest(args, dryRun)
+	case "graph":
+		return handleGraph(args)
+	case "stats":
+		return handleStats(args)
+	case "board":
+		return handleBoard(args)
+	case "schema":
+		return handleSchema(args)
+	case "type":
+		return handleType(args)
+	case "validate":
+		return handleValidate(args, dryRun)
+	case "ensure":
+		return handleEnsure(args, dryRun)
+	case "scaffold":
+		return handleScaffold(args, dryRun)
+	case "restore":
+		return handleRestore(args, dryRun)
+	case "snapshot":
+		return handleSnapshot(args, dryRun)
+	case "bundle":
+		return handleBundle(args, dryRun)
+	case "drift":
+		return handleDrift(args)
+	case "dupes":
+		return handleDupes(args)
+	case "url":
+		return handleURL(args)
+	case "export":
+		return handleExport(args)
+	case "sidecar":
+		return handleSidecar(args)
+	case "check":
+		return handleCheck(args)
+	case "fix":
+		return handleFix(args, dryRun)
+	case "lint":
+		return handleLint(args)
+	case "run":
+		return handleRun(args, dryRun)
+	case "help":
+		return handleHelp(args)
+	case "version":
+		return handleVersion(args)
 	default:
 		printUsage()
 		return fmt.Errorf("unknown command: %s", command)
 	}
 }
 
-func printUsage() {
-	fmt.Println("Usage: frontmatter [get|set|delete] [--dry-run] [...] <file>")
-	fmt.Println("Examples:")
-	fmt.Println("  frontmatter set message=\"Hello World\" file.md")
-	fmt.Println("  frontmatter set object.field=5 file.md")
-	fmt.Println("  frontmatter set a=1 b=value file.md")
-	fmt.Println("  frontmatter get message file.md")
-	fmt.Println("  frontmatter get file.md")
-	fmt.Println("  frontmatter delete file.md")
-	fmt.Println("  frontmatter delete title file.md")
-	fmt.Println("  frontmatter delete first second file.md")
-	fmt.Println("  frontmatter delete object.field file.md")
+// helpEntry is one flag or exit code line of a command's help
+type helpEntry struct {
+	Name        string
+	Description string
 }
 
-func readFileContent(filePath string) (string, string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// If file doesn't exist, treat as empty frontmatter and no body
-			return "", "", nil
-		}
-		return "", "", fmt.Errorf("failed to open file: %w", err)
-	}
-	defer file.Close()
-
-	reader := bufio.NewReader(file)
-	var frontmatterContent, bodyContent strings.Builder
-	inFrontmatter := false
-	separatorCount := 0
+// commandHelp documents a command for `frontmatter help <command>` and `<command> --help`
+type commandHelp struct {
+	Name      string
+	Summary   string
+	Usage     []string
+	Flags     []helpEntry
+	Examples  []string
+	ExitCodes []helpEntry
+}
 
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil && err != io.EOF {
-			return "", "", fmt.Errorf("failed to read file: %w", err)
-		}
+// walkFlagHelp documents walkBoolFlags and walkValueFlags
+var walkFlagHelp = []helpEntry{
+	{"--include <glob>", "only process matching files (repeatable)"},
+	{"--exclude <glob>", "skip matching files and directories (repeatable)"},
+	{"--max-depth <n>", "limit how deep directories are walked"},
+	{"--hidden", "walk hidden files and directories"},
+	{"--follow-symlinks", "follow symlinks (--no-follow-symlinks to skip them)"},
+	{"--max-file-size <size>", "skip files larger than size, e.g. 512K or 10M"},
+	{"--force", "process files above --max-file-size anyway"},
+	{"--changed-since <ref>", "only files changed since the merge base with a git ref"},
+	{"--git-dirty", "only files with uncommitted changes"},
+	whereFlagHelp,
+	{"--type <name>", "only files of a content type from the config"},
+	limitFlagHelp,
+	sampleFlagHelp,
+	seedFlagHelp,
+}
 
-		trimmed := strings.TrimSpace(line)
-		// Treat only first two separators as frontmatter delimiters
-		if trimmed == frontmatterSeparator && separatorCount < 2 {
-			separatorCount++
-			if separatorCount == 1 {
-				inFrontmatter = true
-			} else if separatorCount == 2 {
-				inFrontmatter = false
-			}
-			if err == io.EOF {
-				break
-			}
-			continue
-		}
+var (
+	yesFlagHelp      = helpEntry{"--yes", "allow modifying more than 100 files"}
+	resumeFlagHelp   = helpEntry{"--resume", "continue an interrupted run, skipping files it already processed"}
+	throttleFlagHelp = helpEntry{"--throttle <n>", "write at most n files per second, e.g. 0.5"}
+	niceFlagHelp     = helpEntry{"--nice", "run with lowered CPU and I/O priority"}
+	dryRunFlagHelp   = helpEntry{"--dry-run", "print the result instead of writing files"}
+	whereFlagHelp    = helpEntry{"--where <query>", "only files matching a query, or @name for a saved one"}
+	limitFlagHelp    = helpEntry{"--limit <n>", "only the first n selected files"}
+	sampleFlagHelp   = helpEntry{"--sample <n>", "only n selected files picked at random"}
+	seedFlagHelp     = helpEntry{"--seed <n>", "seed for --sample, to pick the same files again"}
+	redactFlagHelp   = helpEntry{"--redact <keys>", "comma-separated keys to print as ***"}
+	secretsFlagHelp  = helpEntry{"--show-secrets", "print secret values instead of ***"}
+	outputFlagHelp   = helpEntry{"--output json|text", "print as JSON or as text (default); --json is short for --output json"}
 
-		if inFrontmatter && separatorCount == 1 {
-			frontmatterContent.WriteString(line)
-		} else {
-			bodyContent.WriteString(line)
-		}
+	maxFrontmatterBytesFlagHelp = helpEntry{"--max-frontmatter-bytes <size>", "flag frontmatter blocks larger than size, e.g. 4K"}
+)
 
-		if err == io.EOF {
-			break
-		}
-	}
+// linkFlagHelp documents the dead link check of lint and check
+var linkFlagHelp = []helpEntry{
+	{"--check-links", "request the URLs of url-format keys and report dead links"},
+	{"--concurrency <n>", "requests made at the same time (default 8)"},
+	{"--link-cache-ttl <age>", "reuse results younger than age, e.g. 1h or 7d (default 24h, 0 checks again)"},
+	{"--link-timeout <duration>", "give up on a URL after this long (default 10s)"},
+}
 
-	// If only one separator or no separators, it's not valid frontmatter block
-	if separatorCount < 2 {
-		// The entire content is body if no frontmatter was properly defined
-		return "", frontmatterContent.String() + bodyContent.String(), nil
-	}
+// geoFlagHelp documents the coordinate filters of search and query
+var geoFlagHelp = []helpEntry{
+	{"--near <lat,lng>", "only files whose coordinates lie near a point, nearest first"},
+	{"--within <distance>", "radius of --near, e.g. 500m, 50km or 10mi (default 10km)"},
+	{"--bbox <s,w,n,e>", "only files whose coordinates lie inside a bounding box"},
+	{"--geo-key <key>", "key holding the coordinates (default location)"},
+}
 
-	return frontmatterContent.String(), bodyContent.String(), nil
+// defaultExitCodes apply to commands that do not document their own
+var defaultExitCodes = []helpEntry{
+	{"0", "success"},
+	{"1", "error (invalid arguments, unreadable files, ...)"},
 }
 
-func parseFrontmatter(fmString string) (map[string]any, error) {
-	data := make(map[string]any)
-	if strings.TrimSpace(fmString) == "" {
-		return data, nil // Empty frontmatter is valid
-	}
-	err := yaml.Unmarshal([]byte(fmString), &data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse YAML frontmatter: %w", err)
-	}
-	return data, nil
+var commands = []commandHelp{
+	{
+		Name:    "get",
+		Summary: "Print a field or the whole frontmatter",
+		Usage:   []string{"frontmatter get [flags] [key] <file>"},
+		Flags: []helpEntry{
+			{"--effective", "merge in _defaults.yaml values from parent directories"},
+			redactFlagHelp,
+			secretsFlagHelp,
+			{"--jsonpath <expr>", "print the values a JSONPath expression selects"},
+			{"--expr <filter>", "print the outputs of a jq filter"},
+		},
+		Examples: []string{
+			"frontmatter get message file.md",
+			"frontmatter get file.md",
+			"frontmatter get --effective layout file.md",
+			"frontmatter get --jsonpath '$.characters[?(@.id == \"X\")].name' file.md",
+			"frontmatter get --expr '.tags | length' file.md",
+			"frontmatter get --redact token,password file.md",
+		},
+		ExitCodes: []helpEntry{{"0", "success"}, {"1", "error"}, {"2", "no frontmatter or field not found"}},
+	},
+	{
+		Name:     "has",
+		Summary:  "Check that fields exist",
+		Usage:    []string{"frontmatter has key... <file>"},
+		Examples: []string{"frontmatter has draft file.md && echo present", "frontmatter has 'authors[name=Ann]' file.md"},
+		ExitCodes: []helpEntry{
+			{"0", "every key exists, even with a null or false value"},
+			{"1", "error"},
+			{"2", "a key or the frontmatter is missing"},
+		},
+	},
+	{
+		Name:     "len",
+		Summary:  "Print the number of elements of a list or keys of a map",
+		Usage:    []string{"frontmatter len <key> <file>"},
+		Examples: []string{"frontmatter len tags file.md", "frontmatter len 'authors.*.links' file.md"},
+		ExitCodes: []helpEntry{
+			{"0", "success"},
+			{"1", "error, including a value that is not a list or map"},
+			{"2", "the key or the frontmatter is missing"},
+		},
+	},
+	{
+		Name:    "set",
+		Summary: "Set one or more fields",
+		Usage:   []string{"frontmatter set [flags] key=value... <file>", "frontmatter set --where <query> [flags] key=value... <file|dir>"},
+		Flags: []helpEntry{
+			{"--validate", "refuse values violating the schema or config patterns"},
+			{"--fix-case", "normalize values differing from an enum value only in case"},
+			{"--keep-type", "keep the type of existing values, e.g. 007 stays a string"},
+			{"--merge", "deep-merge map values into an existing map instead of replacing it"},
+			{"--force", "change immutable keys and skip enum checks"},
+			{"--force-path", "replace values in the way of a nested key, e.g. a string at a when setting a.b"},
+			{"--create-missing", "append a list element for [field=value] selectors matching none"},
+			{"--json", "print the changes and replaced values of each file as JSON"},
+			whereFlagHelp,
+			limitFlagHelp,
+			sampleFlagHelp,
+			seedFlagHelp,
+			yesFlagHelp,
+			resumeFlagHelp,
+			throttleFlagHelp,
+			niceFlagHelp,
+			dryRunFlagHelp,
+		},
+		Examples: []string{
+			"frontmatter set message=\"Hello World\" file.md",
+			"frontmatter set object.field=5 file.md",
+			"frontmatter set a=1 b=value file.md",
+			"frontmatter set tags[]=golang file.md",
+			"frontmatter set 'version:=\"1.10\"' 'authors:=[{name: Ann}]' file.md",
+			"frontmatter set --merge config='{cache: {ttl: 60}}' file.md",
+			"frontmatter set --validate slug=my-post file.md",
+			"frontmatter set --where 'category == \"news\"' layout=article content/",
+		},
+	},
+	{
+		Name:    "delete",
+		Summary: "Delete fields or the whole frontmatter",
+		Usage:   []string{"frontmatter delete [flags] [key...] <file>", "frontmatter delete --where <query> [flags] [key...] <file|dir>"},
+		Flags: []helpEntry{
+			{"--trash", "keep the deleted frontmatter for restore"},
+			{"--force", "delete immutable keys"},
+			{"--recursive", "delete the keys at any depth; the last argument may be a directory"},
+			whereFlagHelp,
+			limitFlagHelp,
+			sampleFlagHelp,
+			seedFlagHelp,
+			yesFlagHelp,
+			resumeFlagHelp,
+			throttleFlagHelp,
+			niceFlagHelp,
+			dryRunFlagHelp,
+		},
+		Examples: []string{
+			"frontmatter delete file.md",
+			"frontmatter delete title file.md",
+			"frontmatter delete first second file.md",
+			"frontmatter delete object.field file.md",
+			"frontmatter delete --trash file.md",
+			"frontmatter delete --recursive internal_id content/",
+		},
+	},
+	{
+		Name:    "rename",
+		Summary: "Move a value from one key to another",
+		Usage:   []string{"frontmatter rename [flags] <old-key> <new-key> <file|dir>"},
+		Flags: append([]helpEntry{
+			{"--overwrite", "replace a value already at the new key"},
+			{"--force", "move immutable keys"},
+			yesFlagHelp,
+			resumeFlagHelp,
+			throttleFlagHelp,
+			niceFlagHelp,
+			dryRunFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter rename image cover.src file.md",
+			"frontmatter rename --overwrite meta.author author content/",
+		},
+	},
+	{
+		Name:    "copy",
+		Summary: "Copy a value to another key, or from another file",
+		Usage: []string{
+			"frontmatter copy [flags] <from-key> <to-key> <file|dir>",
+			"frontmatter copy --from <source> [flags] <from-key> [to-key] <file|dir>",
+		},
+		Flags: append([]helpEntry{
+			{"--from <file>", "read the value from this file instead of each target"},
+			{"--overwrite", "replace a value already at the destination key"},
+			{"--force", "change immutable keys"},
+			yesFlagHelp,
+			resumeFlagHelp,
+			throttleFlagHelp,
+			niceFlagHelp,
+			dryRunFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter copy title summary.heading file.md",
+			"frontmatter copy --from template.md defaults file.md",
+		},
+	},
+	{
+		Name:    "remove",
+		Summary: "Remove values from lists",
+		Usage:   []string{"frontmatter remove [flags] key=value... <file|dir>..."},
+		Flags: append([]helpEntry{
+			yesFlagHelp,
+			resumeFlagHelp,
+			throttleFlagHelp,
+			niceFlagHelp,
+			dryRunFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter remove tags=golang file.md",
+			"frontmatter remove tags=draft categories=misc content/",
+		},
+	},
+	{
+		Name:    "sort",
+		Summary: "Sort the values of lists",
+		Usage:   []string{"frontmatter sort [flags] key... <file|dir>"},
+		Flags: append([]helpEntry{
+			{"--numeric", "compare values as numbers"},
+			{"--reverse", "sort in descending order"},
+			{"--by <key>", "sort a list of maps by the value of a key"},
+			yesFlagHelp,
+			resumeFlagHelp,
+			throttleFlagHelp,
+			niceFlagHelp,
+			dryRunFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter sort tags file.md",
+			"frontmatter sort --numeric --reverse scores file.md",
+			"frontmatter sort --by name authors content/",
+		},
+	},
+	{
+		Name:    "insert",
+		Summary: "Insert list elements at a position",
+		Usage:   []string{"frontmatter insert [flags] key[index]=value... <file>"},
+		Flags:   []helpEntry{dryRunFlagHelp},
+		Examples: []string{
+			"frontmatter insert menu.items[2]='{name: Blog}' file.md",
+			"frontmatter insert tags[0]=featured file.md",
+		},
+	},
+	{
+		Name:    "dedupe",
+		Summary: "Remove duplicate values from lists",
+		Usage:   []string{"frontmatter dedupe [flags] key... <file|dir>"},
+		Flags: append([]helpEntry{
+			yesFlagHelp,
+			resumeFlagHelp,
+			throttleFlagHelp,
+			niceFlagHelp,
+			dryRunFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter dedupe tags file.md",
+			"frontmatter dedupe tags categories content/",
+		},
+	},
+	{
+		Name:    "restore",
+		Summary: "Restore frontmatter removed by delete --trash",
+		Usage:   []string{"frontmatter restore [flags] <file>"},
+		Flags: []helpEntry{
+			{"--force", "replace frontmatter the file already has"},
+			dryRunFlagHelp,
+		},
+		Examples:  []string{"frontmatter restore file.md"},
+		ExitCodes: []helpEntry{{"0", "success"}, {"1", "error"}, {"2", "nothing stored for the file"}},
+	},
+	{
+		Name:    "json",
+		Summary: "Print frontmatter, body and path as JSON",
+		Usage:   []string{"frontmatter json [flags] <file>"},
+		Flags: []helpEntry{
+			redactFlagHelp,
+			secretsFlagHelp,
+		},
+		Examples: []string{"frontmatter json file.md"},
+	},
+	{
+		Name:     "unjson",
+		Summary:  "Write a document read as JSON from stdin",
+		Usage:    []string{"frontmatter unjson [--dry-run] < document.json"},
+		Flags:    []helpEntry{dryRunFlagHelp},
+		Examples: []string{"frontmatter unjson < document.json"},
+	},
+	{
+		Name:    "replace-all",
+		Summary: "Replace the whole frontmatter with a YAML document, keeping the body",
+		Usage:   []string{"frontmatter replace-all [flags] <file> < new.yaml"},
+		Flags: []helpEntry{
+			{"--from <file>", "read the new frontmatter from file instead of stdin"},
+			{"--force", "skip schema validation and immutable key checks"},
+			dryRunFlagHelp,
+		},
+		Examples: []string{
+			"frontmatter replace-all post.md < new.yaml",
+			"frontmatter replace-all post.md --from new.yaml",
+		},
+	},
+	{
+		Name:    "import-html",
+		Summary: "Turn an HTML page into a markdown file, its title and meta tags into frontmatter",
+		Usage:   []string{"frontmatter import-html [flags] <page.html>"},
+		Flags: []helpEntry{
+			{"--to <file>", "write the document into file instead of printing it"},
+			{"--frontmatter-only", "import only the metadata; with --to the body of file is kept"},
+			{"--force", "replace a body file already has with the page body"},
+			dryRunFlagHelp,
+		},
+		Examples: []string{
+			"frontmatter import-html page.html",
+			"frontmatter import-html page.html --to page.md",
+			"frontmatter import-html --frontmatter-only page.html --to page.md",
+		},
+	},
+	{
+		Name:    "migrate-from",
+		Summary: "Create markdown files from a WordPress or Ghost export",
+		Usage:   []string{"frontmatter migrate-from <wordpress|ghost> <export> --out <dir> [flags]"},
+		Flags: []helpEntry{
+			{"--out <dir>", "directory the markdown files are written to"},
+			{"--force", "overwrite files that already exist"},
+			yesFlagHelp,
+			dryRunFlagHelp,
+		},
+		Examples: []string{
+			"frontmatter migrate-from wordpress export.xml --out content/",
+			"frontmatter migrate-from ghost ghost-export.json --out content/",
+		},
+	},
+	{
+		Name:    "import-props",
+		Summary: "Turn Notion or Confluence page properties into frontmatter",
+		Usage:   []string{"frontmatter import-props <notion|confluence> [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			{"--mapping <file>", "YAML file mapping property names to keys and types"},
+			yesFlagHelp,
+			dryRunFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter import-props notion export/",
+			"frontmatter import-props confluence --mapping fields.yaml space/",
+		},
+	},
+	{
+		Name:    "git-meta",
+		Summary: "Set dates and authors from git history",
+		Usage:   []string{"frontmatter git-meta [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			{"--lastmod-from-log", "set the last commit date"},
+			{"--authors-from-log", "set the commit authors"},
+			{"--contributors-from-log", "append new commit authors to the contributors list"},
+			{"--lastmod-key <key>", "key for the date (default lastmod)"},
+			{"--authors-key <key>", "key for the authors (default authors)"},
+			{"--contributors-key <key>", "key for the contributors (default contributors)"},
+			yesFlagHelp,
+			resumeFlagHelp,
+			throttleFlagHelp,
+			niceFlagHelp,
+			dryRunFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter git-meta --lastmod-from-log --authors-from-log dir/",
+			"frontmatter git-meta --contributors-from-log file.md",
+		},
+	},
+	{
+		Name:    "history",
+		Summary: "Show when and how a key changed in git history",
+		Usage:   []string{"frontmatter history --key <key> [--json] <file>"},
+		Flags: []helpEntry{
+			{"--key <key>", "key to follow, dot paths allowed"},
+			{"--json", "print the changes as JSON"},
+		},
+		Examples: []string{"frontmatter history --key price product.md"},
+	},
+	{
+		Name:    "blame",
+		Summary: "Show the commit that last changed each key",
+		Usage:   []string{"frontmatter blame [--json] <file>"},
+		Flags: []helpEntry{
+			{"--json", "print the attribution as JSON"},
+		},
+		Examples: []string{"frontmatter blame post.md"},
+	},
+	{
+		Name:    "resolve",
+		Summary: "Resolve git conflict markers in frontmatter key by key",
+		Usage:   []string{"frontmatter resolve [--ours <key>]... [--theirs <key>]... [--union <key>]... <file>"},
+		Flags: []helpEntry{
+			{"--ours <key>", "keep our side of key"},
+			{"--theirs <key>", "take their side of key"},
+			{"--union <key>", "combine both sides of key: lists are merged, maps joined"},
+			dryRunFlagHelp,
+		},
+		Examples: []string{
+			"frontmatter resolve --theirs title --union tags post.md",
+		},
+		ExitCodes: []helpEntry{
+			{"1", "a conflicting key was not given a side, or a union is not possible"},
+		},
+	},
+	{
+		Name:    "merge3",
+		Summary: "Three-way merge two edits of a file key by key",
+		Usage:   []string{"frontmatter merge3 [-o <file>] [--json] <base> <ours> <theirs>"},
+		Flags: []helpEntry{
+			{"--out, -o <file>", "write the merged document to a file instead of stdout"},
+			{"--json", "print a JSON report of the merge instead of the document"},
+			dryRunFlagHelp,
+		},
+		Examples: []string{
+			"frontmatter merge3 base.md ours.md theirs.md -o merged.md",
+			"frontmatter merge3 --json base.md ours.md theirs.md",
+		},
+		ExitCodes: []helpEntry{
+			{"1", "keys or the body were changed differently on both sides; our side is kept for them"},
+		},
+	},
+	{
+		Name:    "plan",
+		Summary: "Record the changes a command would make without writing them",
+		Usage:   []string{"frontmatter plan --out <plan.json> <command> [args...]"},
+		Flags: []helpEntry{
+			{"--out, -o <file>", "file to write the plan to"},
+		},
+		Examples: []string{
+			"frontmatter plan -o plan.json set --where @drafts draft=false content/",
+			"frontmatter plan -o plan.json run publish posts/hello.md",
+		},
+	},
+	{
+		Name:    "apply",
+		Summary: "Write the changes recorded by plan",
+		Usage:   []string{"frontmatter apply [--yes] <plan.json>"},
+		Flags: []helpEntry{
+			yesFlagHelp,
+			dryRunFlagHelp,
+		},
+		Examples: []string{"frontmatter apply plan.json"},
+		ExitCodes: []helpEntry{
+			{"1", "a planned file changed since planning; nothing was written"},
+		},
+	},
+	{
+		Name:    "compute",
+		Summary: "Fill in computed fields",
+		Usage:   []string{"frontmatter compute [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			{"--detect-lang", "detect the body language when lang, language and --lang-key are unset"},
+			{"--lang-key <key>", "key for the language (default lang)"},
+			{"--force", "detect the language even when one is set"},
+			yesFlagHelp,
+			resumeFlagHelp,
+			throttleFlagHelp,
+			niceFlagHelp,
+			dryRunFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{"frontmatter compute --detect-lang dir/"},
+	},
+	{
+		Name:    "ids",
+		Summary: "Assign generated identifiers to files missing one",
+		Usage:   []string{"frontmatter ids assign [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			{"--key <key>", "key holding the identifier (default id)"},
+			{"--format <format>", "uuid (default), ulid, nanoid or seq"},
+			{"--state <file>", "file keeping the last seq number across runs"},
+			yesFlagHelp,
+			dryRunFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter ids assign --key id --format ulid dir/",
+			"frontmatter ids assign --format seq --state .frontmatter-seq dir/",
+		},
+	},
+	{
+		Name:    "grep",
+		Summary: "Search frontmatter values for a regular expression",
+		Usage:   []string{"frontmatter grep --regex <re> [--key <glob>] [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			{"--regex <re>", "regular expression to search values for"},
+			{"--key <glob>", "only search keys matching the glob; * is one level, ** any depth (default **)"},
+			{"--ignore-case", "match case-insensitively"},
+			redactFlagHelp,
+			secretsFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter grep --key '**' --regex 'TODO|FIXME' dir/",
+			"frontmatter grep --key 'authors.*' --regex '^J' dir/",
+		},
+		ExitCodes: []helpEntry{
+			{"2", "no value matched"},
+		},
+	},
+	{
+		Name:    "search",
+		Summary: "List files whose frontmatter and body match a query",
+		Usage:   []string{"frontmatter search [flags] <query> [file|dir]..."},
+		Flags:   slices.Concat(geoFlagHelp, walkFlagHelp),
+		Examples: []string{
+			"frontmatter search 'tags contains \"go\" AND body contains \"generics\"' dir/",
+			"frontmatter search 'draft == false AND (date >= 2024-01-01 OR featured)' dir/",
+			"frontmatter search --near 51.1,17.03 --within 50km 'draft == false' posts/",
+		},
+		ExitCodes: []helpEntry{
+			{"2", "no file matched"},
+		},
+	},
+	{
+		Name:    "query",
+		Summary: "List files matching a query saved in the config",
+		Usage:   []string{"frontmatter query [flags] @<name> [file|dir]..."},
+		Flags:   slices.Concat(geoFlagHelp, walkFlagHelp),
+		Examples: []string{
+			"frontmatter query @drafts",
+			"frontmatter query @stale content/",
+			"frontmatter query --bbox 49,14,55,24 @published posts/",
+		},
+		ExitCodes: []helpEntry{
+			{"2", "no file matched"},
+		},
+	},
+	{
+		Name:    "stale",
+		Summary: "List files whose date key is older than a threshold or missing",
+		Usage:   []string{"frontmatter stale --older-than <age> [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			{"--older-than <age>", "threshold such as 180d, 6w, 1y or 36h"},
+			{"--key <key>", "date key to check (default lastmod)"},
+			{"--mark", "set needs_review: true in the listed files"},
+			{"--mark-key <key>", "key written by --mark (default needs_review)"},
+			yesFlagHelp,
+			dryRunFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter stale --key lastmod --older-than 180d dir/",
+			"frontmatter stale --older-than 1y --mark dir/",
+		},
+	},
+	{
+		Name:     "missing",
+		Summary:  "List files without frontmatter or with an empty block",
+		Usage:    []string{"frontmatter missing [flags] <file|dir>..."},
+		Flags:    append([]helpEntry{outputFlagHelp}, walkFlagHelp...),
+		Examples: []string{"frontmatter missing docs/", "frontmatter missing --output json docs/"},
+		ExitCodes: []helpEntry{
+			{"0", "every file has frontmatter"},
+			{"1", "error, or files without frontmatter were found"},
+		},
+	},
+	{
+		Name:    "scheduled",
+		Summary: "List files published in the future or past their expiry date",
+		Usage:   []string{"frontmatter scheduled [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			{"--date-key <key>", "publish date key (default date)"},
+			{"--expiry-key <key>", "expiry date key (default expiryDate)"},
+			{"--json", "print the list as JSON"},
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter scheduled dir/",
+			"frontmatter scheduled --date-key publishDate --json dir/",
+		},
+	},
+	{
+		Name:    "suggest",
+		Summary: "Suggest related files by shared tags or categories",
+		Usage:   []string{"frontmatter suggest related [flags] <file>"},
+		Flags: append([]helpEntry{
+			{"--by <keys>", "comma-separated keys to compare (default tags)"},
+			{"--top <n>", "number of suggestions (default 5)"},
+			{"--in <dir>", "files to compare with (repeatable, default the project root)"},
+			{"--write", "store the suggestions in the file's related list"},
+			{"--related-key <key>", "key written by --write (default related)"},
+			dryRunFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter suggest related --by tags --top 5 file.md",
+			"frontmatter suggest related --by tags,categories --write file.md",
+		},
+	},
+	{
+		Name:    "graph",
+		Summary: "Export references between files as a Graphviz or JSON graph",
+		Usage:   []string{"frontmatter graph [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			{"--edges <keys>", "comma-separated keys holding references (default related)"},
+			{"--format <format>", "dot (default) or json"},
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter graph --edges related,parent,links dir/ | dot -Tsvg > graph.svg",
+			"frontmatter graph --format json dir/",
+		},
+	},
+	{
+		Name:    "stats",
+		Summary: "Summarize the values of keys across files",
+		Usage:   []string{"frontmatter stats --key <key>... [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			{"--key <key>", "key to summarize (repeatable)"},
+			redactFlagHelp,
+			secretsFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{"frontmatter stats --key words --key date dir/"},
+	},
+	{
+		Name:    "board",
+		Summary: "Print a column per status of task-style notes",
+		Usage:   []string{"frontmatter board [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			{"--group-by <key>", "key whose values become columns (default status)"},
+			{"--fields <keys>", "comma-separated keys shown on each card (default title)"},
+			{"--columns <values>", "comma-separated column order; other values follow"},
+			{"--json", "print the board as JSON"},
+			redactFlagHelp,
+			secretsFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter board --group-by status --fields title,assignee dir/",
+			"frontmatter board --columns todo,review,done --json dir/",
+		},
+	},
+	{
+		Name:    "validate",
+		Summary: "Check files against schemas, patterns, enums and unique keys",
+		Usage:   []string{"frontmatter validate [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			{"--schema <file>", "use this schema instead of the config's schemas rules"},
+			{"--fix-case", "normalize values differing from an enum value only in case"},
+			{"--normalize", "rewrite duration, time, geo and identifier values in canonical form"},
+			dryRunFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter validate dir/",
+			"frontmatter validate --schema post.schema.json file.md",
+			"frontmatter validate --fix-case dir/",
+			"frontmatter validate --normalize dir/",
+		},
+		ExitCodes: []helpEntry{{"0", "all files valid"}, {"1", "violations found or error"}},
+	},
+	{
+		Name:    "schema",
+		Summary: "List the keys, types and enum values a schema defines",
+		Usage:   []string{"frontmatter schema keys [flags] [file]"},
+		Flags: []helpEntry{
+			{"--schema <file>", "use this schema instead of the one the config assigns to file"},
+			{"--output json|text", "print the keys as JSON, e.g. for editor completion, or as text (default); --json is short for --output json"},
+		},
+		Examples: []string{
+			"frontmatter schema keys posts/hello.md",
+			"frontmatter schema keys --schema post.schema.yaml --output json",
+		},
+	},
+	{
+		Name:     "type",
+		Summary:  "Print the content type of files",
+		Usage:    []string{"frontmatter type [flags] <file|dir>..."},
+		Flags:    walkFlagHelp,
+		Examples: []string{"frontmatter type recipes/soup.md", "frontmatter type content/"},
+		ExitCodes: []helpEntry{
+			{"0", "success"},
+			{"1", "error"},
+			{"2", "a single file has no content type"},
+		},
+	},
+	{
+		Name:    "scaffold",
+		Summary: "Add the required keys a file's schema expects, or a template's keys",
+		Usage:   []string{"frontmatter scaffold [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			{"--schema <file>", "use this schema instead of the config's schemas rules"},
+			{"--template <file>", "also add the template's keys the file does not set"},
+			yesFlagHelp,
+			dryRunFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{"frontmatter scaffold file.md", "frontmatter scaffold --template templates/post.yaml posts/"},
+	},
+	{
+		Name:    "ensure",
+		Summary: "Add a template's frontmatter to files that have none",
+		Usage:   []string{"frontmatter ensure --template <file> [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			{"--template <file>", "YAML file with the frontmatter to add; may extend another template"},
+			yesFlagHelp,
+			resumeFlagHelp,
+			throttleFlagHelp,
+			niceFlagHelp,
+			dryRunFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{"frontmatter ensure --template minimal.yaml content/"},
+	},
+	{
+		Name:    "snapshot",
+		Summary: "Capture, compare and restore the frontmatter of a tree",
+		Usage: []string{
+			"frontmatter snapshot create [flags] <file|dir>... > snap.json",
+			"frontmatter snapshot diff [flags] snap.json [file|dir...]",
+			"frontmatter snapshot restore [flags] snap.json",
+		},
+		Flags: append([]helpEntry{yesFlagHelp, dryRunFlagHelp}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter snapshot create dir/ > snap.json",
+			"frontmatter snapshot diff snap.json dir/",
+			"frontmatter snapshot restore snap.json",
+		},
+	},
+	{
+		Name:    "bundle",
+		Summary: "Export and import the frontmatter of many files as one YAML document",
+		Usage: []string{
+			"frontmatter bundle export [flags] <file|dir>...",
+			"frontmatter bundle import [flags] meta.yaml",
+		},
+		Flags: append([]helpEntry{
+			{"--out, -o <file>", "write the exported bundle to a file"},
+			yesFlagHelp,
+			dryRunFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter bundle export dir/ -o meta.yaml",
+			"frontmatter bundle import meta.yaml",
+		},
+	},
+	{
+		Name:    "drift",
+		Summary: "Compare files key by key against a snapshot or bundle",
+		Usage:   []string{"frontmatter drift --against <snapshot|bundle> [flags] [file|dir...]"},
+		Flags: append([]helpEntry{
+			{"--against <file>", "snapshot or bundle to compare with"},
+		}, walkFlagHelp...),
+		Examples:  []string{"frontmatter drift --against snap.json dir/"},
+		ExitCodes: []helpEntry{{"0", "no drift"}, {"1", "drift found or error"}},
+	},
+	{
+		Name:    "url",
+		Summary: "Preview the URL files get from a permalink pattern",
+		Usage:   []string{"frontmatter url [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			{"--pattern <pattern>", "permalink pattern such as /:year/:month/:slug/ (default: config permalink)"},
+			{"--date-key <key>", "date key for :year, :month and :day (default date)"},
+			{"--check-collisions", "report files that get the same URL"},
+			redactFlagHelp,
+			secretsFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter url --pattern '/:year/:month/:slug/' post.md",
+			"frontmatter url --pattern '/:section/:slug/' --check-collisions content/",
+		},
+		ExitCodes: []helpEntry{{"0", "success"}, {"1", "URL collisions found or error"}},
+	},
+	{
+		Name:    "dupes",
+		Summary: "Group files whose bodies are identical or nearly so",
+		Usage:   []string{"frontmatter dupes [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			{"--by <method>", "how bodies are compared; only body-hash (default)"},
+			{"--exact", "hash bodies byte for byte instead of ignoring whitespace and case"},
+			{"--json", "print the groups as JSON"},
+		}, walkFlagHelp...),
+		Examples:  []string{"frontmatter dupes --by body-hash notes/"},
+		ExitCodes: []helpEntry{{"0", "success"}, {"1", "duplicates found or error"}},
+	},
+	{
+		Name:    "export",
+		Summary: "Export frontmatter as feed items, HTML meta tags or a calendar",
+		Usage:   []string{"frontmatter export --format <format> [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			{"--format <format>", "rss-items, json-feed, html-meta or ics"},
+			{"--fields <keys>", "comma-separated keys to export (default title,date,description,url)"},
+			{"--date-key <key>", "key ordering the items, newest first (default date); repeatable for ics"},
+			{"--title-key <key>", "key naming ics events (default title)"},
+			{"--base-url <url>", "prefix for url values and permalinks"},
+			{"--title <title>", "feed title of json-feed output (default Feed)"},
+			redactFlagHelp,
+			secretsFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter export --format rss-items --fields title,date,description,url content/",
+			"frontmatter export --format json-feed --base-url https://example.com content/",
+			"frontmatter export --format html-meta post.md",
+			"frontmatter export --format ics --date-key date --date-key deadline content/ > calendar.ics",
+		},
+	},
+	{
+		Name:    "sidecar",
+		Summary: "Report sidecar metadata files without their primary file and vice versa",
+		Usage:   []string{"frontmatter sidecar check [flags] <dir>..."},
+		Flags: append([]helpEntry{
+			{"--ext <ext>", "sidecar extension appended to the primary name (default .yaml and .yml)"},
+			{"--primary <glob>", "files that must have a sidecar (repeatable)"},
+		}, walkFlagHelp...),
+		Examples: []string{
+			"frontmatter sidecar check assets/",
+			"frontmatter sidecar check --primary '*.jpg' --primary '*.png' assets/",
+		},
+		ExitCodes: []helpEntry{{"0", "every sidecar has its primary file"}, {"1", "orphans found or error"}},
+	},
+	{
+		Name:      "check",
+		Summary:   "Report changed immutable keys and lint findings",
+		Usage:     []string{"frontmatter check [flags] <file|dir>..."},
+		Flags:     slices.Concat([]helpEntry{maxFrontmatterBytesFlagHelp}, linkFlagHelp, walkFlagHelp),
+		Examples:  []string{"frontmatter check dir/", "frontmatter check --max-frontmatter-bytes 4K dir/", "frontmatter check --check-links --concurrency 16 dir/"},
+		ExitCodes: []helpEntry{{"0", "no problems"}, {"1", "problems found or error"}},
+	},
+	{
+		Name:      "lint",
+		Summary:   "Run lint rules such as secret scanning",
+		Usage:     []string{"frontmatter lint [flags] <file|dir>..."},
+		Flags:     slices.Concat([]helpEntry{maxFrontmatterBytesFlagHelp}, linkFlagHelp, walkFlagHelp),
+		Examples:  []string{"frontmatter lint dir/", "frontmatter lint --check-links dir/"},
+		ExitCodes: []helpEntry{{"0", "no findings"}, {"1", "findings or error"}},
+	},
+	{
+		Name:    "fix",
+		Summary: "Rename keys the config declares as aliases to their canonical name",
+		Usage:   []string{"frontmatter fix [flags] <file|dir>..."},
+		Flags: append([]helpEntry{
+			yesFlagHelp,
+			resumeFlagHelp,
+			throttleFlagHelp,
+			niceFlagHelp,
+			dryRunFlagHelp,
+		}, walkFlagHelp...),
+		Examples: []string{"frontmatter fix content/"},
+	},
+	{
+		Name:     "run",
+		Summary:  "Run a preset defined in the config on each file",
+		Usage:    []string{"frontmatter run [--dry-run] <preset> <file>..."},
+		Flags:    []helpEntry{dryRunFlagHelp},
+		Examples: []string{"frontmatter run publish file.md"},
+	},
+	{
+		Name:    "help",
+		Summary: "Show help for a command",
+		Usage:   []string{"frontmatter help [command]"},
+	},
+	{
+		Name:    "version",
+		Summary: "Print version and build information",
+		Usage:   []string{"frontmatter version [--json]"},
+		Flags:   []helpEntry{{"--json", "print build information as JSON"}},
+	},
 }
 
-func serializeFrontmatter(data map[string]any) (string, error) {
-	if len(data) == 0 {
-		return "", nil
+// findCommand returns the help of the named command, or nil if there is none
+func findCommand(name string) *commandHelp {
+	for i := range commands {
+		if commands[i].Name == name {
+			return &commands[i]
+		}
 	}
+	return nil
+}
 
-	yamlBytes, err := yaml.MarshalWithOptions(data,
-		yaml.Indent(2),
-		yaml.UseLiteralStyleIfMultiline(true),
-	)
-	if err != nil {
-		return "", fmt.Errorf("failed to serialize YAML: %w", err)
+// wantsHelp reports whether --help or -h is among a command's arguments
+func wantsHelp(args []string) bool {
+	for _, arg := range args {
+		if arg == "--help" || arg == "-h" {
+			return true
+		}
 	}
-
-	result := string(yamlBytes)
-	
-	// Unquote date-only strings (YYYY-MM-DD format)
-	// This is a targeted fix for a specific formatting requirement
-	result = unquoteDateOnlyStrings(result)
-	
-	return result, nil
+	return false
 }
 
-// unquoteDateOnlyStrings removes quotes from date-only values (YYYY-MM-DD)
-// while keeping timestamps and other quoted strings intact
-func unquoteDateOnlyStrings(yamlStr string) string {
-	lines := strings.Split(yamlStr, "\n")
-	for i, line := range lines {
-		// Match pattern: key: "YYYY-MM-DD"
-		prefix, after, found := strings.Cut(line, ": \"")
-		if !found {
-			continue
-		}
-		
-		value, suffix, found := strings.Cut(after, "\"")
-		if !found {
-			continue
-		}
-		
-		if isDateOnlyString(value) {
-			lines[i] = prefix + ": " + value + suffix
-		}
+func printUsage() {
+	fmt.Println("Usage: frontmatter <command> [--dry-run] [flags] <file|dir>...")
+	fmt.Println()
+	fmt.Println("Commands:")
+	for _, command := range commands {
+		fmt.Printf("  %-10s %s\n", command.Name, command.Summary)
 	}
-	return strings.Join(lines, "\n")
+	fmt.Println()
+	fmt.Println("Global flags:")
+	printHelpEntries([]helpEntry{
+		dryRunFlagHelp,
+		{"--no-cache", "parse every file instead of using the parse cache"},
+		{"--format yaml-file", "treat every file as a YAML document without --- fences"},
+		{"--locale <list>", "also read month names in these locales in dates, e.g. pl,de"},
+		{"--git-commit", "stage and commit the files the command modified"},
+		{"-m <template>", "commit message for --git-commit; {command}, {keys} and {files} are filled in"},
+	})
+	fmt.Println()
+	fmt.Println("Run 'frontmatter help <command>' or 'frontmatter <command> --help' for flags, examples and exit codes.")
 }
 
-// isDateOnlyString checks if a string matches YYYY-MM-DD format
-func isDateOnlyString(value string) bool {
-	if len(value) != 10 || value[4] != '-' || value[7] != '-' {
-		return false
+func printCommandHelp(command *commandHelp) {
+	fmt.Printf("%s\n\nUsage:\n", command.Summary)
+	for _, usage := range command.Usage {
+		fmt.Printf("  %s\n", usage)
 	}
-	
-	for i, c := range value {
-		if i == 4 || i == 7 {
-			continue // Already checked dashes
-		}
-		if c < '0' || c > '9' {
-			return false
+	if len(command.Flags) > 0 {
+		fmt.Println("\nFlags:")
+		printHelpEntries(command.Flags)
+	}
+	if len(command.Examples) > 0 {
+		fmt.Println("\nExamples:")
+		for _, example := range command.Examples {
+			fmt.Printf("  %s\n", example)
 		}
 	}
-	return true
+	exitCodes := command.ExitCodes
+	if exitCodes == nil {
+		exitCodes = defaultExitCodes
+	}
+	fmt.Println("\nExit codes:")
+	printHelpEntries(exitCodes)
 }
 
-func writeFileContent(filePath, fmString, bodyString string, dryRun bool) error {
-	var finalContent strings.Builder
-	hasFrontmatter := strings.TrimSpace(fmString) != ""
-
-	if hasFrontmatter {
-		finalContent.WriteString(frontmatterSeparator)
-		finalContent.WriteString("\n")
-		finalContent.WriteString(fmString)
-		// Ensure frontmatter ends with a newline if it's not empty and doesn't have one
-		if !strings.HasSuffix(fmString, "\n") && len(fmString) > 0 {
-			finalContent.WriteString("\n")
-		}
-		finalContent.WriteString(frontmatterSeparator)
-		finalContent.WriteString("\n")
+// printHelpEntries prints name/description pairs with the descriptions aligned
+func printHelpEntries(entries []helpEntry) {
+	width := 0
+	for _, entry := range entries {
+		width = max(width, len(entry.Name))
 	}
+	for _, entry := range entries {
+		fmt.Printf("  %-*s  %s\n", width, entry.Name, entry.Description)
+	}
+}
 
-	finalContent.WriteString(bodyString)
-
-	if dryRun {
-		fmt.Print(finalContent.String())
+func handleHelp(args []string) error {
+	if len(args) == 0 {
+		printUsage()
 		return nil
 	}
-
-	return os.WriteFile(filePath, []byte(finalContent.String()), 0644)
+	command := findCommand(args[0])
+	if command == nil {
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+	printCommandHelp(command)
+	return nil
 }
 
-func handleGet(args []string) error {
-	if len(args) < 1 {
-		return fmt.Errorf("no file specified for get")
-	}
+// version is set at build time with -ldflags "-X main.version=v1.2.0"; when empty
+// the module version recorded by the Go toolchain is used
+var version = ""
 
-	filePath := args[len(args)-1]
-	keys := args[:len(args)-1]
+// BuildInfo describes the running binary for `frontmatter version`
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Commit    string `json:"commit,omitempty"`
+	CommitAt  string `json:"commit_time,omitempty"`
+	Modified  bool   `json:"modified"`
+	Platform  string `json:"platform"`
+}
 
-	// Use optimized reading
-	info, err := readFrontmatterInfo(filePath)
-	if err != nil {
-		return err
+// readBuildInfo collects version and VCS details embedded by the Go toolchain
+func readBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   version,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
 	}
-
-	if !info.HasFM || strings.TrimSpace(info.Content) == "" {
-		// No frontmatter found or it's empty - return error code 2 (not found)
-		return &ExitError{Code: 2, Message: "frontmatter not found"}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && build.Main.Version != "" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = setting.Value
+			case "vcs.time":
+				info.CommitAt = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
 	}
+	if info.Version == "" {
+		info.Version = "(devel)"
+	}
+	return info
+}
 
-	data, err := parseFrontmatter(info.Content)
+func handleVersion(args []string) error {
+	flags, args, err := parseCommandFlags(args, []string{"json"}, nil)
 	if err != nil {
 		return err
 	}
+	if len(args) > 0 {
+		return fmt.Errorf("version takes no arguments")
+	}
 
-	if len(keys) == 0 {
-		// Get all frontmatter using the same serializer as write paths
-		fmString, err := serializeFrontmatter(data)
-		if err != nil {
-			return fmt.Errorf("failed to serialize data for get all: %w", err)
+	info := readBuildInfo()
+	if flags.has("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(info); err != nil {
+			return fmt.Errorf("failed to encode build info: %w", err)
 		}
-		fmt.Print(fmString)
 		return nil
 	}
 
-	// Get specific key(s)
-	// For simplicity, this implementation will handle one key. Multiple keys could return a map.
-	key := keys[0]
-	value, found := getValueByPath(data, key)
-	if !found {
-		// Key not found - return error code 2 (not found)
-		return &ExitError{Code: 2, Message: "field not found"}
-	}
-
-	// If value is a map or slice, YAML marshal it. Otherwise, print directly.
-	switch v := value.(type) {
-	case map[string]any, []any, map[any]any:
-		yamlBytes, err := yaml.Marshal(v)
-		if err != nil {
-			return fmt.Errorf("failed to marshal value for key '%s': %w", key, err)
+	fmt.Printf("frontmatter %s (%s, %s)\n", info.Version, info.GoVersion, info.Platform)
+	if info.Commit != "" {
+		modified := ""
+		if info.Modified {
+			modified = ", modified"
 		}
-		fmt.Print(string(yamlBytes))
-	default:
-		fmt.Println(v)
+		fmt.Printf("commit %s (%s%s)\n", info.Commit, info.CommitAt, modified)
 	}
-
 	return nil
 }
 
-func handleSet(args []string, dryRun bool) error {
+func handleRun(args []string, dryRun bool) error {
 	if len(args) < 2 {
-		return fmt.Errorf("at least one key=value pair and a file must be specified for set")
+		return fmt.Errorf("run needs a preset name and at least one file")
 	}
+	name, paths := args[0], args[1:]
 
-	filePath := args[len(args)-1]
-	setArgs := args[:len(args)-1]
-
-	// Use optimized reading
-	info, err := readFrontmatterInfo(filePath)
+	config, err := loadConfig()
 	if err != nil {
 		return err
 	}
-
-	data, err := parseFrontmatter(info.Content)
-	if err != nil {
-		// If frontmatter is malformed, we might want to overwrite or error out.
-		// For now, let's try to proceed with an empty map if parsing fails, effectively overwriting.
-		// A stricter approach would be: return fmt.Errorf("failed to parse existing frontmatter: %w", err)
-		fmt.Fprintf(os.Stderr, "Warning: could not parse existing frontmatter, new values will overwrite or be added to a new frontmatter block: %v\n", err)
-		data = make(map[string]any)
+	steps, ok := config.Presets[name]
+	if !ok {
+		return fmt.Errorf("unknown preset: %s", name)
 	}
 
-	for _, kvPair := range setArgs {
-		parts := strings.SplitN(kvPair, "=", 2)
-		if len(parts) != 2 {
-			return fmt.Errorf("invalid key=value format: %s", kvPair)
+	// Expand every step up front so a broken preset fails before any file changes
+	now := time.Now()
+	commandLines := make([][]string, 0, len(steps))
+	for _, step := range steps {
+		words, err := splitCommandLine(step)
+		if err != nil {
+			return fmt.Errorf("preset %s: %w", name, err)
 		}
-		keyPath := parts[0]
-		valueStr := parts[1]
-
-		var parsedValue any
-		// Try to parse value as YAML/JSON scalar types
-		if valInt, err := strconv.ParseInt(valueStr, 10, 64); err == nil {
-			parsedValue = valInt
-		} else if valFloat, err := strconv.ParseFloat(valueStr, 64); err == nil {
-			parsedValue = valFloat
-		} else if valBool, err := strconv.ParseBool(valueStr); err == nil {
-			parsedValue = valBool
-		} else if strings.HasPrefix(valueStr, "[") && strings.HasSuffix(valueStr, "]") ||
-			strings.HasPrefix(valueStr, "{") && strings.HasSuffix(valueStr, "}") {
-			// Attempt to parse as YAML if it looks like a list or map
-			var yamlValue any
-			if err := yaml.Unmarshal([]byte(valueStr), &yamlValue); err == nil {
-				parsedValue = yamlValue
-			} else {
-				// If YAML parsing fails, treat as string
-				parsedValue = strings.Trim(valueStr, "\"") // Trim quotes if it was a quoted string
-			}
-		} else if strings.HasPrefix(valueStr, "{") && strings.HasSuffix(valueStr, "}") {
-			// Attempt to parse JSON-like map first
-			var jsonValue map[string]any
-			if err := json.Unmarshal([]byte(valueStr), &jsonValue); err == nil {
-				parsedValue = jsonValue
-			} else {
-				// Fallback to YAML
-				var yamlValue any
-				if err2 := yaml.Unmarshal([]byte(valueStr), &yamlValue); err2 == nil {
-					parsedValue = yamlValue
-				} else {
-					parsedValue = strings.Trim(valueStr, "\"")
-				}
-			}
-		} else {
-			parsedValue = strings.Trim(valueStr, "\"") // Default to string, trim quotes
+		if len(words) == 0 {
+			return fmt.Errorf("preset %s: empty step", name)
 		}
-
-		if err := setValueByPath(data, keyPath, parsedValue); err != nil {
-			return fmt.Errorf("failed to set value for key '%s': %w", keyPath, err)
+		if words[0] == "run" {
+			return fmt.Errorf("preset %s: steps cannot run other presets", name)
 		}
+		commandLines = append(commandLines, expandPresetPlaceholders(words, now))
 	}
 
-	newFmString, err := serializeFrontmatter(data)
-	if err != nil {
-		return err
-	}
-
-	return writeOptimizedFrontmatter(filePath, newFmString, info, dryRun)
-}
-
-func handleDelete(args []string, dryRun bool) error {
-	if len(args) < 1 {
-		return fmt.Errorf("file path must be specified for delete")
-	}
-
-	filePath := args[len(args)-1]
-	fieldsToDelete := args[:len(args)-1]
-
-	// For delete we use safer method - reading the entire file
-	fmString, bodyString, err := readFileContent(filePath)
-	if err != nil {
-		// If file doesn't exist, nothing to delete.
-		if os.IsNotExist(err) {
+	for _, filePath := range paths {
+		for i, words := range commandLines {
+			stepArgs := append(append([]string{}, words...), filePath)
 			if dryRun {
-				fmt.Print("") // Dry run on non-existent file shows empty output
+				stepArgs = append(stepArgs, "--dry-run")
+			}
+			if err := run(stepArgs); err != nil {
+				return fmt.Errorf("preset %s, step %q on %s: %w", name, steps[i], filePath, err)
 			}
-			return nil
 		}
-		return err
 	}
+	return nil
+}
 
-	if strings.TrimSpace(fmString) == "" {
-		// No frontmatter to delete
-		if dryRun {
-			fmt.Print(bodyString)
-		} else {
-			return writeFileContent(filePath, "", bodyString, false)
+// splitCommandLine splits a preset step into words; single and double quotes
+// group words containing spaces
+func splitCommandLine(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
 		}
-		return nil
 	}
-
-	// If no fields specified, delete entire frontmatter
-	if len(fieldsToDelete) == 0 {
-		return writeFileContent(filePath, "", bodyString, dryRun)
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", line)
 	}
-
-	// Parse existing frontmatter
-	data, err := parseFrontmatter(fmString)
-	if err != nil {
-		return fmt.Errorf("failed to parse existing frontmatter: %w", err)
+	if inWord {
+		words = append(words, word.String())
 	}
+	return words, nil
+}
 
-	// Delete specified fields
-	for _, fieldPath := range fieldsToDelete {
-		deleteValueByPath(data, fieldPath)
+// expandPresetPlaceholders replaces @now (RFC 3339 timestamp) and @today (date)
+// in key=value arguments
+func expandPresetPlaceholders(words []string, now time.Time) []string {
+	expanded := make([]string, len(words))
+	for i, word := range words {
+		key, value, found := strings.Cut(word, "=")
+		switch {
+		case found && value == "@now":
+			word = key + "=" + now.Format(time.RFC3339)
+		case found && value == "@today":
+			word = key + "=" + now.Format(time.DateOnly)
+		}
+		expanded[i] = word
 	}
+	return expanded
+}
 
-	// Serialize updated frontmatter
-	newFmString, err := serializeFrontmatter(data)
-	if err != nil {
-		return err
-	}
+// commandFlags holds the --flags extracted from a command's arguments
+type commandFlags map[string][]string
 
-	return writeFileContent(filePath, newFmString, bodyString, dryRun)
+// has reports whether the flag was passed at least once
+func (f commandFlags) has(name string) bool {
+	_, ok := f[name]
+	return ok
 }
 
-// readFrontmatterInfo reads only the frontmatter section and returns position info
-func readFrontmatterInfo(filePath string) (*FrontmatterInfo, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return &FrontmatterInfo{Content: "", StartPos: 0, EndPos: 0, HasFM: false}, nil
-		}
-		return nil, fmt.Errorf("failed to open file: %w", err)
+// get returns the last value given for the flag, or fallback if it was not passed
+func (f commandFlags) get(name, fallback string) string {
+	values, ok := f[name]
+	if !ok || len(values) == 0 {
+		return fallback
 	}
-	defer file.Close()
+	return values[len(values)-1]
+}
 
-	reader := bufio.NewReader(file)
-	var frontmatterContent strings.Builder
-	var bytesRead int64
-	separatorCount := 0
+// jsonOutput reports whether --output asks for JSON; --json is short for --output json
+func jsonOutput(flags commandFlags) (bool, error) {
+	switch output := flags.get("output", "text"); output {
+	case "json":
+		return true, nil
+	case "text":
+		return flags.has("json"), nil
+	default:
+		return false, fmt.Errorf("invalid --output value %q: expected json or text", output)
+	}
+}
 
-	for {
-		line, err := reader.ReadString('\n')
-		bytesRead += int64(len(line))
+// parseCommandFlags separates --flags from positional arguments.
+// Flags listed in valueFlags take a value (--flag value or --flag=value), boolFlags take none.
+func parseCommandFlags(args, boolFlags, valueFlags []string) (commandFlags, []string, error) {
+	flags := commandFlags{}
+	positional := []string{}
 
-		if err != nil && err != io.EOF {
-			return nil, fmt.Errorf("failed to read file: %w", err)
-		}
+	isBool := make(map[string]bool)
+	for _, name := range boolFlags {
+		isBool[name] = true
+	}
+	isValue := make(map[string]bool)
+	for _, name := range valueFlags {
+		isValue[name] = true
+	}
 
-		trimmed := strings.TrimSpace(line)
-		if trimmed == frontmatterSeparator && separatorCount < 2 {
-			separatorCount++
-			if separatorCount == 2 {
-				// Found end of frontmatter
-				return &FrontmatterInfo{
-					Content:  frontmatterContent.String(),
-					StartPos: 0,
-					EndPos:   bytesRead,
-					HasFM:    true,
-				}, nil
-			}
-			if err == io.EOF {
-				break
-			}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "--") || arg == "--" {
+			positional = append(positional, arg)
 			continue
 		}
 
-		if separatorCount == 1 {
-			frontmatterContent.WriteString(line)
-		} else if separatorCount == 0 {
-			// No frontmatter at the beginning
-			if err == io.EOF || bytesRead > 1024 { // Check only first 1KB
-				return &FrontmatterInfo{Content: "", StartPos: 0, EndPos: 0, HasFM: false}, nil
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		switch {
+		case isBool[name] && !hasValue:
+			flags[name] = append(flags[name], "")
+		case isValue[name] && hasValue:
+			flags[name] = append(flags[name], value)
+		case isValue[name]:
+			if i+1 >= len(args) {
+				return nil, nil, fmt.Errorf("flag --%s requires a value", name)
 			}
+			i++
+			flags[name] = append(flags[name], args[i])
+		default:
+			return nil, nil, fmt.Errorf("unknown flag: %s", arg)
 		}
+	}
 
-		if err == io.EOF {
-			break
+	return flags, positional, nil
+}
+
+func readFileContent(filePath string) (string, string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// If file doesn't exist, treat as empty frontmatter and no body
+			return "", "", nil
 		}
+		return "", "", fmt.Errorf("failed to open file: %w", err)
 	}
+	defer file.Close()
 
-	// Incomplete frontmatter or none
-	return &FrontmatterInfo{Content: "", StartPos: 0, EndPos: 0, HasFM: false}, nil
+	if isYAMLFile(filePath) {
+		content, err := io.ReadAll(file)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read file: %w", err)
+		}
+		return string(content), "", nil
+	}
+	fmString, body, format, err := scanFrontmatter(bufio.NewReader(file), filePath)
+	if err != nil {
+		return "", "", err
+	}
+	if format != formatYAML {
+		fileFormats[filePath] = format
+	}
+	return fmString, body, nil
 }
 
-// readBodyFromPosition reads file content from a specific position to the end
-func readBodyFromPosition(filePath string, startPos int64) (string, error) {
+// readFrontmatterBlock returns only the frontmatter of filePath. It shares
+// scanFrontmatterBlock with readFileContent but never reads the body: the scan stops at
+// the closing fence, or after the first line when that does not open a block.
+func readFrontmatterBlock(filePath string) (string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
 		return "", fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	// Seek to position after frontmatter
-	if _, err := file.Seek(startPos, 0); err != nil {
-		return "", fmt.Errorf("failed to seek to position %d: %w", startPos, err)
+	if isYAMLFile(filePath) {
+		content, err := io.ReadAll(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+		return string(content), nil
 	}
-
-	// Read the rest of the file
-	bodyBytes, err := io.ReadAll(file)
-	if err != nil {
-		return "", fmt.Errorf("failed to read body content: %w", err)
+	content, _, format, closed, err := scanFrontmatterBlock(bufio.NewReader(file), filePath)
+	if err != nil || !closed {
+		return "", err
 	}
+	if format != formatYAML {
+		fileFormats[filePath] = format
+	}
+	return content, nil
+}
 
-	return string(bodyBytes), nil
+// parseCacheEntry is the parsed frontmatter of one file with what identifies its content
+type parseCacheEntry struct {
+	Size     int64
+	ModTime  int64
+	Hash     [sha256.Size]byte
+	Decimals string
+	YAMLFile bool // parsed as a whole YAML document, as with --format yaml-file
+	Data     map[string]any
 }
 
-// writeOptimizedFrontmatter writes frontmatter using optimized strategy
-func writeOptimizedFrontmatter(filePath, newFmString string, info *FrontmatterInfo, dryRun bool) error {
-	if dryRun {
-		return writeFileContentForDryRun(filePath, newFmString, info)
-	}
+// parseCache maps absolute file paths to their parsed frontmatter. It is loaded from
+// the project's cache directory on first use and written back by saveParseCache.
+type parseCache struct {
+	path    string
+	entries map[string]*parseCacheEntry
+	dirty   bool
+}
 
-	// For safety, always use complete file rewriting
-	// In-place editing is risky and can damage data
-	return writeFileContentSafe(filePath, newFmString, info)
+func init() {
+	// Frontmatter values nest maps and lists inside interface values
+	gob.Register(map[string]any{})
+	gob.Register([]any{})
+	gob.Register(decimal(""))
 }
 
-// writeFileContentForDryRun handles dry-run output efficiently
-func writeFileContentForDryRun(filePath, newFmString string, info *FrontmatterInfo) error {
-	var finalContent strings.Builder
-	hasFrontmatter := strings.TrimSpace(newFmString) != ""
+// frontmatterCache is the parse cache of the current run, nil until first used
+var frontmatterCache *parseCache
+
+// parseCacheDisabled is set by --no-cache to bypass the cache entirely
+var parseCacheDisabled bool
 
-	if hasFrontmatter {
-		finalContent.WriteString(frontmatterSeparator)
-		finalContent.WriteString("\n")
-		finalContent.WriteString(newFmString)
-		if !strings.HasSuffix(newFmString, "\n") && len(newFmString) > 0 {
-			finalContent.WriteString("\n")
+// racyWindow is how recent a modification time must be for size and mtime alone
+// not to be trusted, since a file can change again within the same timestamp
+const racyWindow = 2 * time.Second
+
+// openParseCache loads the cache of the project, starting empty when it is missing or unreadable
+func openParseCache() *parseCache {
+	if frontmatterCache != nil {
+		return frontmatterCache
+	}
+	frontmatterCache = &parseCache{entries: make(map[string]*parseCacheEntry)}
+	if parseCacheDisabled {
+		return frontmatterCache
+	}
+	rootDir, err := projectRootDir()
+	if err != nil {
+		return frontmatterCache
+	}
+	frontmatterCache.path = filepath.Join(rootDir, cacheDirName, parseCacheFileName)
+	if file, err := os.Open(frontmatterCache.path); err == nil {
+		defer file.Close()
+		var entries map[string]*parseCacheEntry
+		if gob.NewDecoder(bufio.NewReader(file)).Decode(&entries) == nil {
+			frontmatterCache.entries = entries
 		}
-		finalContent.WriteString(frontmatterSeparator)
-		finalContent.WriteString("\n")
 	}
+	return frontmatterCache
+}
 
-	// Add body content if it exists
-	if info.HasFM && info.EndPos > 0 {
-		bodyContent, err := readBodyFromPosition(filePath, info.EndPos)
-		if err != nil {
-			return err
-		}
-		finalContent.WriteString(bodyContent)
-	} else if !info.HasFM {
-		// Entire file is body
-		content, err := os.ReadFile(filePath)
-		if err != nil && !os.IsNotExist(err) {
-			return err
-		}
-		if err == nil {
-			finalContent.WriteString(string(content))
-		}
+// makeCacheDir creates the cache directory holding path. The directory ignores itself
+// in git, so that runs leave no untracked files behind in a repository.
+func makeCacheDir(path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	ignorePath := filepath.Join(dir, ".gitignore")
+	if _, err := os.Stat(ignorePath); !os.IsNotExist(err) {
+		return err
 	}
+	return os.WriteFile(ignorePath, []byte("*\n"), 0644)
+}
 
-	fmt.Print(finalContent.String())
-	return nil
+// saveParseCache writes the cache back if this run changed it. Failures are ignored:
+// the cache only saves work and is rebuilt on the next run.
+func saveParseCache() {
+	cache := frontmatterCache
+	if cache == nil || !cache.dirty || cache.path == "" {
+		return
+	}
+	if err := makeCacheDir(cache.path); err != nil {
+		return
+	}
+	tempFile := cache.path + ".tmp"
+	file, err := os.Create(tempFile)
+	if err != nil {
+		return
+	}
+	writer := bufio.NewWriter(file)
+	err = gob.NewEncoder(writer).Encode(cache.entries)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || renameFile(tempFile, cache.path) != nil {
+		os.Remove(tempFile)
+		return
+	}
+	cache.dirty = false
 }
 
-// writeFileContentSafe safely rewrites the entire file (fallback method)
-func writeFileContentSafe(filePath, newFmString string, info *FrontmatterInfo) error {
-	var finalContent strings.Builder
-	hasFrontmatter := strings.TrimSpace(newFmString) != ""
+// readFrontmatterData returns the parsed frontmatter of filePath, skipping the read when
+// size and mtime match the cache and the parse when the block's hash does. Callers
+// must not modify the returned map.
+func readFrontmatterData(filePath string) (map[string]any, error) {
+	cache := openParseCache()
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	key, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", filePath, err)
+	}
 
-	if hasFrontmatter {
-		finalContent.WriteString(frontmatterSeparator)
-		finalContent.WriteString("\n")
-		finalContent.WriteString(newFmString)
-		if !strings.HasSuffix(newFmString, "\n") && len(newFmString) > 0 {
-			finalContent.WriteString("\n")
-		}
-		finalContent.WriteString(frontmatterSeparator)
-		finalContent.WriteString("\n")
+	// Entries parsed with another decimals list typed those keys differently, and ones
+	// parsed in the other file mode hold a different part of the file
+	decimals := strings.Join(activeDecimalKeys(), ",")
+	yamlFile := isYAMLFile(filePath)
+	modTime := stat.ModTime().UnixNano()
+	entry := cache.entries[key]
+	if entry != nil && (entry.Decimals != decimals || entry.YAMLFile != yamlFile) {
+		entry = nil
+	}
+	if entry != nil && entry.Size == stat.Size() && entry.ModTime == modTime && time.Since(stat.ModTime()) > racyWindow {
+		return entry.Data, nil
 	}
 
-	// Add body content if it exists
-	if info.HasFM && info.EndPos > 0 {
-		bodyContent, err := readBodyFromPosition(filePath, info.EndPos)
+	fmString, err := readFrontmatterBlock(filePath)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(fmString))
+	if entry == nil || entry.Hash != hash {
+		data, err := parseFrontmatter(fmString)
 		if err != nil {
-			return err
-		}
-		finalContent.WriteString(bodyContent)
-	} else if !info.HasFM {
-		// Entire file is body - read it completely
-		content, err := os.ReadFile(filePath)
-		if err != nil && !os.IsNotExist(err) {
-			return err
-		}
-		if err == nil {
-			finalContent.WriteString(string(content))
+			if cache.entries[key] != nil {
+				delete(cache.entries, key)
+				cache.dirty = true
+			}
+			return nil, err
 		}
+		entry = &parseCacheEntry{Hash: hash, Decimals: decimals, YAMLFile: yamlFile, Data: data}
+		cache.entries[key] = entry
 	}
-
-	// Safe write: use temporary file
-	tempFile := filePath + ".tmp"
-	if err := os.WriteFile(tempFile, []byte(finalContent.String()), 0644); err != nil {
-		return fmt.Errorf("failed to write temporary file: %w", err)
+	if entry.Size != stat.Size() || entry.ModTime != modTime {
+		entry.Size, entry.ModTime = stat.Size(), modTime
+		cache.dirty = true
 	}
+	return entry.Data, nil
+}
 
-	// Atomic move
-	if err := os.Rename(tempFile, filePath); err != nil {
-		os.Remove(tempFile) // Clean up on error
-		return fmt.Errorf("failed to rename temporary file: %w", err)
+// frontmatterFormat is the syntax of a frontmatter block. YAML blocks sit between ---
+// lines, or end with a ... line as Pandoc allows, and may be wrapped in an HTML comment.
+// TOML blocks sit between +++ lines (as in Hugo) and JSON blocks are an object whose
+// braces stand on lines of their own.
+type frontmatterFormat int
+
+const (
+	formatYAML frontmatterFormat = iota
+	formatTOML
+	formatJSON
+	formatPandoc
+	formatComment
+	formatInlineComment
+)
+
+// Frontmatter may hide in an HTML comment so it does not render: the --- fences stand
+// on lines of their own inside the comment (formatComment) or share a line with the
+// comment markers as in "<!-- ---" and "--- -->" (formatInlineComment)
+const (
+	commentOpen  = "<!--"
+	commentClose = "-->"
+)
+
+// tomlSeparator delimits TOML frontmatter
+const tomlSeparator = "+++"
+
+// pandocTerminator may close a YAML block instead of a second ---, as in Pandoc
+const pandocTerminator = "..."
+
+// closesYAMLBlock reports whether a line ends a YAML block, and in which format.
+// Only an unindented ... counts, so that one inside a block scalar stays content.
+func closesYAMLBlock(line string) (frontmatterFormat, bool) {
+	if strings.TrimSpace(line) == frontmatterSeparator {
+		return formatYAML, true
 	}
+	if strings.TrimRight(line, " \t\r\n") == pandocTerminator {
+		return formatPandoc, true
+	}
+	return formatYAML, false
+}
 
-	return nil
+func (f frontmatterFormat) String() string {
+	switch f {
+	case formatTOML:
+		return "TOML"
+	case formatJSON:
+		return "JSON"
+	default:
+		return "YAML"
+	}
 }
 
-// setValueByPath sets a value in a nested map structure based on a dot-separated path.
-func setValueByPath(data map[string]any, path string, value any) error {
-	parts := strings.Split(path, ".")
-	currentMap := data
+// yamlFileMode is set by --format yaml-file to treat every file as a YAML document
+var yamlFileMode bool
 
-	for i, part := range parts {
-		if i == len(parts)-1 {
-			// Last part, set the value
-			currentMap[part] = value
-		} else {
-			// Navigate or create nested map
-			if _, ok := currentMap[part]; !ok {
-				currentMap[part] = make(map[string]any)
-			}
-			nestedMap, ok := currentMap[part].(map[string]any)
-			if !ok {
-				// Path conflict: part exists but is not a map.
-				// Overwrite with a new map to continue, or return an error.
-				// For simplicity, let's overwrite.
-				// return fmt.Errorf("path conflict: '%s' in '%s' is not a map", part, path)
-				newMap := make(map[string]any)
-				currentMap[part] = newMap
-				nestedMap = newMap
-			}
-			currentMap = nestedMap
-		}
+// isYAMLFile reports whether filePath is a YAML data file, which is all frontmatter:
+// it has no --- fences and no body
+func isYAMLFile(filePath string) bool {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".yaml", ".yml":
+		return true
 	}
-	return nil
+	return yamlFileMode
 }
 
-// getValueByPath retrieves a value from a nested map structure based on a dot-separated path.
-func getValueByPath(data map[string]any, path string) (any, bool) {
-	parts := strings.Split(path, ".")
-	var currentValue any = data
+// fileFormats records the format of every file read with TOML, JSON, Pandoc-terminated
+// or comment-wrapped frontmatter, so writes put the block back in that format. Files not
+// listed are YAML.
+var fileFormats = make(map[string]frontmatterFormat)
 
-	for _, part := range parts {
-		currentMap, ok := currentValue.(map[string]any)
-		if !ok {
-			// If at any point the path does not lead to a map, the key is not found as specified.
-			return nil, false
-		}
-		value, found := currentMap[part]
-		if !found {
-			return nil, false
+// detectFormat peeks at the first lines of reader to tell whether the file opens with
+// a TOML, JSON or HTML comment block. Anything else is handled by the YAML rules.
+func detectFormat(reader *bufio.Reader) frontmatterFormat {
+	peeked, _ := reader.Peek(64)
+	line, rest, _ := strings.Cut(string(peeked), "\n")
+	line = strings.TrimSpace(line)
+	if afterOpen, found := strings.CutPrefix(line, commentOpen); found {
+		next, _, _ := strings.Cut(rest, "\n")
+		switch {
+		case strings.TrimSpace(afterOpen) == frontmatterSeparator:
+			return formatInlineComment
+		case strings.TrimSpace(afterOpen) == "" && strings.TrimSpace(next) == frontmatterSeparator:
+			return formatComment
 		}
-		currentValue = value
 	}
-	return currentValue, true
+	switch line {
+	case tomlSeparator:
+		return formatTOML
+	case "{":
+		return formatJSON
+	default:
+		return formatYAML
+	}
 }
 
-// deleteValueByPath removes a value from a nested map structure based on a dot-separated path.
-func deleteValueByPath(data map[string]any, path string) bool {
-	parts := strings.Split(path, ".")
-
-	// If there's only one part, delete directly from the root map
-	if len(parts) == 1 {
-		_, existed := data[parts[0]]
-		delete(data, parts[0])
-		return existed
-	}
+// scanFormattedBlock reads the TOML, JSON or HTML comment block at the start of reader.
+// Other commands work on YAML, so the block is returned converted to YAML, together with
+// the raw text it took up. closed is false when the input ends before the block does.
+// filePath names the file being read, or is empty for content that is not written back.
+func scanFormattedBlock(reader *bufio.Reader, filePath string, format frontmatterFormat) (content, raw string, closed bool, err error) {
+	var rawText, block strings.Builder
+	awaitingClose := false
+	for lineNumber := 0; ; lineNumber++ {
+		line, readErr := reader.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return "", "", false, fmt.Errorf("failed to read file: %w", readErr)
+		}
+		rawText.WriteString(line)
+		trimmed := strings.TrimSpace(line)
 
-	// Navigate to the parent of the field to delete
-	var currentValue any = data
-	for _, part := range parts[:len(parts)-1] {
-		currentMap, ok := currentValue.(map[string]any)
-		if !ok {
-			// Path doesn't exist, nothing to delete
-			return false
+		switch {
+		case format == formatComment && lineNumber < 2, format == formatInlineComment && lineNumber == 0:
+			// The comment opener and the opening fence
+		case format == formatComment && awaitingClose:
+			if trimmed != commentClose {
+				// A --- line inside a comment that goes on is no frontmatter block
+				return "", rawText.String(), false, nil
+			}
+			closed = true
+		case format == formatComment || format == formatInlineComment:
+			if fence, found := strings.CutSuffix(trimmed, commentClose); found && format == formatInlineComment && strings.TrimSpace(fence) == frontmatterSeparator {
+				closed = true
+			} else if format == formatComment && trimmed == frontmatterSeparator {
+				awaitingClose = true
+			} else {
+				block.WriteString(line)
+			}
+		case format == formatTOML && lineNumber == 0:
+		case format == formatTOML:
+			closed = strings.TrimSpace(line) == tomlSeparator
+			if !closed {
+				block.WriteString(line)
+			}
+		default:
+			// A closing brace at the start of a line ends the object once it parses
+			block.WriteString(line)
+			closed = lineNumber > 0 && strings.TrimRight(line, " \t\r\n") == "}" && json.Valid([]byte(block.String()))
+		}
+
+		if closed && (format == formatComment || format == formatInlineComment) {
+			return block.String(), rawText.String(), true, nil
+		}
+		if closed {
+			content, err := formattedToYAML(filePath, format, block.String())
+			if err != nil {
+				return "", "", false, fmt.Errorf("invalid %s frontmatter: %w", format, err)
+			}
+			return content, rawText.String(), true, nil
+		}
+		if readErr == io.EOF {
+			return "", rawText.String(), false, nil
+		}
+	}
+}
+
+// formattedToYAML converts the content of a TOML or JSON block to YAML. For TOML, the
+// strings of filePath that look like dates are recorded in tomlStringDates.
+func formattedToYAML(filePath string, format frontmatterFormat, content string) (string, error) {
+	var data map[string]any
+	if format == formatTOML {
+		parsed, stringDates, err := parseTOML(content)
+		if err != nil {
+			return "", err
+		}
+		if filePath != "" {
+			tomlStringDates[filePath] = stringDates
+		}
+		data = parsed
+	} else {
+		decoder := json.NewDecoder(strings.NewReader(content))
+		decoder.UseNumber()
+		if err := decoder.Decode(&data); err != nil {
+			return "", err
+		}
+		data, _ = normalizeJSONValue(data).(map[string]any)
+	}
+	if len(data) == 0 {
+		return "", nil
+	}
+	return serializeFrontmatter(data)
+}
+
+// frontmatterBlock returns serialized YAML frontmatter with the delimiters of filePath's
+// format, converted to TOML or JSON for files read in those formats, and without
+// delimiters for YAML files. Empty frontmatter yields no block at all.
+func frontmatterBlock(filePath, fmString string) (string, error) {
+	if strings.TrimSpace(fmString) == "" {
+		return "", nil
+	}
+	if isYAMLFile(filePath) {
+		return fmString, nil
+	}
+	format := fileFormats[filePath]
+	if format == formatYAML || format == formatPandoc {
+		if !strings.HasSuffix(fmString, "\n") {
+			fmString += "\n"
+		}
+		closing := frontmatterSeparator
+		if format == formatPandoc {
+			closing = pandocTerminator
+		}
+		return frontmatterSeparator + "\n" + fmString + closing + "\n", nil
+	}
+	if !strings.HasSuffix(fmString, "\n") {
+		fmString += "\n"
+	}
+	switch format {
+	case formatComment:
+		return commentOpen + "\n" + frontmatterSeparator + "\n" + fmString + frontmatterSeparator + "\n" + commentClose + "\n", nil
+	case formatInlineComment:
+		return commentOpen + " " + frontmatterSeparator + "\n" + fmString + frontmatterSeparator + " " + commentClose + "\n", nil
+	}
+
+	data, err := parseFrontmatter(fmString)
+	if err != nil {
+		return "", err
+	}
+	if format == formatTOML {
+		content, err := encodeTOML(data, tomlStringDates[filePath])
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", filePath, err)
+		}
+		return tomlSeparator + "\n" + content + tomlSeparator + "\n", nil
+	}
+	var content strings.Builder
+	encoder := json.NewEncoder(&content)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		return "", fmt.Errorf("%s: failed to encode JSON frontmatter: %w", filePath, err)
+	}
+	return content.String(), nil
+}
+
+// tomlStringDate is a string of a TOML file that looks like a date: its key path, with
+// [] standing for any list element, and its text. List elements are not told apart by
+// index so that inserting or removing elements leaves the record valid.
+type tomlStringDate struct {
+	path string
+	text string
+}
+
+// tomlStringDates holds, per TOML file, the strings that look like dates. Writing the
+// file back keeps them strings instead of turning them into TOML dates.
+var tomlStringDates = make(map[string]map[tomlStringDate]bool)
+
+// parseTOML decodes a TOML block. Dates and times become their text, like the dates
+// of YAML frontmatter; the strings that merely look like one are returned separately.
+func parseTOML(content string) (map[string]any, map[tomlStringDate]bool, error) {
+	var decoded map[string]any
+	if _, err := toml.Decode(content, &decoded); err != nil {
+		return nil, nil, err
+	}
+	stringDates := make(map[tomlStringDate]bool)
+	data, _ := normalizeTOMLValue(decoded, "", stringDates).(map[string]any)
+	if data == nil {
+		data = make(map[string]any)
+	}
+	return data, stringDates, nil
+}
+
+// normalizeTOMLValue turns decoded TOML into frontmatter values: arrays of tables into
+// lists of maps and dates into text, recording date-like strings under path at
+func normalizeTOMLValue(value any, at string, stringDates map[tomlStringDate]bool) any {
+	switch v := value.(type) {
+	case string:
+		if isTOMLDateLike(v) {
+			stringDates[tomlStringDate{at, v}] = true
+		}
+		return v
+	case time.Time:
+		return formatTOMLTime(v)
+	case map[string]any:
+		for key, element := range v {
+			v[key] = normalizeTOMLValue(element, tomlPathKey(at, key), stringDates)
+		}
+		return v
+	case []map[string]any:
+		list := make([]any, len(v))
+		for i, element := range v {
+			list[i] = normalizeTOMLValue(element, at+"[]", stringDates)
+		}
+		return list
+	case []any:
+		for i, element := range v {
+			v[i] = normalizeTOMLValue(element, at+"[]", stringDates)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// tomlPathKey extends the key path at by key
+func tomlPathKey(at, key string) string {
+	if at == "" {
+		return key
+	}
+	return at + "." + key
+}
+
+// formatTOMLTime returns the text of a decoded TOML date, time or date-time. The
+// decoder tells the local kinds apart by their zone, which only its encoder reads.
+func formatTOMLTime(t time.Time) string {
+	var output strings.Builder
+	if err := toml.NewEncoder(&output).Encode(map[string]time.Time{"v": t}); err != nil {
+		return t.Format(time.RFC3339Nano)
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(output.String(), "v = "), "\n")
+}
+
+// isTOMLDateLike reports whether a string is written as a TOML date unless it was a
+// string in the file already, matching how date-only strings are left unquoted in YAML.
+// Only text that reads back unchanged counts, so nothing else ends up unquoted.
+func isTOMLDateLike(s string) bool {
+	if len(s) < len("00:00:00") || s[0] < '0' || s[0] > '9' {
+		return false
+	}
+	var probe map[string]any
+	if _, err := toml.Decode("v = "+s, &probe); err != nil {
+		return false
+	}
+	t, ok := probe["v"].(time.Time)
+	return ok && formatTOMLTime(t) == s
+}
+
+// tomlDate is a string written back as a TOML date, time or date-time
+type tomlDate string
+
+// MarshalTOML writes the date unquoted
+func (d tomlDate) MarshalTOML() ([]byte, error) {
+	return []byte(d), nil
+}
+
+// isTOMLBareKeyChar reports whether c may appear in a bare TOML key
+func isTOMLBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// encodeTOML writes frontmatter as TOML: plain values first, then maps as [tables]
+// and lists of maps as [[arrays of tables]], everything in key order. Strings that look
+// like dates are written as TOML dates unless stringDates lists them.
+func encodeTOML(data map[string]any, stringDates map[tomlStringDate]bool) (string, error) {
+	prepared, err := prepareTOMLValue(data, "", stringDates)
+	if err != nil {
+		return "", err
+	}
+	var output strings.Builder
+	encoder := toml.NewEncoder(&output)
+	encoder.Indent = ""
+	if err := encoder.Encode(prepared); err != nil {
+		return "", err
+	}
+	return output.String(), nil
+}
+
+// prepareTOMLValue turns the date-like strings under value back into TOML dates and
+// refuses null, which TOML has no way to write
+func prepareTOMLValue(value any, at string, stringDates map[tomlStringDate]bool) (any, error) {
+	switch v := value.(type) {
+	case nil:
+		if at == "" {
+			return nil, fmt.Errorf("TOML has no null value")
+		}
+		return nil, fmt.Errorf("%s: TOML has no null value", at)
+	case string:
+		if !stringDates[tomlStringDate{at, v}] && isTOMLDateLike(v) {
+			return tomlDate(v), nil
+		}
+		return v, nil
+	case map[string]any:
+		prepared := make(map[string]any, len(v))
+		for key, element := range v {
+			converted, err := prepareTOMLValue(element, tomlPathKey(at, key), stringDates)
+			if err != nil {
+				return nil, err
+			}
+			prepared[key] = converted
+		}
+		return prepared, nil
+	case []any:
+		prepared := make([]any, len(v))
+		for i, element := range v {
+			converted, err := prepareTOMLValue(element, at+"[]", stringDates)
+			if err != nil {
+				return nil, err
+			}
+			prepared[i] = converted
+		}
+		return prepared, nil
+	default:
+		return value, nil
+	}
+}
+
+// MarshalTOML writes the number as it was read
+func (d decimal) MarshalTOML() ([]byte, error) {
+	return []byte(d), nil
+}
+
+// scanFrontmatter reads a whole document and returns its frontmatter and body, and the
+// format of the frontmatter block
+func scanFrontmatter(reader *bufio.Reader, filePath string) (string, string, frontmatterFormat, error) {
+	content, raw, format, closed, err := scanFrontmatterBlock(reader, filePath)
+	if err != nil {
+		return "", "", formatYAML, err
+	}
+	rest, err := io.ReadAll(reader)
+	if err != nil {
+		return "", "", formatYAML, fmt.Errorf("failed to read file: %w", err)
+	}
+	if !closed {
+		// Without a complete block the entire content is body
+		return "", raw + string(rest), formatYAML, nil
+	}
+	return content, string(rest), format, nil
+}
+
+// scanFrontmatterBlock reads the frontmatter block at the start of reader and leaves
+// the reader at the body. It returns the block as YAML, the raw text it read and the
+// block's format; closed is false when the input does not open with a complete block.
+func scanFrontmatterBlock(reader *bufio.Reader, filePath string) (content, raw string, format frontmatterFormat, closed bool, err error) {
+	if format := detectFormat(reader); format != formatYAML {
+		content, raw, closed, err := scanFormattedBlock(reader, filePath, format)
+		return content, raw, format, closed, err
+	}
+	var rawText, block strings.Builder
+	for lineNumber := 0; ; lineNumber++ {
+		line, readErr := reader.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return "", "", formatYAML, false, fmt.Errorf("failed to read file: %w", readErr)
+		}
+		rawText.WriteString(line)
+		if lineNumber == 0 {
+			if strings.TrimSpace(line) != frontmatterSeparator {
+				// Files without a block are not read any further
+				return "", rawText.String(), formatYAML, false, nil
+			}
+		} else if closing, closes := closesYAMLBlock(line); closes {
+			return block.String(), rawText.String(), closing, true, nil
+		} else {
+			block.WriteString(line)
+		}
+		if readErr == io.EOF {
+			return "", rawText.String(), formatYAML, false, nil
+		}
+	}
+}
+
+// splitFrontmatter separates frontmatter and body of in-memory content using the same
+// rules as readFileContent
+func splitFrontmatter(content string) (string, string, error) {
+	fmString, body, _, err := scanFrontmatter(bufio.NewReader(strings.NewReader(content)), "")
+	return fmString, body, err
+}
+
+func parseFrontmatter(fmString string) (map[string]any, error) {
+	if strings.TrimSpace(fmString) == "" {
+		return make(map[string]any), nil // Empty frontmatter is valid
+	}
+	if hasConflictMarkers(fmString) {
+		return nil, fmt.Errorf("frontmatter contains git conflict markers; run frontmatter resolve first")
+	}
+	data, err := unmarshalYAMLMap([]byte(fmString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse YAML frontmatter: %w", err)
+	}
+	keepDecimals(fmString, data)
+	return data, nil
+}
+
+// decimal is a number kept as the exact text it was written with. Values of the keys
+// in the config's decimals list are read as decimals, since float64 turns an amount
+// such as 19.90 into 19.9 and cannot hold 0.10 exactly.
+type decimal string
+
+// MarshalYAML writes the number as it was read
+func (d decimal) MarshalYAML() ([]byte, error) {
+	return []byte(d), nil
+}
+
+// MarshalJSON writes the number as it was read, or quoted if it is no JSON number
+func (d decimal) MarshalJSON() ([]byte, error) {
+	if json.Valid([]byte(d)) {
+		return []byte(d), nil
+	}
+	return json.Marshal(string(d))
+}
+
+// decimalKeys are the key paths of the config's decimals list, read on first use
+var (
+	decimalKeys       []string
+	decimalKeysLoaded bool
+)
+
+// activeDecimalKeys returns the key paths whose numbers are kept as decimals
+func activeDecimalKeys() []string {
+	if !decimalKeysLoaded {
+		decimalKeysLoaded = true
+		if config, err := loadConfig(); err == nil {
+			decimalKeys = config.Decimals
+		}
+	}
+	return decimalKeys
+}
+
+// keepDecimals replaces the floating-point values of decimal keys in data with the
+// text fmString spells them with
+func keepDecimals(fmString string, data map[string]any) {
+	var file *ast.File
+	for _, key := range activeDecimalKeys() {
+		value, found := getValueByPath(data, key)
+		if _, isFloat := value.(float64); !found || !isFloat {
+			continue
+		}
+		if file == nil {
+			parsed, err := yamlparser.ParseBytes([]byte(fmString), 0)
+			if err != nil {
+				return
+			}
+			file = parsed
+		}
+		builder := (&yaml.PathBuilder{}).Root()
+		for _, segment := range strings.Split(key, ".") {
+			builder = builder.Child(segment)
+		}
+		node, err := builder.Build().FilterFile(file)
+		if err != nil || node.Type() != ast.FloatType {
+			continue
+		}
+		setValueByPath(data, key, decimal(node.GetToken().Value))
+	}
+}
+
+// exactNumber returns a number as a fraction, so decimals compare without rounding.
+// Floats count as the shortest decimal that reads back as them.
+func exactNumber(value any) (*big.Rat, bool) {
+	switch v := value.(type) {
+	case decimal:
+		return new(big.Rat).SetString(strings.ReplaceAll(string(v), "_", ""))
+	case int:
+		return new(big.Rat).SetInt64(int64(v)), true
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+	case uint64:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(v)), true
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetString(strconv.FormatFloat(v, 'g', -1, 64))
+	}
+	return nil, false
+}
+
+// unmarshalYAMLMap parses a YAML mapping whose keys may be numbers, dates or booleans
+// (2023: notes). Decoding straight into map[string]any would turn the integer 2023
+// into the rune U+07E7, so the document is decoded generically and every key is
+// converted to its text form, which is how path segments address it.
+func unmarshalYAMLMap(content []byte) (map[string]any, error) {
+	var value any
+	if err := yaml.Unmarshal(content, &value); err != nil {
+		return nil, err
+	}
+	switch v := normalizeYAMLKeys(value).(type) {
+	case nil:
+		return make(map[string]any), nil
+	case map[string]any:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("expected a mapping, found %s", describeType(v))
+	}
+}
+
+// normalizeYAMLKeys converts map[any]any values, which YAML produces for non-string
+// keys, into map[string]any throughout value
+func normalizeYAMLKeys(value any) any {
+	switch v := value.(type) {
+	case map[any]any:
+		converted := make(map[string]any, len(v))
+		for key, nested := range v {
+			converted[fmt.Sprint(key)] = normalizeYAMLKeys(nested)
+		}
+		return converted
+	case map[string]any:
+		for key, nested := range v {
+			v[key] = normalizeYAMLKeys(nested)
+		}
+		return v
+	case []any:
+		for i, nested := range v {
+			v[i] = normalizeYAMLKeys(nested)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// unmarshalBundle parses a bundle: a YAML mapping of file paths to frontmatter
+func unmarshalBundle(content []byte) (map[string]map[string]any, error) {
+	entries, err := unmarshalYAMLMap(content)
+	if err != nil {
+		return nil, err
+	}
+	bundle := make(map[string]map[string]any, len(entries))
+	for filePath, entry := range entries {
+		switch data := entry.(type) {
+		case nil:
+			bundle[filePath] = make(map[string]any)
+		case map[string]any:
+			bundle[filePath] = data
+		default:
+			return nil, fmt.Errorf("frontmatter of %s is %s, not a mapping", filePath, describeType(data))
+		}
+	}
+	return bundle, nil
+}
+
+// hasConflictMarkers reports whether a frontmatter block still contains the start and
+// end markers of a git merge conflict
+func hasConflictMarkers(fmString string) bool {
+	start, end := false, false
+	for _, line := range strings.Split(fmString, "\n") {
+		start = start || strings.HasPrefix(line, "<<<<<<<")
+		end = end || strings.HasPrefix(line, ">>>>>>>")
+	}
+	return start && end
+}
+
+// splitConflictSides rebuilds our and their version of a block with conflict markers.
+// Lines outside conflicts belong to both; a diff3 base section belongs to neither.
+func splitConflictSides(fmString string) (string, string, error) {
+	var ours, theirs strings.Builder
+	const (
+		common = iota
+		inOurs
+		inBase
+		inTheirs
+	)
+	state := common
+	for _, line := range strings.SplitAfter(fmString, "\n") {
+		marker := strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(marker, "<<<<<<<") && state == common:
+			state = inOurs
+		case strings.HasPrefix(marker, "|||||||") && state == inOurs:
+			state = inBase
+		case marker == "=======" && (state == inOurs || state == inBase):
+			state = inTheirs
+		case strings.HasPrefix(marker, ">>>>>>>") && state == inTheirs:
+			state = common
+		case state == common:
+			ours.WriteString(line)
+			theirs.WriteString(line)
+		case state == inOurs:
+			ours.WriteString(line)
+		case state == inTheirs:
+			theirs.WriteString(line)
+		}
+	}
+	if state != common {
+		return "", "", fmt.Errorf("unterminated conflict in frontmatter")
+	}
+	return ours.String(), theirs.String(), nil
+}
+
+func serializeFrontmatter(data map[string]any) (string, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+
+	yamlBytes, err := yaml.MarshalWithOptions(data,
+		yaml.Indent(2),
+		yaml.UseLiteralStyleIfMultiline(true),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize YAML: %w", err)
+	}
+
+	result := string(yamlBytes)
+
+	// Unquote date-only strings (YYYY-MM-DD format)
+	// This is a targeted fix for a specific formatting requirement
+	result = unquoteDateOnlyStrings(result)
+
+	return result, nil
+}
+
+// unquoteDateOnlyStrings removes quotes from date-only values (YYYY-MM-DD)
+// while keeping timestamps and other quoted strings intact
+func unquoteDateOnlyStrings(yamlStr string) string {
+	lines := strings.Split(yamlStr, "\n")
+	for i, line := range lines {
+		// Match pattern: key: "YYYY-MM-DD"
+		prefix, after, found := strings.Cut(line, ": \"")
+		if !found {
+			continue
 		}
-		value, found := currentMap[part]
+
+		value, suffix, found := strings.Cut(after, "\"")
 		if !found {
-			// Path doesn't exist, nothing to delete
+			continue
+		}
+
+		if isDateOnlyString(value) {
+			lines[i] = prefix + ": " + value + suffix
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isDateOnlyString checks if a string matches YYYY-MM-DD format
+func isDateOnlyString(value string) bool {
+	if len(value) != 10 || value[4] != '-' || value[7] != '-' {
+		return false
+	}
+
+	for i, c := range value {
+		if i == 4 || i == 7 {
+			continue // Already checked dashes
+		}
+		if c < '0' || c > '9' {
 			return false
 		}
-		currentValue = value
+	}
+	return true
+}
+
+func writeFileContent(filePath, fmString, bodyString string, dryRun bool) error {
+	if activePlan != nil {
+		return activePlan.record(filePath, fmString, &bodyString)
 	}
 
-	// Delete the final key
-	if finalMap, ok := currentValue.(map[string]any); ok {
-		finalKey := parts[len(parts)-1]
-		_, existed := finalMap[finalKey]
-		delete(finalMap, finalKey)
-		return existed
+	block, err := frontmatterBlock(filePath, fmString)
+	if err != nil {
+		return err
+	}
+	var finalContent strings.Builder
+	finalContent.WriteString(block)
+	finalContent.WriteString(bodyString)
+
+	if dryRun {
+		fmt.Print(finalContent.String())
+		return nil
 	}
 
-	return false
+	if err := checkWritablePath(filePath); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filePath, finalContent.String()); err != nil {
+		return err
+	}
+	writtenFiles = append(writtenFiles, filePath)
+	return nil
+}
+
+// writeFileAtomic writes content to a temporary file next to filePath and moves it
+// over the target, so an interrupted write never leaves a truncated file behind; the
+// permissions of an existing target are kept
+func writeFileAtomic(filePath, content string) error {
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(filePath); err == nil {
+		perm = info.Mode().Perm()
+	}
+	tempFile := filePath + ".tmp"
+	if err := os.WriteFile(tempFile, []byte(content), perm); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := renameFile(tempFile, filePath); err != nil {
+		os.Remove(tempFile) // Clean up on error
+		return fmt.Errorf("failed to rename temporary file: %w", err)
+	}
+	return nil
+}
+
+// Retry budget for renames that fail because another process (an editor, indexer or
+// virus scanner) briefly holds the target open on Windows
+const (
+	renameRetries    = 5
+	renameRetryDelay = 50 * time.Millisecond
+)
+
+// windowsReservedNames are device names Windows resolves in every directory
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// isWindowsReservedName reports whether a file name denotes a Windows device, which
+// holds with any extension and with trailing dots or spaces (nul.md, CON .txt)
+func isWindowsReservedName(name string) bool {
+	base, _, _ := strings.Cut(name, ".")
+	return windowsReservedNames[strings.ToUpper(strings.TrimRight(base, " "))]
+}
+
+// checkWritablePath refuses to write to paths Windows would treat as a device
+func checkWritablePath(filePath string) error {
+	if runtime.GOOS == "windows" && isWindowsReservedName(filepath.Base(filePath)) {
+		return fmt.Errorf("%s: %s is a reserved device name on Windows", filePath, filepath.Base(filePath))
+	}
+	return nil
+}
+
+// renameFile moves a temporary file over its target, retrying with a growing delay
+// while Windows reports the target as locked by another process
+func renameFile(from, to string) error {
+	err := os.Rename(from, to)
+	for attempt := 1; err != nil && attempt <= renameRetries && isLockedFileError(err); attempt++ {
+		time.Sleep(time.Duration(attempt) * renameRetryDelay)
+		err = os.Rename(from, to)
+	}
+	return err
+}
+
+// isLockedFileError reports whether err is a Windows access-denied, sharing or lock
+// violation, the errors a rename gets while another process has the file open
+func isLockedFileError(err error) bool {
+	var errno syscall.Errno
+	if runtime.GOOS != "windows" || !errors.As(err, &errno) {
+		return false
+	}
+	// ERROR_ACCESS_DENIED, ERROR_SHARING_VIOLATION, ERROR_LOCK_VIOLATION
+	return errno == 5 || errno == 32 || errno == 33
+}
+
+// walkOptions controls which files collectFiles picks up inside directories
+type walkOptions struct {
+	Include        []string
+	Exclude        []string
+	MaxDepth       int // 0 means unlimited; files directly in a walked directory are at depth 1
+	FollowSymlinks bool
+	Hidden         bool
+	MaxFileSize    int64     // 0 means unlimited
+	Force          bool      // process files above MaxFileSize instead of skipping them
+	ChangedSince   string    // keep only files changed since the merge base with this git ref
+	GitDirty       bool      // keep only files with uncommitted changes
+	AllFiles       bool      // pick up every file, not only contentExtensions
+	Where          queryExpr // keep only files whose frontmatter matches
+	Limit          int       // keep only the first Limit files; 0 means all
+	Sample         int       // keep Sample files picked at random; 0 means all
+	Seed           int64     // seed of the Sample pick, random when SeedSet is false
+	SeedSet        bool
+	Type           string // keep only files of this content type
+}
+
+// walkBoolFlags and walkValueFlags are the flags accepted by every directory-walking command
+var (
+	walkBoolFlags  = []string{"follow-symlinks", "no-follow-symlinks", "hidden", "force", "git-dirty"}
+	walkValueFlags = []string{"include", "exclude", "max-depth", "max-file-size", "changed-since", "where", "type", "limit", "sample", "seed"}
+)
+
+// bulkBoolFlags and bulkValueFlags are the flags of every command writing through runBulkWrite
+var (
+	bulkBoolFlags  = []string{"yes", "resume", "nice"}
+	bulkValueFlags = []string{"throttle"}
+)
+
+// maxFilesWithoutConfirmation is how many files a mutating command may touch without --yes
+const maxFilesWithoutConfirmation = 100
+
+// walkOptionsFromFlags builds walkOptions from flags parsed with walkBoolFlags and walkValueFlags
+func walkOptionsFromFlags(flags commandFlags) (walkOptions, error) {
+	opts := walkOptions{
+		Include:        flags["include"],
+		Exclude:        flags["exclude"],
+		FollowSymlinks: flags.has("follow-symlinks") && !flags.has("no-follow-symlinks"),
+		Hidden:         flags.has("hidden"),
+		Force:          flags.has("force"),
+		ChangedSince:   flags.get("changed-since", ""),
+		GitDirty:       flags.has("git-dirty"),
+		Type:           flags.get("type", ""),
+	}
+	if flags.has("max-depth") {
+		depth, err := strconv.Atoi(flags.get("max-depth", ""))
+		if err != nil || depth < 1 {
+			return opts, fmt.Errorf("invalid --max-depth value: %s", flags.get("max-depth", ""))
+		}
+		opts.MaxDepth = depth
+	}
+	if flags.has("max-file-size") {
+		size, err := parseByteSize(flags.get("max-file-size", ""))
+		if err != nil {
+			return opts, fmt.Errorf("invalid --max-file-size value: %w", err)
+		}
+		opts.MaxFileSize = size
+	}
+	if flags.has("where") {
+		where, err := resolveQuery(flags.get("where", ""))
+		if err != nil {
+			return opts, fmt.Errorf("invalid --where value: %w", err)
+		}
+		opts.Where = where
+	}
+	return opts, opts.selectionFromFlags(flags)
+}
+
+// selectionFromFlags reads --limit, --sample and --seed
+func (opts *walkOptions) selectionFromFlags(flags commandFlags) error {
+	for _, flag := range []struct {
+		name   string
+		target *int
+	}{{"limit", &opts.Limit}, {"sample", &opts.Sample}} {
+		if !flags.has(flag.name) {
+			continue
+		}
+		n, err := strconv.Atoi(flags.get(flag.name, ""))
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid --%s value: %s", flag.name, flags.get(flag.name, ""))
+		}
+		*flag.target = n
+	}
+	if opts.Limit > 0 && opts.Sample > 0 {
+		return fmt.Errorf("--limit and --sample cannot be combined")
+	}
+	if flags.has("seed") {
+		seed, err := strconv.ParseInt(flags.get("seed", ""), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid --seed value: %s", flags.get("seed", ""))
+		}
+		if opts.Sample == 0 {
+			return fmt.Errorf("--seed needs --sample")
+		}
+		opts.Seed, opts.SeedSet = seed, true
+	}
+	return nil
+}
+
+// selectFiles applies --limit or --sample to the walked files. A sample keeps the walk
+// order, and the seed of an unseeded sample is reported so the pick can be repeated.
+func (opts walkOptions) selectFiles(files []string) []string {
+	switch {
+	case opts.Limit > 0 && len(files) > opts.Limit:
+		return files[:opts.Limit]
+	case opts.Sample > 0 && len(files) > opts.Sample:
+		seed := opts.Seed
+		if !opts.SeedSet {
+			seed = time.Now().UnixNano()
+		}
+		picked := mathrand.New(mathrand.NewSource(seed)).Perm(len(files))[:opts.Sample]
+		slices.Sort(picked)
+		sample := make([]string, len(picked))
+		for i, index := range picked {
+			sample[i] = files[index]
+		}
+		fmt.Fprintf(os.Stderr, "Sampled %d of %d files (--seed %d)\n", len(sample), len(files), seed)
+		return sample
+	}
+	return files
+}
+
+// parseByteSize parses sizes like 512, 64K, 10M or 1G (binary multiples)
+func parseByteSize(value string) (int64, error) {
+	multiplier := int64(1)
+	number := strings.ToUpper(strings.TrimSpace(value))
+	number = strings.TrimSuffix(number, "B")
+	switch {
+	case strings.HasSuffix(number, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(number, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(number, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		number = number[:len(number)-1]
+	}
+
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("%q is not a positive size", value)
+	}
+	return size * multiplier, nil
+}
+
+// allowedBySize reports whether a file passes the --max-file-size guard, warning when it is skipped
+func (opts walkOptions) allowedBySize(filePath string, size int64) bool {
+	if opts.MaxFileSize == 0 || size <= opts.MaxFileSize || opts.Force {
+		return true
+	}
+	fmt.Fprintf(os.Stderr, "Warning: skipping %s (%d bytes exceeds --max-file-size, use --force to include it)\n", filePath, size)
+	return false
+}
+
+// confirmBulkWrite refuses to let a mutating command touch more than
+// maxFilesWithoutConfirmation files unless --yes was given or nothing is written
+func confirmBulkWrite(files []string, confirmed, dryRun bool) error {
+	if confirmed || dryRun || len(files) <= maxFilesWithoutConfirmation {
+		return nil
+	}
+	return fmt.Errorf("refusing to modify %d files (limit %d) without --yes", len(files), maxFilesWithoutConfirmation)
+}
+
+// bulkProgress is the state of a bulk write: the command line that started it and the
+// hash each processed file had right after it was written
+type bulkProgress struct {
+	command string
+	done    map[string]string
+	path    string
+	log     *os.File // open for appending once the progress was first saved
+}
+
+// progressEntry is one line of the progress log. The first line names the command,
+// each further line a processed file and its hash.
+type progressEntry struct {
+	Command string `json:"command,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Hash    string `json:"hash,omitempty"`
+}
+
+// bulkCommandLine identifies a bulk run by its arguments, leaving out --resume
+func bulkCommandLine() string {
+	var args []string
+	for _, arg := range os.Args[1:] {
+		if arg != "--resume" {
+			args = append(args, arg)
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+// loadBulkProgress starts tracking a bulk write. With resume it continues the saved
+// run, which must have been started by the same command line; otherwise any saved
+// progress is discarded.
+func loadBulkProgress(resume bool) (*bulkProgress, error) {
+	rootDir, err := projectRootDir()
+	if err != nil {
+		return nil, err
+	}
+	progress := &bulkProgress{
+		command: bulkCommandLine(),
+		done:    make(map[string]string),
+		path:    filepath.Join(rootDir, cacheDirName, progressFileName),
+	}
+
+	content, err := os.ReadFile(progress.path)
+	if os.IsNotExist(err) {
+		if resume {
+			fmt.Fprintln(os.Stderr, "Warning: no interrupted run to resume, starting from the beginning")
+		}
+		return progress, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", progress.path, err)
+	}
+	command, done, err := parseProgressLog(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", progress.path, err)
+	}
+	if !resume {
+		fmt.Fprintf(os.Stderr, "Warning: discarding the progress of an interrupted run of 'frontmatter %s'\n", command)
+		return progress, nil
+	}
+	if command != progress.command {
+		return nil, fmt.Errorf("the interrupted run was 'frontmatter %s'; resume it with the same arguments or run without --resume to start over", command)
+	}
+	progress.done = done
+	return progress, nil
+}
+
+// parseProgressLog reads a progress log. A last line without a newline was cut off by
+// an interruption while it was appended and is ignored.
+func parseProgressLog(content string) (string, map[string]string, error) {
+	lines := strings.Split(content, "\n")
+	lines = lines[:len(lines)-1]
+	if len(lines) == 0 {
+		return "", nil, fmt.Errorf("missing command line")
+	}
+	var header progressEntry
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil || header.Command == "" {
+		return "", nil, fmt.Errorf("missing command line")
+	}
+	done := make(map[string]string)
+	for i, line := range lines[1:] {
+		var entry progressEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.Path == "" {
+			return "", nil, fmt.Errorf("line %d: invalid entry", i+2)
+		}
+		done[entry.Path] = entry.Hash
+	}
+	return header.Command, done, nil
+}
+
+// processed reports whether a file was already handled by the resumed run. A file
+// edited since then no longer has the recorded hash and is processed again.
+func (p *bulkProgress) processed(filePath string) bool {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return false
+	}
+	recorded, found := p.done[absPath]
+	if !found {
+		return false
+	}
+	hash, _, err := fileHash(filePath)
+	if err != nil || hash != recorded {
+		fmt.Fprintf(os.Stderr, "Warning: %s changed since it was processed, processing it again\n", filePath)
+		return false
+	}
+	return true
+}
+
+// markDone records a processed file. The first call replaces the saved progress with
+// the state of this run through a temporary file; later ones append a line, so saving
+// stays cheap however many files the run has processed.
+func (p *bulkProgress) markDone(filePath string) error {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+	hash, _, err := fileHash(filePath)
+	if err != nil {
+		return err
+	}
+	p.done[absPath] = hash
+	if p.log != nil {
+		line, err := json.Marshal(progressEntry{Path: absPath, Hash: hash})
+		if err != nil {
+			return fmt.Errorf("failed to encode progress: %w", err)
+		}
+		if _, err := p.log.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to save progress: %w", err)
+		}
+		return nil
+	}
+
+	var content strings.Builder
+	encoder := json.NewEncoder(&content)
+	if err := encoder.Encode(progressEntry{Command: p.command}); err != nil {
+		return fmt.Errorf("failed to encode progress: %w", err)
+	}
+	for _, path := range sortedKeys(p.done) {
+		if err := encoder.Encode(progressEntry{Path: path, Hash: p.done[path]}); err != nil {
+			return fmt.Errorf("failed to encode progress: %w", err)
+		}
+	}
+	if err := makeCacheDir(p.path); err != nil {
+		return fmt.Errorf("failed to save progress: %w", err)
+	}
+	if err := writeFileAtomic(p.path, content.String()); err != nil {
+		return fmt.Errorf("failed to save progress: %w", err)
+	}
+	if p.log, err = os.OpenFile(p.path, os.O_WRONLY|os.O_APPEND, 0); err != nil {
+		return fmt.Errorf("failed to save progress: %w", err)
+	}
+	return nil
+}
+
+// finish removes the progress of a completed run
+func (p *bulkProgress) finish() error {
+	if p.log != nil {
+		p.log.Close()
+	}
+	if err := os.Remove(p.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", p.path, err)
+	}
+	return nil
+}
+
+// lowerPriority lowers the CPU and I/O priority of the process for --nice, using
+// renice and ionice where they are installed. It is best effort: a missing tool only
+// produces a warning.
+func lowerPriority() {
+	if runtime.GOOS == "windows" {
+		fmt.Fprintln(os.Stderr, "Warning: --nice is not supported on Windows")
+		return
+	}
+	pid := strconv.Itoa(os.Getpid())
+	for _, command := range [][]string{{"renice", "-n", "10", "-p", pid}, {"ionice", "-c", "3", "-p", pid}} {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: --nice: %s not found, priority left unchanged\n", command[0])
+			continue
+		}
+		if output, err := exec.Command(command[0], command[1:]...).CombinedOutput(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s failed: %s\n", command[0], strings.TrimSpace(string(output)))
+		}
+	}
+}
+
+// throttleInterval converts --throttle (files per second) into the pause between files
+func throttleInterval(flags commandFlags) (time.Duration, error) {
+	if !flags.has("throttle") {
+		return 0, nil
+	}
+	rate, err := strconv.ParseFloat(flags.get("throttle", ""), 64)
+	if err != nil || rate <= 0 {
+		return 0, fmt.Errorf("invalid --throttle value %q: expected files per second, e.g. 10 or 0.5", flags.get("throttle", ""))
+	}
+	return time.Duration(float64(time.Second) / rate), nil
+}
+
+// runBulkWrite applies a mutation to every file of a bulk command after the --yes
+// check. Progress is saved after each file so an interrupted run can continue with
+// --resume; dry runs write nothing and keep no progress. --throttle and --nice slow
+// real runs down for shared filesystems.
+func runBulkWrite(files []string, flags commandFlags, dryRun bool, apply func(filePath string) error) error {
+	if err := confirmBulkWrite(files, flags.has("yes"), dryRun); err != nil {
+		return err
+	}
+	interval, err := throttleInterval(flags)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		for _, filePath := range files {
+			if err := apply(filePath); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	progress, err := loadBulkProgress(flags.has("resume"))
+	if err != nil {
+		return err
+	}
+	if flags.has("nice") {
+		lowerPriority()
+	}
+	var ticker *time.Ticker
+	if interval > 0 {
+		ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+	}
+	skipped, written := 0, 0
+	for _, filePath := range files {
+		if progress.processed(filePath) {
+			skipped++
+			continue
+		}
+		if ticker != nil && written > 0 {
+			<-ticker.C
+		}
+		written++
+		if err := apply(filePath); err != nil {
+			return err
+		}
+		if err := progress.markDone(filePath); err != nil {
+			return err
+		}
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Resumed: skipped %d already processed files\n", skipped)
+	}
+	return progress.finish()
+}
+
+// ignoreRule is a single .frontmatterignore pattern scoped to the directory of its file
+type ignoreRule struct {
+	baseDir  string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// collectFiles expands the given paths into a sorted list of files, walking directories
+// for content files. Explicitly named files are always included; files inside directories
+// are filtered by .frontmatterignore files and the walk options.
+func collectFiles(paths []string, opts walkOptions) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+
+	for _, root := range paths {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", root, err)
+		}
+		if !info.IsDir() {
+			if !seen[root] && opts.allowedBySize(root, info.Size()) {
+				seen[root] = true
+				files = append(files, root)
+			}
+			continue
+		}
+
+		rules, err := loadParentIgnoreRules(root)
+		if err != nil {
+			return nil, err
+		}
+
+		walker := &dirWalker{root: root, opts: opts, seen: seen, visited: make(map[string]bool)}
+		if err := walker.walk(root, 0, rules); err != nil {
+			return nil, fmt.Errorf("failed to walk %s: %w", root, err)
+		}
+		files = append(files, walker.files...)
+	}
+
+	files = dropCaseAliases(files)
+	if opts.FollowSymlinks {
+		files = dropSymlinkAliases(files)
+	}
+
+	if opts.ChangedSince != "" || opts.GitDirty {
+		var err error
+		if files, err = filterGitChanged(files, opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Where != nil {
+		var err error
+		if files, err = filterWhere(files, opts.Where); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Type != "" {
+		var err error
+		if files, err = filterType(files, opts.Type); err != nil {
+			return nil, err
+		}
+	}
+	return opts.selectFiles(files), nil
+}
+
+// listFields returns the keys a listing shows: --fields, else the fields of the --type
+// content type, else fallback
+func listFields(flags commandFlags, fallback string) ([]string, error) {
+	if !flags.has("fields") && flags.has("type") {
+		config, err := loadConfig()
+		if err != nil {
+			return nil, err
+		}
+		if fields := config.Types[flags.get("type", "")].Fields; len(fields) > 0 {
+			return fields, nil
+		}
+	}
+	return strings.Split(flags.get("fields", fallback), ","), nil
+}
+
+// filterType keeps the files whose content type is typeName
+func filterType(files []string, typeName string) ([]string, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := config.Types[typeName]; !ok {
+		return nil, fmt.Errorf("unknown content type %q; types are declared under types in %s", typeName, configFileName)
+	}
+	var matching []string
+	for _, filePath := range files {
+		data, err := readFrontmatterData(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", filePath, err)
+			continue
+		}
+		if config.typeFor(filePath, data) == typeName {
+			matching = append(matching, filePath)
+		}
+	}
+	return matching, nil
+}
+
+// filterWhere keeps the files whose frontmatter matches where. Files that cannot be
+// parsed cannot match and are dropped with a warning.
+func filterWhere(files []string, where queryExpr) ([]string, error) {
+	var matching []string
+	for _, filePath := range files {
+		data, err := readFrontmatterData(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", filePath, err)
+			continue
+		}
+		ok, err := where.matches(&queryDoc{filePath: filePath, data: data})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		if ok {
+			matching = append(matching, filePath)
+		}
+	}
+	return matching, nil
+}
+
+// caseCollisions groups paths that differ only in letter case, in their original order.
+// Such paths name one file on case-insensitive filesystems (macOS, Windows by default).
+func caseCollisions(paths []string) [][]string {
+	groups := make(map[string][]string)
+	var order []string
+	for _, filePath := range paths {
+		folded := strings.ToLower(filepath.Clean(filePath))
+		if len(groups[folded]) == 0 {
+			order = append(order, folded)
+		}
+		groups[folded] = append(groups[folded], filePath)
+	}
+
+	var collisions [][]string
+	for _, folded := range order {
+		if len(groups[folded]) > 1 {
+			collisions = append(collisions, groups[folded])
+		}
+	}
+	return collisions
+}
+
+// sameFile reports whether two existing paths refer to the same file on disk
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+// dropSymlinkAliases removes paths that resolve to a file already in the list, so a
+// symlink to a file inside the walked tree does not get it processed twice. The path
+// that is no symlink itself is kept, since writing through a symlink would replace it.
+func dropSymlinkAliases(files []string) []string {
+	kept := make(map[string]int)
+	var result []string
+	for _, filePath := range files {
+		realPath, err := filepath.EvalSymlinks(filePath)
+		if err != nil {
+			result = append(result, filePath)
+			continue
+		}
+		i, found := kept[realPath]
+		if !found {
+			kept[realPath] = len(result)
+			result = append(result, filePath)
+			continue
+		}
+		if isSymlink(result[i]) && !isSymlink(filePath) {
+			result[i] = filePath
+		}
+	}
+	return result
+}
+
+// isSymlink reports whether filePath itself is a symbolic link
+func isSymlink(filePath string) bool {
+	info, err := os.Lstat(filePath)
+	return err == nil && info.Mode()&fs.ModeSymlink != 0
+}
+
+// dropCaseAliases removes paths that reach a file already in the list under different
+// letter case, so a case-insensitive filesystem does not get the same file processed
+// twice. Distinct files differing only in case are kept, with a warning that they would
+// become one file on macOS or Windows.
+func dropCaseAliases(files []string) []string {
+	alias := make(map[string]bool)
+	for _, group := range caseCollisions(files) {
+		distinct := false
+		for _, filePath := range group[1:] {
+			if sameFile(group[0], filePath) {
+				fmt.Fprintf(os.Stderr, "Warning: %s is the same file as %s on this filesystem, processing it once\n", filePath, group[0])
+				alias[filePath] = true
+			} else {
+				distinct = true
+			}
+		}
+		if distinct {
+			fmt.Fprintf(os.Stderr, "Warning: %s differ only in case and would be one file on case-insensitive filesystems\n", strings.Join(group, ", "))
+		}
+	}
+	if len(alias) == 0 {
+		return files
+	}
+
+	kept := files[:0:0]
+	for _, filePath := range files {
+		if !alias[filePath] {
+			kept = append(kept, filePath)
+		}
+	}
+	return kept
+}
+
+// filterGitChanged keeps the files git reports as changed: with ChangedSince, files
+// differing from the merge base of that ref and HEAD (committed or not); with
+// GitDirty, files with uncommitted changes. Untracked files count as changed.
+func filterGitChanged(files []string, opts walkOptions) ([]string, error) {
+	topLevel, err := gitOutputLines("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	if len(topLevel) == 0 {
+		return nil, fmt.Errorf("git rev-parse --show-toplevel printed nothing")
+	}
+	root := topLevel[0]
+
+	var changed []string
+	if opts.ChangedSince != "" {
+		base, err := gitOutputLines("merge-base", opts.ChangedSince, "HEAD")
+		if err != nil {
+			return nil, err
+		}
+		if len(base) == 0 {
+			return nil, fmt.Errorf("no merge base between %s and HEAD", opts.ChangedSince)
+		}
+		names, err := gitOutputLines("diff", "--name-only", base[0])
+		if err != nil {
+			return nil, err
+		}
+		changed = append(changed, names...)
+	}
+	if opts.GitDirty {
+		names, err := gitOutputLines("diff", "--name-only", "HEAD")
+		if err != nil {
+			return nil, err
+		}
+		changed = append(changed, names...)
+	}
+	untracked, err := gitOutputLines("ls-files", "--others", "--exclude-standard", "--full-name")
+	if err != nil {
+		return nil, err
+	}
+	changed = append(changed, untracked...)
+
+	isChanged := make(map[string]bool)
+	for _, name := range changed {
+		isChanged[filepath.Join(root, filepath.FromSlash(name))] = true
+	}
+
+	var result []string
+	for _, filePath := range files {
+		absPath, err := filepath.Abs(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if resolved, err := filepath.EvalSymlinks(absPath); err == nil {
+			absPath = resolved
+		}
+		if isChanged[absPath] {
+			result = append(result, filePath)
+		}
+	}
+	return result, nil
+}
+
+// gitOutputLines runs git in the working directory and returns its non-empty output lines
+func gitOutputLines(args ...string) ([]string, error) {
+	cmd := exec.Command("git", args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	var lines []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// dirWalker collects content files below root according to walkOptions
+type dirWalker struct {
+	root    string
+	opts    walkOptions
+	seen    map[string]bool
+	visited map[string]bool // real paths of walked directories, guards against symlink loops
+	files   []string
+}
+
+func (w *dirWalker) walk(dir string, depth int, rules []ignoreRule) error {
+	if realDir, err := filepath.EvalSymlinks(dir); err == nil {
+		if w.visited[realDir] {
+			return nil
+		}
+		w.visited[realDir] = true
+	}
+
+	dirRules, err := readIgnoreFile(dir)
+	if err != nil {
+		return err
+	}
+	rules = append(rules[:len(rules):len(rules)], dirRules...)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(dir, entry.Name())
+		relPath, _ := filepath.Rel(w.root, entryPath)
+		relPath = filepath.ToSlash(relPath)
+
+		if strings.HasPrefix(entry.Name(), ".") && !w.opts.Hidden {
+			continue
+		}
+
+		isDir := entry.IsDir()
+		if entry.Type()&fs.ModeSymlink != 0 {
+			if !w.opts.FollowSymlinks {
+				continue
+			}
+			target, err := os.Stat(entryPath)
+			if err != nil {
+				// Dangling symlink
+				continue
+			}
+			isDir = target.IsDir()
+		}
+
+		if isDir {
+			if entry.Name() == ".git" || isIgnored(rules, entryPath, true) || matchesAnyGlob(w.opts.Exclude, relPath) {
+				continue
+			}
+			if w.opts.MaxDepth > 0 && depth+1 >= w.opts.MaxDepth {
+				continue
+			}
+			if err := w.walk(entryPath, depth+1, rules); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !w.opts.AllFiles && !contentExtensions[strings.ToLower(filepath.Ext(entryPath))] || w.seen[entryPath] {
+			continue
+		}
+		if runtime.GOOS == "windows" && isWindowsReservedName(entry.Name()) {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s (reserved device name on Windows)\n", entryPath)
+			continue
+		}
+		if isIgnored(rules, entryPath, false) || matchesAnyGlob(w.opts.Exclude, relPath) {
+			continue
+		}
+		if len(w.opts.Include) > 0 && !matchesAnyGlob(w.opts.Include, relPath) {
+			continue
+		}
+		if info, err := os.Stat(entryPath); err != nil || !w.opts.allowedBySize(entryPath, info.Size()) {
+			continue
+		}
+		w.seen[entryPath] = true
+		w.files = append(w.files, entryPath)
+	}
+
+	return nil
+}
+
+// matchesAnyGlob reports whether relPath matches one of the globs. Globs without a
+// slash match the base name at any depth, like in .gitignore.
+func matchesAnyGlob(globs []string, relPath string) bool {
+	for _, glob := range globs {
+		glob = strings.TrimPrefix(glob, "./")
+		if strings.Contains(glob, "/") {
+			if matchGlob(strings.TrimSuffix(glob, "/"), relPath) {
+				return true
+			}
+		} else if ok, _ := path.Match(glob, path.Base(relPath)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// loadParentIgnoreRules reads .frontmatterignore files from the project root down to
+// the parent of the walk root, so ignores at the top of a project apply to subtree walks
+func loadParentIgnoreRules(root string) ([]ignoreRule, error) {
+	stopDir, err := projectRootDir()
+	if err != nil {
+		return nil, err
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", root, err)
+	}
+
+	var dirs []string
+	for dir := filepath.Dir(absRoot); absRoot != stopDir; dir = filepath.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+		if dir == stopDir || filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	if len(dirs) > 0 && dirs[0] != stopDir {
+		// The walk root is outside the project
+		return nil, nil
+	}
+
+	var rules []ignoreRule
+	for _, dir := range dirs {
+		dirRules, err := readIgnoreFile(dir)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, dirRules...)
+	}
+	return rules, nil
+}
+
+// readIgnoreFile parses dir/.frontmatterignore using gitignore syntax
+func readIgnoreFile(dir string) ([]ignoreRule, error) {
+	content, err := os.ReadFile(filepath.Join(dir, ignoreFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ignore file: %w", err)
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+
+	var rules []ignoreRule
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimRight(line, " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{baseDir: absDir}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, "\\")
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// isIgnored applies ignore rules in order; the last matching rule decides
+func isIgnored(rules []ignoreRule, filePath string, isDir bool) bool {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return false
+	}
+
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		relPath, err := filepath.Rel(rule.baseDir, absPath)
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			continue
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		var matched bool
+		if rule.anchored {
+			matched = matchGlob(rule.pattern, relPath)
+		} else {
+			matched, _ = path.Match(rule.pattern, path.Base(relPath))
+		}
+		if matched {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// updateFileFrontmatter parses the file's frontmatter, lets mutate change it and writes
+// the file back only when the data actually changed. It reports whether a write happened.
+func updateFileFrontmatter(filePath string, dryRun bool, mutate func(data map[string]any) error) (bool, error) {
+	fmString, bodyString, err := readFileContent(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	data, err := parseFrontmatter(fmString)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", filePath, err)
+	}
+	original, err := parseFrontmatter(fmString)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	if err := mutate(data); err != nil {
+		return false, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	if reflect.DeepEqual(original, data) {
+		return false, nil
+	}
+
+	newFmString, err := serializeFrontmatter(data)
+	if err != nil {
+		return false, err
+	}
+
+	return true, writeFileContent(filePath, newFmString, bodyString, dryRun)
+}
+
+func handleGet(args []string) error {
+	flags, args, err := parseCommandFlags(args, []string{"effective", "show-secrets"}, []string{"redact", "jsonpath", "expr"})
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		return fmt.Errorf("no file specified for get")
+	}
+	if flags.has("jsonpath") && flags.has("expr") {
+		return fmt.Errorf("--jsonpath and --expr cannot be combined")
+	}
+	if flags.has("jsonpath") && len(args) > 1 {
+		return fmt.Errorf("get --jsonpath takes no keys")
+	}
+	if flags.has("expr") && len(args) > 1 {
+		return fmt.Errorf("get --expr takes no keys")
+	}
+
+	filePath := args[len(args)-1]
+	keys := args[:len(args)-1]
+
+	// Use optimized reading
+	info, err := readFrontmatterInfo(filePath)
+	if err != nil {
+		return err
+	}
+
+	// Plain top-level scalars are printed straight from the block without parsing it
+	if len(keys) == 1 && !flags.has("effective") && !strings.Contains(keys[0], ".") {
+		if value, ok := fastScalarGet(info.Content, keys[0]); ok {
+			secret := false
+			if !flags.has("show-secrets") {
+				secrets, err := secretKeys(filePath, flags.get("redact", ""))
+				if err != nil {
+					return err
+				}
+				for _, secretKey := range secrets {
+					secret = secret || secretKey == keys[0]
+				}
+			}
+			if !secret {
+				fmt.Println(value)
+				return nil
+			}
+		}
+	}
+
+	data, err := parseFrontmatter(info.Content)
+	if err != nil {
+		return err
+	}
+
+	if flags.has("effective") {
+		// Values from _defaults.yaml files cascade under the file's own block
+		defaults, err := loadCascadedDefaults(filePath)
+		if err != nil {
+			return err
+		}
+		// Defaults of the file's content type sit below the directory defaults
+		config, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		typeDefaults := config.Types[config.typeFor(filePath, data)].Defaults
+		data = deepMerge(deepMerge(typeDefaults, defaults), data)
+	}
+
+	if data, err = redactForOutput(filePath, data, flags); err != nil {
+		return err
+	}
+
+	if len(data) == 0 {
+		// No frontmatter found or it's empty - return error code 2 (not found)
+		return &ExitError{Code: 2, Message: "frontmatter not found"}
+	}
+
+	if flags.has("jsonpath") {
+		values, err := evaluateJSONPath(data, flags.get("jsonpath", ""))
+		if err != nil {
+			return err
+		}
+		return printValues(values)
+	}
+
+	if flags.has("expr") {
+		outputs, err := evaluateJQ(data, flags.get("expr", ""))
+		if err != nil {
+			return err
+		}
+		return printJQOutputs(outputs)
+	}
+
+	if len(keys) == 0 {
+		// Get all frontmatter using the same serializer as write paths
+		fmString, err := serializeFrontmatter(data)
+		if err != nil {
+			return fmt.Errorf("failed to serialize data for get all: %w", err)
+		}
+		fmt.Print(fmString)
+		return nil
+	}
+
+	// Get specific key(s)
+	// For simplicity, this implementation will handle one key. Multiple keys could return a map.
+	key := keys[0]
+	if hasWildcard(key) {
+		return printWildcardValues(data, key)
+	}
+	value, found := getValueByPath(data, key)
+	if !found {
+		// Fall back to the other names the config declares for the key
+		config, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		for _, alias := range config.aliasesFor(key) {
+			if value, found = getValueByPath(data, alias); found {
+				break
+			}
+		}
+	}
+	if !found {
+		// Key not found - return error code 2 (not found)
+		return &ExitError{Code: 2, Message: "field not found"}
+	}
+
+	// If value is a map or slice, YAML marshal it. Otherwise, print directly.
+	switch v := value.(type) {
+	case map[string]any, []any, map[any]any:
+		yamlBytes, err := yaml.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal value for key '%s': %w", key, err)
+		}
+		fmt.Print(string(yamlBytes))
+	default:
+		fmt.Println(v)
+	}
+
+	return nil
+}
+
+func handleHas(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("has needs at least one key and a file")
+	}
+	filePath := args[len(args)-1]
+
+	fmString, err := readFrontmatterBlock(filePath)
+	if err != nil {
+		return err
+	}
+	data, err := parseFrontmatter(fmString)
+	if err != nil {
+		return err
+	}
+	// Every key must exist; null and false values count as present
+	for _, key := range args[:len(args)-1] {
+		found := false
+		for _, target := range expandKeyPath(data, key) {
+			if _, ok := getValueByPath(data, target); ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return &ExitError{Code: 2, Message: "field not found"}
+		}
+	}
+	return nil
+}
+
+// handleLen prints the number of elements of a list or keys of a map, one line per
+// path a wildcard or selector key matches
+func handleLen(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("len needs exactly one key and a file")
+	}
+	key, filePath := args[0], args[1]
+
+	fmString, err := readFrontmatterBlock(filePath)
+	if err != nil {
+		return err
+	}
+	data, err := parseFrontmatter(fmString)
+	if err != nil {
+		return err
+	}
+
+	var counts []int
+	for _, target := range expandKeyPath(data, key) {
+		value, found := getValueByPath(data, target)
+		if !found {
+			continue
+		}
+		switch v := value.(type) {
+		case []any:
+			counts = append(counts, len(v))
+		case map[string]any:
+			counts = append(counts, len(v))
+		default:
+			return fmt.Errorf("'%s' is %s, not a list or map", target, describeType(value))
+		}
+	}
+	if len(counts) == 0 {
+		return &ExitError{Code: 2, Message: "field not found"}
+	}
+	for _, count := range counts {
+		fmt.Println(count)
+	}
+	return nil
+}
+
+// printWildcardValues prints every value a wildcard key path matches
+func printWildcardValues(data map[string]any, key string) error {
+	var values []any
+	for _, target := range expandKeyPath(data, key) {
+		if value, found := getValueByPath(data, target); found {
+			values = append(values, value)
+		}
+	}
+	return printValues(values)
+}
+
+// printValues prints the values selected by a multi-valued get: one per line when all
+// are scalars, otherwise as a YAML list. Selecting nothing is "not found".
+func printValues(values []any) error {
+	if len(values) == 0 {
+		return &ExitError{Code: 2, Message: "field not found"}
+	}
+	for _, value := range values {
+		switch value.(type) {
+		case map[string]any, []any:
+			yamlBytes, err := yaml.Marshal(values)
+			if err != nil {
+				return fmt.Errorf("failed to marshal values: %w", err)
+			}
+			fmt.Print(string(yamlBytes))
+			return nil
+		}
+	}
+	for _, value := range values {
+		fmt.Println(value)
+	}
+	return nil
+}
+
+// printJQOutputs prints the outputs of get --expr one per line: strings raw, like
+// jq -r, everything else as JSON
+func printJQOutputs(outputs []any) error {
+	if len(outputs) == 0 {
+		return &ExitError{Code: 2, Message: "field not found"}
+	}
+	for _, output := range outputs {
+		if s, ok := output.(string); ok {
+			fmt.Println(s)
+			continue
+		}
+		encoded, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode output: %w", err)
+		}
+		fmt.Println(string(encoded))
+	}
+	return nil
+}
+
+// fastScalarGet looks up a top-level scalar by scanning the frontmatter block line by
+// line instead of parsing it. ok is false whenever the block is not trivially valid
+// YAML or the value's type is not obvious from its own line; callers then parse the
+// block, which also reports whatever made the scan give up.
+func fastScalarGet(fmString, key string) (string, bool) {
+	var value string
+	found := false
+	seen := make(map[string]bool)
+	// Indented lines are only accepted as the content of a block scalar, at no less
+	// than the indentation of its first line
+	inBlock, blockIndent := false, 0
+	for rest := fmString; rest != ""; {
+		line := rest
+		if i := strings.IndexByte(rest, '\n'); i >= 0 {
+			line, rest = rest[:i], rest[i+1:]
+		} else {
+			rest = ""
+		}
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] == ' ' {
+			indent := len(line) - len(strings.TrimLeft(line, " "))
+			if !inBlock || indent < blockIndent {
+				return "", false
+			}
+			if blockIndent == 0 {
+				blockIndent = indent
+			}
+			continue
+		}
+		inBlock, blockIndent = false, 0
+		if line[0] == '#' {
+			continue
+		}
+
+		lineKey, lineValue, hasColon := strings.Cut(line, ":")
+		if !hasColon || !isPlainKey(lineKey) || lineValue != "" && lineValue[0] != ' ' || seen[lineKey] {
+			return "", false
+		}
+		seen[lineKey] = true
+		lineValue = strings.TrimSpace(lineValue)
+		switch {
+		case isBlockScalarHeader(lineValue):
+			inBlock = true
+		case lineValue != "" && !isSimpleYAMLValue(lineValue):
+			return "", false
+		}
+		if lineKey == key {
+			value, found = lineValue, true
+		}
+	}
+	if !found || value == "" {
+		return "", false
+	}
+	return plainScalarText(value)
+}
+
+// isPlainKey reports whether a mapping key is a plain word that YAML reads as written
+func isPlainKey(key string) bool {
+	if key == "" || !(key[0] >= 'a' && key[0] <= 'z' || key[0] >= 'A' && key[0] <= 'Z' || key[0] == '_') {
+		return false
+	}
+	for i := 1; i < len(key); i++ {
+		if !isTOMLBareKeyChar(key[i]) && key[i] != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// isBlockScalarHeader reports whether a value opens a literal or folded block scalar
+func isBlockScalarHeader(value string) bool {
+	if value == "" || value[0] != '|' && value[0] != '>' || len(value) > 3 {
+		return false
+	}
+	return strings.Trim(value[1:], "+-123456789") == ""
+}
+
+// isSimpleYAMLValue reports whether a single-line value is certainly valid YAML: a
+// plain or quoted scalar without escapes, or a flow list of such scalars
+func isSimpleYAMLValue(value string) bool {
+	inner, isList := strings.CutPrefix(value, "[")
+	if !isList {
+		return isSimpleYAMLScalar(value)
+	}
+	inner, closed := strings.CutSuffix(inner, "]")
+	if !closed {
+		return false
+	}
+	if strings.TrimSpace(inner) == "" {
+		return true
+	}
+	for _, element := range strings.Split(inner, ",") {
+		element = strings.TrimSpace(element)
+		if strings.ContainsAny(element, "[]{}") || !isSimpleYAMLScalar(element) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSimpleYAMLScalar(value string) bool {
+	if value == "" {
+		return false
+	}
+	switch first := value[0]; {
+	case first == '"' || first == '\'':
+		inner, closed := strings.CutSuffix(value[1:], string(first))
+		return closed && strings.IndexByte(inner, first) < 0 && strings.IndexByte(inner, '\\') < 0
+	case strings.IndexByte("[]{},#&*!|>%@`", first) >= 0:
+		return false
+	case (first == '-' || first == '?' || first == ':') && (len(value) == 1 || value[1] == ' '):
+		return false
+	}
+	return !strings.Contains(value, ": ") && !strings.Contains(value, " #") && !strings.HasSuffix(value, ":") && strings.IndexByte(value, '\t') < 0
+}
+
+// plainScalarText returns the text get would print for a scalar written as value,
+// for the forms whose YAML type is unambiguous: quoted strings without escapes,
+// decimal integers, dates and plain words
+func plainScalarText(value string) (string, bool) {
+	first, last := value[0], value[len(value)-1]
+	switch {
+	case first == '"' || first == '\'':
+		if len(value) < 2 || last != first {
+			return "", false
+		}
+		inner := value[1 : len(value)-1]
+		if strings.IndexByte(inner, first) >= 0 || first == '"' && strings.IndexByte(inner, '\\') >= 0 {
+			return "", false
+		}
+		return inner, true
+	case isDateOnlyString(value):
+		return value, true
+	case first == '-' || first >= '0' && first <= '9':
+		digits := strings.TrimPrefix(value, "-")
+		// -0 is read as 0
+		if digits == "" || len(digits) > 18 || digits[0] == '0' && (len(digits) > 1 || first == '-') {
+			return "", false
+		}
+		for i := 0; i < len(digits); i++ {
+			if digits[i] < '0' || digits[i] > '9' {
+				return "", false
+			}
+		}
+		return value, true
+	case first >= 'a' && first <= 'z' || first >= 'A' && first <= 'Z':
+		if strings.Contains(value, ": ") || strings.Contains(value, " #") || strings.IndexByte(value, '\t') >= 0 || last == ':' {
+			return "", false
+		}
+		for _, word := range []string{"true", "false", "yes", "no", "on", "off", "y", "n", "null"} {
+			if strings.EqualFold(value, word) {
+				return "", false
+			}
+		}
+		return value, true
+	}
+	return "", false
+}
+
+func handleSet(args []string, dryRun bool) error {
+	flags, args, err := parseCommandFlags(args, append([]string{"force", "force-path", "create-missing", "keep-type", "merge", "validate", "fix-case", "json"}, bulkBoolFlags...), append([]string{"where", "limit", "sample", "seed"}, bulkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("at least one key=value pair and a file must be specified for set")
+	}
+
+	filePath := args[len(args)-1]
+	setArgs := args[:len(args)-1]
+	if flags.has("where") {
+		return forEachWhere(flags, filePath, dryRun, func(filePath string) error {
+			return setFields(filePath, setArgs, flags, dryRun)
+		})
+	}
+	return setFields(filePath, setArgs, flags, dryRun)
+}
+
+// parseSetValue converts the value of a key=value argument: numbers and booleans become
+// their types, [...] and {...} are parsed as YAML and anything else is a string
+func parseSetValue(valueStr string) any {
+	var parsedValue any
+	if valInt, err := strconv.ParseInt(valueStr, 10, 64); err == nil {
+		parsedValue = valInt
+	} else if valFloat, err := strconv.ParseFloat(valueStr, 64); err == nil {
+		parsedValue = valFloat
+	} else if valBool, err := strconv.ParseBool(valueStr); err == nil {
+		parsedValue = valBool
+	} else if strings.HasPrefix(valueStr, "[") && strings.HasSuffix(valueStr, "]") ||
+		strings.HasPrefix(valueStr, "{") && strings.HasSuffix(valueStr, "}") {
+		// Attempt to parse as YAML if it looks like a list or map
+		var yamlValue any
+		if err := yaml.Unmarshal([]byte(valueStr), &yamlValue); err == nil {
+			parsedValue = yamlValue
+		} else {
+			// If YAML parsing fails, treat as string
+			parsedValue = strings.Trim(valueStr, "\"") // Trim quotes if it was a quoted string
+		}
+	} else if strings.HasPrefix(valueStr, "{") && strings.HasSuffix(valueStr, "}") {
+		// Attempt to parse JSON-like map first
+		var jsonValue map[string]any
+		if err := json.Unmarshal([]byte(valueStr), &jsonValue); err == nil {
+			parsedValue = jsonValue
+		} else {
+			// Fallback to YAML
+			var yamlValue any
+			if err2 := yaml.Unmarshal([]byte(valueStr), &yamlValue); err2 == nil {
+				parsedValue = yamlValue
+			} else {
+				parsedValue = strings.Trim(valueStr, "\"")
+			}
+		}
+	} else {
+		parsedValue = strings.Trim(valueStr, "\"") // Default to string, trim quotes
+	}
+	return parsedValue
+}
+
+// parseRawYAMLValue parses the value of a key:=value argument strictly as YAML, with
+// none of the guessing of parseSetValue
+func parseRawYAMLValue(valueStr string) (any, error) {
+	var value any
+	if err := yaml.Unmarshal([]byte(valueStr), &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// keepValueType converts the value of a key=value argument to the type of the value it
+// replaces for set --keep-type, so 007 stays a string where a string was. Values that
+// cannot take that type are an error.
+func keepValueType(existing any, valueStr string, parsed any) (any, error) {
+	switch existing.(type) {
+	case nil:
+		return parsed, nil
+	case string:
+		switch parsed.(type) {
+		case map[string]any, []any:
+		default:
+			return strings.Trim(valueStr, "\""), nil
+		}
+	case int, int64, uint64:
+		if n, err := strconv.ParseInt(valueStr, 10, 64); err == nil {
+			return n, nil
+		}
+	case float64:
+		if f, err := strconv.ParseFloat(valueStr, 64); err == nil {
+			return f, nil
+		}
+	case bool:
+		if b, err := strconv.ParseBool(valueStr); err == nil {
+			return b, nil
+		}
+	case []any:
+		if _, isList := parsed.([]any); isList {
+			return parsed, nil
+		}
+	case map[string]any:
+		if _, isMap := parsed.(map[string]any); isMap {
+			return parsed, nil
+		}
+	default:
+		// Dates and other types are written from their text form as before
+		return parsed, nil
+	}
+	return nil, fmt.Errorf("value %q does not fit the existing %s value (drop --keep-type to change its type)", valueStr, describeType(existing))
+}
+
+// forEachWhere applies a mutation to every file below root whose frontmatter matches
+// the --where query (every file when there is none), asking for --yes like other bulk
+// writes
+func forEachWhere(flags commandFlags, root string, dryRun bool, apply func(filePath string) error) error {
+	var opts walkOptions
+	if flags.has("where") {
+		where, err := resolveQuery(flags.get("where", ""))
+		if err != nil {
+			return fmt.Errorf("invalid --where value: %w", err)
+		}
+		opts.Where = where
+	}
+	if err := opts.selectionFromFlags(flags); err != nil {
+		return err
+	}
+	files, err := collectFiles([]string{root}, opts)
+	if err != nil {
+		return err
+	}
+	return runBulkWrite(files, flags, dryRun, apply)
+}
+
+// setFields applies key=value assignments to one file
+func setFields(filePath string, setArgs []string, flags commandFlags, dryRun bool) error {
+	// Use optimized reading
+	info, err := readFrontmatterInfo(filePath)
+	if err != nil {
+		return err
+	}
+
+	if hasConflictMarkers(info.Content) {
+		// Overwriting would throw away both sides of the conflict
+		return &ExitError{Code: 1, Message: fmt.Sprintf("%s: frontmatter contains git conflict markers; run frontmatter resolve first", filePath)}
+	}
+	data, err := parseFrontmatter(info.Content)
+	if err != nil {
+		// If frontmatter is malformed, we might want to overwrite or error out.
+		// For now, let's try to proceed with an empty map if parsing fails, effectively overwriting.
+		// A stricter approach would be: return fmt.Errorf("failed to parse existing frontmatter: %w", err)
+		fmt.Fprintf(os.Stderr, "Warning: could not parse existing frontmatter, new values will overwrite or be added to a new frontmatter block: %v\n", err)
+		data = make(map[string]any)
+	}
+	original, _ := parseFrontmatter(info.Content)
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	schema, err := config.loadSchemaFor(filePath)
+	if err != nil {
+		return err
+	}
+
+	var overwritten []PathOverwrite
+	for _, kvPair := range setArgs {
+		keyPath, valueStr, found := cutAssignment(kvPair)
+		if !found {
+			return fmt.Errorf("invalid key=value format: %s", kvPair)
+		}
+
+		// key:=value takes the value as YAML exactly as written
+		keyPath, isRaw := strings.CutSuffix(keyPath, ":")
+		var parsedValue any
+		if isRaw {
+			if parsedValue, err = parseRawYAMLValue(valueStr); err != nil {
+				return fmt.Errorf("invalid YAML value for key '%s': %w", keyPath, err)
+			}
+		} else {
+			parsedValue = parseSetValue(valueStr)
+		}
+		if _, isFloat := parsedValue.(float64); isFloat && slices.Contains(config.Decimals, keyPath) {
+			parsedValue = decimal(strings.TrimSpace(valueStr))
+		}
+
+		if allowed := allowedValues(config, schema, keyPath); len(allowed) > 0 && !flags.has("force") {
+			canonical, exact, near := matchEnum(allowed, parsedValue)
+			switch {
+			case exact:
+			case near && flags.has("fix-case"):
+				parsedValue = canonical
+			case near:
+				return fmt.Errorf("value %v for key '%s' is not one of %v (did you mean %v? use --fix-case)", parsedValue, keyPath, allowed, canonical)
+			default:
+				return fmt.Errorf("value %v for key '%s' is not one of %v", parsedValue, keyPath, allowed)
+			}
+		}
+
+		// key[]=value appends to the list at key, starting one when the key is unset
+		listPath, isAppend := strings.CutSuffix(keyPath, "[]")
+		if flags.has("create-missing") {
+			if err := createSelectedElements(data, listPath); err != nil {
+				return fmt.Errorf("failed to create elements for key '%s': %w", listPath, err)
+			}
+		}
+		targets := expandKeyPath(data, listPath)
+		if len(targets) == 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %s matches no keys\n", listPath)
+		}
+		for _, target := range targets {
+			value := parsedValue
+			if isAppend {
+				switch existing, _ := getValueByPath(data, target); list := existing.(type) {
+				case nil:
+					value = []any{parsedValue}
+				case []any:
+					value = append(list, parsedValue)
+				default:
+					return fmt.Errorf("cannot append to '%s': it is not a list", target)
+				}
+			} else if flags.has("merge") {
+				// Maps are merged into an existing map, keeping keys the value does not set
+				existing, _ := getValueByPath(data, target)
+				existingMap, existingIsMap := existing.(map[string]any)
+				valueMap, valueIsMap := parsedValue.(map[string]any)
+				if existingIsMap && valueIsMap {
+					value = deepMerge(existingMap, valueMap)
+				}
+			} else if flags.has("keep-type") && !isRaw {
+				if existing, found := getValueByPath(data, target); found {
+					kept, err := keepValueType(existing, valueStr, parsedValue)
+					if err != nil {
+						return fmt.Errorf("%s: %s: %w", filePath, target, err)
+					}
+					value = kept
+				}
+			}
+			if flags.has("force-path") {
+				replaced, err := forceValueByPath(data, target, value)
+				if err != nil {
+					return fmt.Errorf("failed to set value for key '%s': %w", target, err)
+				}
+				overwritten = append(overwritten, replaced...)
+				continue
+			}
+			if err := setValueByPath(data, target, value); err != nil {
+				var conflict *PathConflictError
+				if errors.As(err, &conflict) {
+					return fmt.Errorf("%s: %w (use --force-path to replace it)", filePath, err)
+				}
+				return fmt.Errorf("failed to set value for key '%s': %w", target, err)
+			}
+		}
+	}
+
+	if !flags.has("force") {
+		if err := checkImmutable(filePath, original, data); err != nil {
+			return err
+		}
+	}
+
+	if flags.has("validate") {
+		keyPaths := make([]string, 0, len(setArgs))
+		for _, kvPair := range setArgs {
+			keyPath, _, _ := cutAssignment(kvPair)
+			keyPaths = append(keyPaths, strings.TrimSuffix(strings.TrimSuffix(keyPath, ":"), "[]"))
+		}
+		if err := validateSetValues(filePath, data, keyPaths); err != nil {
+			return err
+		}
+	}
+
+	newFmString, err := serializeFrontmatter(data)
+	if err != nil {
+		return err
+	}
+
+	changes := diffFrontmatter(original, data)
+	if !dryRun {
+		if err := runHooks(config, "pre-set", filePath, changes); err != nil {
+			return err
+		}
+	}
+	if err := writeOptimizedFrontmatter(filePath, newFmString, info, dryRun); err != nil {
+		return err
+	}
+	if flags.has("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(SetResult{File: filePath, Changes: changes, Overwritten: overwritten}); err != nil {
+			return err
+		}
+	}
+	if dryRun {
+		return nil
+	}
+	return runHooks(config, "post-set", filePath, changes)
+}
+
+// SetResult is the set --json report of one file
+type SetResult struct {
+	File        string          `json:"file"`
+	Changes     []string        `json:"changes"`
+	Overwritten []PathOverwrite `json:"overwritten,omitempty"`
+}
+
+func handleDelete(args []string, dryRun bool) error {
+	flags, args, err := parseCommandFlags(args, append([]string{"trash", "force", "recursive"}, bulkBoolFlags...), append([]string{"where", "limit", "sample", "seed"}, bulkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		return fmt.Errorf("file path must be specified for delete")
+	}
+
+	filePath := args[len(args)-1]
+	fieldsToDelete := args[:len(args)-1]
+	if flags.has("recursive") {
+		if len(fieldsToDelete) == 0 {
+			return fmt.Errorf("delete --recursive needs at least one key name")
+		}
+		for _, key := range fieldsToDelete {
+			if strings.ContainsAny(key, ".[]*") {
+				return fmt.Errorf("delete --recursive takes key names, not paths: %s", key)
+			}
+		}
+	}
+	if flags.has("where") || flags.has("recursive") {
+		return forEachWhere(flags, filePath, dryRun, func(filePath string) error {
+			return deleteFields(filePath, fieldsToDelete, flags, dryRun)
+		})
+	}
+	return deleteFields(filePath, fieldsToDelete, flags, dryRun)
+}
+
+// deleteFields deletes keys from one file, or its whole frontmatter when no key is given
+func deleteFields(filePath string, fieldsToDelete []string, flags commandFlags, dryRun bool) error {
+	// For delete we use safer method - reading the entire file
+	fmString, bodyString, err := readFileContent(filePath)
+	if err != nil {
+		// If file doesn't exist, nothing to delete.
+		if os.IsNotExist(err) {
+			if dryRun {
+				fmt.Print("") // Dry run on non-existent file shows empty output
+			}
+			return nil
+		}
+		return err
+	}
+
+	if strings.TrimSpace(fmString) == "" {
+		// No frontmatter to delete
+		if dryRun {
+			fmt.Print(bodyString)
+		} else {
+			return writeFileContent(filePath, "", bodyString, false)
+		}
+		return nil
+	}
+
+	// If no fields specified, delete entire frontmatter
+	if len(fieldsToDelete) == 0 {
+		if !flags.has("force") {
+			if data, err := parseFrontmatter(fmString); err == nil {
+				if err := checkImmutable(filePath, data, map[string]any{}); err != nil {
+					return err
+				}
+			}
+		}
+		if flags.has("trash") && !dryRun {
+			if err := stashFrontmatter(filePath, fmString); err != nil {
+				return err
+			}
+		}
+		if err := writeFileContent(filePath, "", bodyString, dryRun); err != nil {
+			return err
+		}
+		if dryRun {
+			return nil
+		}
+		original, _ := parseFrontmatter(fmString)
+		return runDeleteHooks(filePath, diffFrontmatter(original, nil))
+	}
+
+	// Parse existing frontmatter
+	data, err := parseFrontmatter(fmString)
+	if err != nil {
+		return fmt.Errorf("failed to parse existing frontmatter: %w", err)
+	}
+
+	original, _ := parseFrontmatter(fmString)
+
+	// Delete specified fields; wildcard matches go last first so that removing a list
+	// element does not shift the indices of the ones still to delete
+	for _, fieldPath := range fieldsToDelete {
+		if flags.has("recursive") {
+			deleteKeyEverywhere(data, fieldPath)
+			continue
+		}
+		targets := expandKeyPath(data, fieldPath)
+		for i := len(targets) - 1; i >= 0; i-- {
+			deleteValueByPath(data, targets[i])
+		}
+	}
+
+	if !flags.has("force") {
+		if err := checkImmutable(filePath, original, data); err != nil {
+			return err
+		}
+	}
+
+	// Serialize updated frontmatter
+	newFmString, err := serializeFrontmatter(data)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileContent(filePath, newFmString, bodyString, dryRun); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+	return runDeleteHooks(filePath, diffFrontmatter(original, data))
+}
+
+// handleRename moves the value at one key path to another, keeping it as it is,
+// maps and lists included. Files without the old key are left alone.
+func handleRename(args []string, dryRun bool) error {
+	flags, args, err := parseCommandFlags(args,
+		slices.Concat([]string{"force", "overwrite"}, bulkBoolFlags, walkBoolFlags),
+		append(bulkValueFlags, walkValueFlags...),
+	)
+	if err != nil {
+		return err
+	}
+	if len(args) != 3 {
+		return fmt.Errorf("rename needs an old key, a new key and a file or directory")
+	}
+	oldPath, newPath := args[0], args[1]
+	for _, keyPath := range []string{oldPath, newPath} {
+		if strings.ContainsAny(keyPath, "[]*") {
+			return fmt.Errorf("rename takes plain key paths, not wildcards or selectors: %s", keyPath)
+		}
+	}
+	if pathsOverlap(oldPath, newPath) {
+		return fmt.Errorf("cannot rename %s to %s: one contains the other", oldPath, newPath)
+	}
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(args[2:], opts)
+	if err != nil {
+		return err
+	}
+	return runBulkWrite(files, flags, dryRun, func(filePath string) error {
+		original, err := readFrontmatterData(filePath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filePath, err)
+		}
+		_, err = updateFileFrontmatter(filePath, dryRun, func(data map[string]any) error {
+			value, found := getValueByPath(data, oldPath)
+			if !found {
+				return nil
+			}
+			if _, exists := getValueByPath(data, newPath); exists && !flags.has("overwrite") {
+				return fmt.Errorf("%s already exists (use --overwrite to replace it)", newPath)
+			}
+			deleteValueByPath(data, oldPath)
+			if err := setValueByPath(data, newPath, value); err != nil {
+				return err
+			}
+			if !flags.has("force") {
+				return checkImmutable(filePath, original, data)
+			}
+			return nil
+		})
+		return err
+	})
+}
+
+// handleCopy copies the value at one key path to another, within each file or, with
+// --from, from a source file into every target. With --from the destination defaults
+// to the source key.
+func handleCopy(args []string, dryRun bool) error {
+	flags, args, err := parseCommandFlags(args,
+		slices.Concat([]string{"force", "overwrite"}, bulkBoolFlags, walkBoolFlags),
+		slices.Concat([]string{"from"}, bulkValueFlags, walkValueFlags),
+	)
+	if err != nil {
+		return err
+	}
+	source := flags.get("from", "")
+	if len(args) == 2 && source != "" {
+		args = []string{args[0], args[0], args[1]}
+	}
+	if len(args) != 3 {
+		return fmt.Errorf("copy needs a source key, a destination key and a file or directory")
+	}
+	fromPath, toPath := args[0], args[1]
+	for _, keyPath := range []string{fromPath, toPath} {
+		if strings.ContainsAny(keyPath, "[]*") {
+			return fmt.Errorf("copy takes plain key paths, not wildcards or selectors: %s", keyPath)
+		}
+	}
+	if source == "" && pathsOverlap(fromPath, toPath) {
+		return fmt.Errorf("cannot copy %s to %s: one contains the other", fromPath, toPath)
+	}
+
+	// A value from --from is read once and is the same for every target
+	var sourceValue any
+	if source != "" {
+		data, err := readFrontmatterData(source)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		value, found := getValueByPath(data, fromPath)
+		if !found {
+			return fmt.Errorf("%s: %s not found", source, fromPath)
+		}
+		sourceValue = value
+	}
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(args[2:], opts)
+	if err != nil {
+		return err
+	}
+	return runBulkWrite(files, flags, dryRun, func(filePath string) error {
+		original, err := readFrontmatterData(filePath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filePath, err)
+		}
+		_, err = updateFileFrontmatter(filePath, dryRun, func(data map[string]any) error {
+			value := sourceValue
+			if source == "" {
+				var found bool
+				if value, found = getValueByPath(data, fromPath); !found {
+					return nil
+				}
+			}
+			if _, exists := getValueByPath(data, toPath); exists && !flags.has("overwrite") {
+				return fmt.Errorf("%s already exists (use --overwrite to replace it)", toPath)
+			}
+			if err := setValueByPath(data, toPath, value); err != nil {
+				return err
+			}
+			if !flags.has("force") {
+				return checkImmutable(filePath, original, data)
+			}
+			return nil
+		})
+		return err
+	})
+}
+
+// handleFix rewrites keys the config declares as aliases to their canonical name.
+// When both are set the canonical value wins and the alias is left for a person to check.
+func handleFix(args []string, dryRun bool) error {
+	flags, paths, err := parseCommandFlags(args, append(bulkBoolFlags, walkBoolFlags...), append(bulkValueFlags, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for fix")
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if len(config.Aliases) == 0 {
+		return fmt.Errorf("no aliases in %s, nothing to fix", configFileName)
+	}
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+	return runBulkWrite(files, flags, dryRun, func(filePath string) error {
+		_, err := updateFileFrontmatter(filePath, dryRun, func(data map[string]any) error {
+			for _, alias := range sortedKeys(config.Aliases) {
+				canonical := config.Aliases[alias]
+				value, found := getValueByPath(data, alias)
+				if !found {
+					continue
+				}
+				if _, exists := getValueByPath(data, canonical); exists {
+					fmt.Fprintf(os.Stderr, "Warning: %s: both %s and its alias %s are set, keeping both\n", filePath, canonical, alias)
+					continue
+				}
+				deleteValueByPath(data, alias)
+				if err := setValueByPath(data, canonical, value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return err
+	})
+}
+
+// runDeleteHooks runs the post-delete hooks of the project config
+func runDeleteHooks(filePath string, changes []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	return runHooks(config, "post-delete", filePath, changes)
+}
+
+// runHooks runs the shell commands configured for event, one after another. Each gets
+// FRONTMATTER_EVENT, FRONTMATTER_FILE and FRONTMATTER_CHANGES (the changed keys in
+// drift format, one per line) in its environment, and the file as $1 where the shell
+// is sh. Nothing runs when the frontmatter did not change.
+func runHooks(config *Config, event, filePath string, changes []string) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	for _, command := range config.Hooks[event] {
+		cmd := hookCommand(command, filePath)
+		cmd.Env = append(os.Environ(),
+			"FRONTMATTER_EVENT="+event,
+			"FRONTMATTER_FILE="+filePath,
+			"FRONTMATTER_CHANGES="+strings.Join(changes, "\n"),
+		)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s hook %q failed for %s: %w", event, command, filePath, err)
+		}
+	}
+	return nil
+}
+
+// hookCommand runs a hook through the platform shell: cmd /C on Windows, which has
+// no positional arguments, and sh -c everywhere else
+func hookCommand(command, filePath string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command, "frontmatter-hook", filePath)
+}
+
+func handleRestore(args []string, dryRun bool) error {
+	flags, args, err := parseCommandFlags(args, []string{"force"}, nil)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one file must be specified for restore")
+	}
+	filePath := args[0]
+
+	entryPath, err := trashEntryPath(filePath)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(entryPath)
+	if os.IsNotExist(err) {
+		return &ExitError{Code: 2, Message: "no deleted frontmatter stored for " + filePath}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read trash entry: %w", err)
+	}
+	var entry TrashEntry
+	if err := json.Unmarshal(content, &entry); err != nil {
+		return fmt.Errorf("failed to parse trash entry: %w", err)
+	}
+
+	fmString, bodyString, err := readFileContent(filePath)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(fmString) != "" && !flags.has("force") {
+		return fmt.Errorf("%s already has frontmatter, use --force to replace it", filePath)
+	}
+
+	if err := writeFileContent(filePath, entry.Frontmatter, bodyString, dryRun); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+	if err := os.Remove(entryPath); err != nil {
+		return fmt.Errorf("failed to remove trash entry: %w", err)
+	}
+	return nil
+}
+
+func handleSnapshot(args []string, dryRun bool) error {
+	if len(args) < 1 {
+		return fmt.Errorf("snapshot needs a subcommand: create, diff or restore")
+	}
+	subcommand := args[0]
+
+	flags, args, err := parseCommandFlags(args[1:], append([]string{"yes"}, walkBoolFlags...), walkValueFlags)
+	if err != nil {
+		return err
+	}
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+
+	switch subcommand {
+	case "create":
+		if len(args) == 0 {
+			return fmt.Errorf("at least one file or directory must be specified for snapshot create")
+		}
+		snapshot, err := takeSnapshot(args, opts)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(snapshot); err != nil {
+			return fmt.Errorf("failed to encode snapshot: %w", err)
+		}
+		return nil
+
+	case "diff":
+		if len(args) < 1 {
+			return fmt.Errorf("snapshot diff needs a snapshot file")
+		}
+		saved, err := readSnapshot(args[0])
+		if err != nil {
+			return err
+		}
+		paths := args[1:]
+		if len(paths) == 0 {
+			for filePath := range saved.Files {
+				if _, err := os.Stat(filePath); err == nil {
+					paths = append(paths, filePath)
+				}
+			}
+		}
+		current, err := takeSnapshot(paths, opts)
+		if err != nil {
+			return err
+		}
+		for _, line := range diffSnapshots(saved, current) {
+			fmt.Println(line)
+		}
+		return nil
+
+	case "restore":
+		if len(args) != 1 {
+			return fmt.Errorf("snapshot restore needs exactly one snapshot file")
+		}
+		saved, err := readSnapshot(args[0])
+		if err != nil {
+			return err
+		}
+		return replaceAllFrontmatter(saved.Files, flags.has("yes"), dryRun)
+
+	default:
+		return fmt.Errorf("unknown snapshot subcommand: %s", subcommand)
+	}
+}
+
+func handleBundle(args []string, dryRun bool) error {
+	if len(args) < 1 {
+		return fmt.Errorf("bundle needs a subcommand: export or import")
+	}
+	subcommand := args[0]
+
+	// -o is accepted as a short form of --out
+	rest := make([]string, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		if arg == "-o" {
+			arg = "--out"
+		}
+		rest = append(rest, arg)
+	}
+	flags, args, err := parseCommandFlags(rest, append([]string{"yes"}, walkBoolFlags...), append([]string{"out"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+
+	switch subcommand {
+	case "export":
+		if len(args) == 0 {
+			return fmt.Errorf("at least one file or directory must be specified for bundle export")
+		}
+		opts, err := walkOptionsFromFlags(flags)
+		if err != nil {
+			return err
+		}
+		snapshot, err := takeSnapshot(args, opts)
+		if err != nil {
+			return err
+		}
+		bundle, err := yaml.MarshalWithOptions(snapshot.Files,
+			yaml.Indent(2),
+			yaml.UseLiteralStyleIfMultiline(true),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to serialize bundle: %w", err)
+		}
+
+		if out := flags.get("out", ""); out != "" && out != "-" {
+			return os.WriteFile(out, bundle, 0644)
+		}
+		fmt.Print(string(bundle))
+		return nil
+
+	case "import":
+		if len(args) != 1 {
+			return fmt.Errorf("bundle import needs exactly one bundle file")
+		}
+		content, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read bundle: %w", err)
+		}
+		bundle, err := unmarshalBundle(content)
+		if err != nil {
+			return fmt.Errorf("failed to parse bundle %s: %w", args[0], err)
+		}
+		return replaceAllFrontmatter(bundle, flags.has("yes"), dryRun)
+
+	default:
+		return fmt.Errorf("unknown bundle subcommand: %s", subcommand)
+	}
+}
+
+func handleDrift(args []string) error {
+	flags, paths, err := parseCommandFlags(args, walkBoolFlags, append([]string{"against"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	against := flags.get("against", "")
+	if against == "" {
+		return fmt.Errorf("drift needs --against <snapshot or bundle>")
+	}
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+
+	baseline, err := readBaseline(against)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		for filePath := range baseline {
+			if _, err := os.Stat(filePath); err == nil {
+				paths = append(paths, filePath)
+			}
+		}
+	}
+	current, err := takeSnapshot(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	drifted := 0
+	for _, filePath := range sortedKeys(current.Files) {
+		saved, existed := baseline[filePath]
+		if !existed {
+			fmt.Printf("%s (not in baseline)\n", filePath)
+			drifted++
+			continue
+		}
+		changes := diffFrontmatter(saved, current.Files[filePath])
+		if len(changes) == 0 {
+			continue
+		}
+		fmt.Println(filePath)
+		for _, change := range changes {
+			fmt.Println("  " + change)
+		}
+		drifted++
+	}
+	for _, filePath := range sortedKeys(baseline) {
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			fmt.Printf("%s (deleted)\n", filePath)
+			drifted++
+		}
+	}
+
+	if drifted > 0 {
+		return &ExitError{Code: 1, Message: fmt.Sprintf("drift detected in %d file(s)", drifted)}
+	}
+	return nil
+}
+
+// readBaseline loads per-file frontmatter from either a snapshot (JSON with
+// created_at/files) or a bundle (YAML keyed by path)
+func readBaseline(baselinePath string) (map[string]map[string]any, error) {
+	content, err := os.ReadFile(baselinePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline: %w", err)
+	}
+
+	var probe map[string]any
+	if err := yaml.Unmarshal(content, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse baseline %s: %w", baselinePath, err)
+	}
+	if _, isSnapshot := probe["created_at"]; isSnapshot {
+		snapshot, err := readSnapshot(baselinePath)
+		if err != nil {
+			return nil, err
+		}
+		return snapshot.Files, nil
+	}
+
+	bundle, err := unmarshalBundle(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bundle %s: %w", baselinePath, err)
+	}
+	return bundle, nil
+}
+
+// diffFrontmatter describes per-key changes from before to after as
+// "+ key: value", "- key: value" and "~ key: old -> new" lines
+func diffFrontmatter(before, after map[string]any) []string {
+	beforeFlat := make(map[string]any)
+	afterFlat := make(map[string]any)
+	flattenFrontmatter("", before, beforeFlat)
+	flattenFrontmatter("", after, afterFlat)
+
+	keys := sortedKeys(beforeFlat)
+	for key := range afterFlat {
+		if _, found := beforeFlat[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []string
+	for _, key := range keys {
+		oldValue, hadOld := beforeFlat[key]
+		newValue, hasNew := afterFlat[key]
+		switch {
+		case !hadOld:
+			changes = append(changes, fmt.Sprintf("+ %s: %s", key, formatInlineValue(newValue)))
+		case !hasNew:
+			changes = append(changes, fmt.Sprintf("- %s: %s", key, formatInlineValue(oldValue)))
+		case !valuesEqual(oldValue, newValue):
+			changes = append(changes, fmt.Sprintf("~ %s: %s -> %s", key, formatInlineValue(oldValue), formatInlineValue(newValue)))
+		}
+	}
+	return changes
+}
+
+// flattenFrontmatter maps every leaf of nested maps to its dot-separated path;
+// lists and empty maps are kept as single values
+func flattenFrontmatter(prefix string, data map[string]any, out map[string]any) {
+	for key, value := range data {
+		keyPath := joinKeyPath(prefix, key)
+		if nested, ok := value.(map[string]any); ok && len(nested) > 0 {
+			flattenFrontmatter(keyPath, nested, out)
+			continue
+		}
+		out[keyPath] = value
+	}
+}
+
+// formatInlineValue renders a value on one line as JSON
+func formatInlineValue(value any) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+// replaceAllFrontmatter sets the frontmatter of each file to the given data,
+// rewriting only files whose frontmatter differs. Missing files are skipped.
+func replaceAllFrontmatter(files map[string]map[string]any, confirmed, dryRun bool) error {
+	paths := sortedKeys(files)
+	if err := confirmBulkWrite(paths, confirmed, dryRun); err != nil {
+		return err
+	}
+	for _, group := range caseCollisions(paths) {
+		for _, filePath := range group[1:] {
+			if sameFile(group[0], filePath) {
+				// The later entry would silently overwrite the earlier one
+				return fmt.Errorf("%s and %s are the same file on this case-insensitive filesystem", group[0], filePath)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %s differ only in case and would be one file on case-insensitive filesystems\n", strings.Join(group, ", "))
+	}
+
+	for _, filePath := range paths {
+		if _, err := os.Stat(filePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s no longer exists, skipping\n", filePath)
+			continue
+		}
+		_, err := updateFileFrontmatter(filePath, dryRun, func(data map[string]any) error {
+			if valuesEqual(data, files[filePath]) {
+				return nil
+			}
+			for key := range data {
+				delete(data, key)
+			}
+			for key, value := range files[filePath] {
+				data[key] = value
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// takeSnapshot reads the frontmatter of every file under paths
+func takeSnapshot(paths []string, opts walkOptions) (*Snapshot, error) {
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{CreatedAt: time.Now().UTC(), Files: make(map[string]map[string]any)}
+	for _, filePath := range files {
+		info, err := readFrontmatterInfo(filePath)
+		if err != nil {
+			return nil, err
+		}
+		data, err := parseFrontmatter(info.Content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		snapshot.Files[filepath.ToSlash(filePath)] = data
+	}
+	return snapshot, nil
+}
+
+// readSnapshot loads a snapshot written by snapshot create
+func readSnapshot(snapshotPath string) (*Snapshot, error) {
+	file, err := os.Open(snapshotPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber()
+	snapshot := &Snapshot{}
+	if err := decoder.Decode(snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot %s: %w", snapshotPath, err)
+	}
+	for filePath, data := range snapshot.Files {
+		if data == nil {
+			data = make(map[string]any)
+		}
+		snapshot.Files[filePath] = normalizeJSONValue(data).(map[string]any)
+	}
+	return snapshot, nil
+}
+
+// diffSnapshots lists files that were modified (M), added (A) or deleted (D) in current
+func diffSnapshots(saved, current *Snapshot) []string {
+	var lines []string
+	for _, filePath := range sortedKeys(current.Files) {
+		savedData, existed := saved.Files[filePath]
+		if !existed {
+			lines = append(lines, "A "+filePath)
+		} else if !valuesEqual(savedData, current.Files[filePath]) {
+			lines = append(lines, "M "+filePath)
+		}
+	}
+	for _, filePath := range sortedKeys(saved.Files) {
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			lines = append(lines, "D "+filePath)
+		}
+	}
+	return lines
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// valuesEqual compares parsed values by their JSON form, so numbers decoded by
+// different parsers (uint64 from YAML, int64 from JSON) compare equal
+func valuesEqual(a, b any) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return string(aJSON) == string(bJSON)
+}
+
+// trashEntryPath returns the trash file for filePath, keyed by a hash of its absolute path
+func trashEntryPath(filePath string) (string, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", filePath, err)
+	}
+	rootDir, err := projectRootDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(absPath))
+	return filepath.Join(rootDir, trashDirName, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// stashFrontmatter saves the raw frontmatter block of filePath into the trash store,
+// replacing any earlier entry for the same file
+func stashFrontmatter(filePath, fmString string) error {
+	entryPath, err := trashEntryPath(filePath)
+	if err != nil {
+		return err
+	}
+	absPath, _ := filepath.Abs(filePath)
+
+	content, err := json.MarshalIndent(TrashEntry{Path: absPath, DeletedAt: time.Now().UTC(), Frontmatter: fmString}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode trash entry: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(entryPath), 0755); err != nil {
+		return fmt.Errorf("failed to create trash directory: %w", err)
+	}
+	if err := os.WriteFile(entryPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write trash entry: %w", err)
+	}
+	return nil
+}
+
+func handleJSON(args []string) error {
+	flags, args, err := parseCommandFlags(args, []string{"show-secrets"}, []string{"redact"})
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one file must be specified for json")
+	}
+	filePath := args[0]
+
+	if _, err := os.Stat(filePath); err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+
+	fmString, bodyString, err := readFileContent(filePath)
+	if err != nil {
+		return err
+	}
+
+	data, err := parseFrontmatter(fmString)
+	if err != nil {
+		return err
+	}
+
+	if data, err = redactForOutput(filePath, data, flags); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(DocumentJSON{Frontmatter: data, Body: bodyString, Path: filePath}); err != nil {
+		return fmt.Errorf("failed to encode document as JSON: %w", err)
+	}
+	return nil
+}
+
+func handleUnjson(args []string, dryRun bool) error {
+	if len(args) > 1 {
+		return fmt.Errorf("unjson accepts at most one input file")
+	}
+
+	var input io.Reader = os.Stdin
+	if len(args) == 1 && args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to open file: %w", err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	decoder := json.NewDecoder(input)
+	decoder.UseNumber()
+	var doc DocumentJSON
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("failed to decode JSON document: %w", err)
+	}
+	if doc.Path == "" {
+		return fmt.Errorf("JSON document has no path")
+	}
+
+	data, _ := normalizeJSONValue(doc.Frontmatter).(map[string]any)
+	fmString, err := serializeFrontmatter(data)
+	if err != nil {
+		return err
+	}
+
+	return writeFileContent(doc.Path, fmString, doc.Body, dryRun)
+}
+
+// handleReplaceAll swaps the whole frontmatter of a file for a YAML document read from
+// stdin or --from, leaving the body exactly as it was
+func handleReplaceAll(args []string, dryRun bool) error {
+	flags, args, err := parseCommandFlags(args, []string{"force"}, []string{"from"})
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("replace-all needs exactly one file")
+	}
+	filePath := args[0]
+	if _, err := os.Stat(filePath); err != nil {
+		return fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+
+	var input io.Reader = os.Stdin
+	if from := flags.get("from", "-"); from != "-" {
+		file, err := os.Open(from)
+		if err != nil {
+			return fmt.Errorf("failed to open file: %w", err)
+		}
+		defer file.Close()
+		input = file
+	}
+	content, err := io.ReadAll(input)
+	if err != nil {
+		return fmt.Errorf("failed to read new frontmatter: %w", err)
+	}
+	// Accept the document with or without its own --- delimiters
+	if fmString, _, err := splitFrontmatter(string(content)); err == nil && fmString != "" {
+		content = []byte(fmString)
+	}
+	data, err := unmarshalYAMLMap(content)
+	if err != nil {
+		return fmt.Errorf("invalid new frontmatter: %w", err)
+	}
+
+	fmString, bodyString, err := readFileContent(filePath)
+	if err != nil {
+		return err
+	}
+	original, err := parseFrontmatter(fmString)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	if !flags.has("force") {
+		if err := checkImmutable(filePath, original, data); err != nil {
+			return err
+		}
+		config, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		schema, err := config.loadSchemaFor(filePath)
+		if err != nil {
+			return err
+		}
+		var problems []string
+		for _, violation := range validateFrontmatter(config, schema, data) {
+			problems = append(problems, violation.String())
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("invalid new frontmatter: %s (use --force to write it anyway)", strings.Join(problems, "; "))
+		}
+	}
+
+	newFmString, err := serializeFrontmatter(data)
+	if err != nil {
+		return err
+	}
+	return writeFileContent(filePath, newFmString, bodyString, dryRun)
+}
+
+// HTML elements import-html reads; attributes are parsed separately by htmlAttribute
+var (
+	htmlTitleElement = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlMetaElement  = regexp.MustCompile(`(?is)<(meta|link)\s[^>]*>`)
+	htmlAttribute    = regexp.MustCompile(`(?is)([a-z_:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	htmlBodyElement  = regexp.MustCompile(`(?is)<body(?:\s[^>]*)?>(.*?)(?:</body>|$)`)
+	// htmlPageParts is what surrounds the content of a page without a <body> element
+	htmlPageParts = regexp.MustCompile(`(?is)<!doctype[^>]*>|<head(?:\s[^>]*)?>.*?</head>|<title[^>]*>.*?</title>|<(?:meta|link)\s[^>]*>|</?html(?:\s[^>]*)?>`)
+)
+
+// htmlMetaKeys maps meta names and properties to the frontmatter keys import-html
+// writes, in order of preference when several tags fill the same key
+var htmlMetaKeys = []metaMapping{
+	{"og:title", "title"},
+	{"description", "description"},
+	{"og:description", "description"},
+	{"og:url", "url"},
+	{"article:published_time", "date"},
+	{"date", "date"},
+	{"article:modified_time", "lastmod"},
+	{"author", "author"},
+	{"article:author", "author"},
+	{"og:image", "image"},
+}
+
+func handleImportHTML(args []string, dryRun bool) error {
+	flags, args, err := parseCommandFlags(args, []string{"frontmatter-only", "force"}, []string{"to"})
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("import-html needs exactly one HTML file")
+	}
+	content, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", args[0], err)
+	}
+	imported := frontmatterFromHTML(string(content))
+	body := ""
+	if !flags.has("frontmatter-only") {
+		if body = htmlBody(string(content)); body != "" {
+			body += "\n"
+		}
+	}
+
+	target := flags.get("to", "")
+	if target == "" {
+		fmString, err := serializeFrontmatter(imported)
+		if err != nil {
+			return err
+		}
+		if flags.has("frontmatter-only") {
+			fmt.Print(fmString)
+		} else {
+			fmt.Print(frontmatterSeparator + "\n" + fmString + frontmatterSeparator + "\n" + body)
+		}
+		return nil
+	}
+	// Imported values replace keys already present in the target
+	if flags.has("frontmatter-only") {
+		_, err = updateFileFrontmatter(target, dryRun, func(data map[string]any) error {
+			maps.Copy(data, imported)
+			return nil
+		})
+		return err
+	}
+
+	fmString, existingBody, err := readFileContent(target)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(existingBody) != "" && existingBody != body && !flags.has("force") {
+		return fmt.Errorf("%s already has a body; use --force to replace it with the page body or --frontmatter-only to keep it", target)
+	}
+	data, err := parseFrontmatter(fmString)
+	if err != nil {
+		return fmt.Errorf("%s: %w", target, err)
+	}
+	maps.Copy(data, imported)
+	newFmString, err := serializeFrontmatter(data)
+	if err != nil {
+		return err
+	}
+	return writeFileContent(target, newFmString, body, dryRun)
+}
+
+// htmlBody returns the content of the page's <body> element, or the page without its
+// doctype, head and metadata elements when it has none. The HTML is kept verbatim, as
+// markdown renders it as is.
+func htmlBody(page string) string {
+	if match := htmlBodyElement.FindStringSubmatch(page); match != nil {
+		return strings.TrimSpace(match[1])
+	}
+	return strings.TrimSpace(htmlPageParts.ReplaceAllString(page, ""))
+}
+
+// frontmatterFromHTML collects the title, description, canonical URL, dates, tags and
+// OpenGraph properties of an HTML page. og: properties without a dedicated key are
+// kept under og, and <link rel="canonical"> wins over og:url.
+func frontmatterFromHTML(page string) map[string]any {
+	tags := make(map[string][]string)
+	canonical := ""
+	for _, element := range htmlMetaElement.FindAllStringSubmatch(page, -1) {
+		attrs := make(map[string]string)
+		for _, attr := range htmlAttribute.FindAllStringSubmatch(element[0], -1) {
+			attrs[strings.ToLower(attr[1])] = html.UnescapeString(attr[2] + attr[3] + attr[4])
+		}
+		if strings.EqualFold(element[1], "link") {
+			if strings.EqualFold(attrs["rel"], "canonical") && attrs["href"] != "" {
+				canonical = attrs["href"]
+			}
+			continue
+		}
+		name := strings.ToLower(attrs["property"])
+		if name == "" {
+			name = strings.ToLower(attrs["name"])
+		}
+		if name != "" && strings.TrimSpace(attrs["content"]) != "" {
+			tags[name] = append(tags[name], strings.TrimSpace(attrs["content"]))
+		}
+	}
+
+	data := make(map[string]any)
+	mapped := make(map[string]bool)
+	for _, mapping := range htmlMetaKeys {
+		mapped[mapping.Tag] = true
+		if _, taken := data[mapping.Key]; !taken && len(tags[mapping.Tag]) > 0 {
+			data[mapping.Key] = tags[mapping.Tag][0]
+		}
+	}
+	if _, taken := data["title"]; !taken {
+		if match := htmlTitleElement.FindStringSubmatch(page); match != nil {
+			if title := strings.TrimSpace(html.UnescapeString(match[1])); title != "" {
+				data["title"] = title
+			}
+		}
+	}
+	if canonical != "" {
+		data["url"] = canonical
+	}
+
+	var keywords []string
+	for _, keyword := range strings.Split(strings.Join(tags["keywords"], ","), ",") {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+	keywords = append(keywords, tags["article:tag"]...)
+	if len(keywords) > 0 {
+		data["tags"] = uniqueStrings(keywords)
+	}
+
+	og := make(map[string]any)
+	for name, values := range tags {
+		if property, found := strings.CutPrefix(name, "og:"); found && !mapped[name] {
+			og[property] = values[0]
+		}
+	}
+	if len(og) > 0 {
+		data["og"] = og
+	}
+	return data
+}
+
+// migratedPost is a post or page read from a blog export, ready to be written as markdown
+type migratedPost struct {
+	Slug        string
+	Frontmatter map[string]any
+	Body        string
+}
+
+// wordpressExport is the part of a WordPress WXR export migrate-from reads. Fields
+// without a namespace match the wp: elements of every WXR version.
+type wordpressExport struct {
+	Items []struct {
+		Title    string `xml:"title"`
+		Creator  string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+		Content  string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+		Excerpt  string `xml:"http://wordpress.org/export/1.2/excerpt/ encoded"`
+		ID       string `xml:"post_id"`
+		Date     string `xml:"post_date"`
+		DateGMT  string `xml:"post_date_gmt"`
+		Name     string `xml:"post_name"`
+		Status   string `xml:"status"`
+		PostType string `xml:"post_type"`
+		Terms    []struct {
+			Domain string `xml:"domain,attr"`
+			Name   string `xml:",chardata"`
+		} `xml:"category"`
+	} `xml:"channel>item"`
+}
+
+// ghostData is the data section of a Ghost JSON export
+type ghostData struct {
+	Posts []struct {
+		ID            string `json:"id"`
+		Title         string `json:"title"`
+		Slug          string `json:"slug"`
+		HTML          string `json:"html"`
+		Plaintext     string `json:"plaintext"`
+		Status        string `json:"status"`
+		Type          string `json:"type"`
+		PublishedAt   string `json:"published_at"`
+		CreatedAt     string `json:"created_at"`
+		CustomExcerpt string `json:"custom_excerpt"`
+	} `json:"posts"`
+	Tags []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"tags"`
+	PostsTags []struct {
+		PostID string `json:"post_id"`
+		TagID  string `json:"tag_id"`
+	} `json:"posts_tags"`
+	Users []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"users"`
+	PostsAuthors []struct {
+		PostID   string `json:"post_id"`
+		AuthorID string `json:"author_id"`
+	} `json:"posts_authors"`
+}
+
+func handleMigrateFrom(args []string, dryRun bool) error {
+	flags, args, err := parseCommandFlags(args, []string{"force", "yes"}, []string{"out"})
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("migrate-from needs a source (wordpress or ghost) and an export file")
+	}
+	outDir := flags.get("out", "")
+	if outDir == "" {
+		return fmt.Errorf("--out is required for migrate-from")
+	}
+	content, err := os.ReadFile(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to read export: %w", err)
+	}
+
+	var posts []migratedPost
+	switch args[0] {
+	case "wordpress":
+		posts, err = readWordPressExport(content)
+	case "ghost":
+		posts, err = readGhostExport(content)
+	default:
+		return fmt.Errorf("unknown migration source %q (want wordpress or ghost)", args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", args[1], err)
+	}
+
+	paths := make([]string, 0, len(posts))
+	used := make(map[string]int)
+	for _, post := range posts {
+		// Posts sharing a slug get numbered files instead of overwriting each other
+		name := post.Slug
+		if used[name]++; used[name] > 1 {
+			name = fmt.Sprintf("%s-%d", name, used[name])
+		}
+		target := filepath.Join(outDir, name+".md")
+		if rel, err := filepath.Rel(outDir, target); err != nil || !filepath.IsLocal(rel) {
+			return fmt.Errorf("post %q would be written outside %s", post.Slug, outDir)
+		}
+		paths = append(paths, target)
+	}
+	if err := confirmBulkWrite(paths, flags.has("yes"), dryRun); err != nil {
+		return err
+	}
+	if !dryRun {
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", outDir, err)
+		}
+	}
+
+	written := 0
+	for i, post := range posts {
+		if _, err := os.Stat(paths[i]); err == nil && !flags.has("force") {
+			fmt.Fprintf(os.Stderr, "Warning: %s already exists, skipping (use --force to overwrite)\n", paths[i])
+			continue
+		}
+		fmString, err := serializeFrontmatter(post.Frontmatter)
+		if err != nil {
+			return err
+		}
+		body := post.Body
+		if body != "" && !strings.HasSuffix(body, "\n") {
+			body += "\n"
+		}
+		if err := writeFileContent(paths[i], fmString, body, dryRun); err != nil {
+			return err
+		}
+		written++
+	}
+	if !dryRun {
+		fmt.Fprintf(os.Stderr, "Migrated %d of %d post(s) to %s\n", written, len(posts), outDir)
+	}
+	return nil
+}
+
+// migratedSlug names the file of a migrated post after its slug, its title or its
+// id, in that order. Exports are not trusted to hold safe file names, so each is
+// slugified.
+func migratedSlug(slug, title, id string) string {
+	if name := slugify(slug); name != "" {
+		return name
+	}
+	if name := slugify(title); name != "" {
+		return name
+	}
+	return "post-" + slugify(id)
+}
+
+// readWordPressExport maps the posts and pages of a WXR file to markdown files.
+// Attachments, menu items and other internal post types are left out.
+func readWordPressExport(content []byte) ([]migratedPost, error) {
+	var export wordpressExport
+	if err := xml.Unmarshal(content, &export); err != nil {
+		return nil, err
+	}
+
+	var posts []migratedPost
+	for _, item := range export.Items {
+		if item.PostType != "post" && item.PostType != "page" {
+			continue
+		}
+		data := map[string]any{"title": item.Title}
+		// Drafts have a zero GMT date, which does not parse
+		if date, ok := parseDateValue(item.DateGMT); ok {
+			data["date"] = date.Format(time.RFC3339)
+		} else if date, ok := parseDateValue(item.Date); ok {
+			data["date"] = date.Format("2006-01-02T15:04:05")
+		}
+		var tags, categories []string
+		for _, term := range item.Terms {
+			switch term.Domain {
+			case "post_tag":
+				tags = append(tags, strings.TrimSpace(term.Name))
+			case "category":
+				categories = append(categories, strings.TrimSpace(term.Name))
+			}
+		}
+		if len(tags) > 0 {
+			data["tags"] = uniqueStrings(tags)
+		}
+		if len(categories) > 0 {
+			data["categories"] = uniqueStrings(categories)
+		}
+		addMigratedFields(data, item.Status, item.PostType, item.Creator, item.Excerpt)
+
+		// WordPress percent-encodes non-ASCII slugs
+		name, err := url.PathUnescape(item.Name)
+		if err != nil {
+			name = item.Name
+		}
+		slug := migratedSlug(name, item.Title, item.ID)
+		data["slug"] = slug
+		posts = append(posts, migratedPost{Slug: slug, Frontmatter: data, Body: item.Content})
+	}
+	return posts, nil
+}
+
+// readGhostExport maps the posts and pages of a Ghost JSON export to markdown files.
+// Internal tags (starting with #) are dropped; Ghost has no categories.
+func readGhostExport(content []byte) ([]migratedPost, error) {
+	var export struct {
+		DB []struct {
+			Data ghostData `json:"data"`
+		} `json:"db"`
+		Data *ghostData `json:"data"`
+	}
+	if err := json.Unmarshal(content, &export); err != nil {
+		return nil, err
+	}
+	// Exports wrap the data in a db list; older ones put it at the top level
+	var data ghostData
+	switch {
+	case len(export.DB) > 0:
+		data = export.DB[0].Data
+	case export.Data != nil:
+		data = *export.Data
+	default:
+		return nil, fmt.Errorf("no data section found")
+	}
+
+	tagNames := make(map[string]string)
+	for _, tag := range data.Tags {
+		tagNames[tag.ID] = tag.Name
+	}
+	userNames := make(map[string]string)
+	for _, user := range data.Users {
+		userNames[user.ID] = user.Name
+	}
+	postTags := make(map[string][]string)
+	for _, link := range data.PostsTags {
+		if name := tagNames[link.TagID]; name != "" && !strings.HasPrefix(name, "#") {
+			postTags[link.PostID] = append(postTags[link.PostID], name)
+		}
+	}
+	postAuthors := make(map[string]string)
+	for _, link := range data.PostsAuthors {
+		if _, found := postAuthors[link.PostID]; !found {
+			postAuthors[link.PostID] = userNames[link.AuthorID]
+		}
+	}
+
+	var posts []migratedPost
+	for _, post := range data.Posts {
+		fm := map[string]any{"title": post.Title}
+		published := post.PublishedAt
+		if published == "" {
+			published = post.CreatedAt
+		}
+		if date, ok := parseDateValue(published); ok {
+			fm["date"] = date.Format(time.RFC3339)
+		}
+		if tags := postTags[post.ID]; len(tags) > 0 {
+			fm["tags"] = uniqueStrings(tags)
+		}
+		postType := post.Type
+		if postType == "" {
+			postType = "post"
+		}
+		status := post.Status
+		if status == "published" {
+			status = "publish"
+		}
+		addMigratedFields(fm, status, postType, postAuthors[post.ID], post.CustomExcerpt)
+
+		slug := migratedSlug(post.Slug, post.Title, post.ID)
+		fm["slug"] = slug
+		body := post.HTML
+		if body == "" {
+			body = post.Plaintext
+		}
+		posts = append(posts, migratedPost{Slug: slug, Frontmatter: fm, Body: body})
+	}
+	return posts, nil
+}
+
+// addMigratedFields sets the keys both migration sources share. Anything not
+// published becomes a draft; status keeps the source's own value.
+func addMigratedFields(data map[string]any, status, postType, author, excerpt string) {
+	if status != "" {
+		data["status"] = status
+	}
+	data["draft"] = status != "publish"
+	if postType != "post" {
+		data["type"] = postType
+	}
+	if author != "" {
+		data["author"] = author
+	}
+	if excerpt = strings.TrimSpace(excerpt); excerpt != "" {
+		data["description"] = excerpt
+	}
+}
+
+// PropertyMapping is the --mapping file of import-props. Fields maps property names
+// to frontmatter keys; Types gives keys the type list, date, bool or number (string
+// otherwise). Unmapped properties get a lower-case, underscore-separated key unless
+// OnlyMapped is set.
+type PropertyMapping struct {
+	Fields     map[string]string `yaml:"fields"`
+	Types      map[string]string `yaml:"types"`
+	OnlyMapped bool              `yaml:"onlyMapped"`
+}
+
+// notionDateLayouts are the date formats of Notion property values
+var notionDateLayouts = []string{
+	"January 2, 2006 3:04 PM",
+	"January 2, 2006",
+	"2006/01/02 15:04",
+	"2006/01/02",
+}
+
+// notionProperty matches a "Name: value" property line of a Notion export
+var notionProperty = regexp.MustCompile(`^([^:|#][^:]*?):\s+(.*)$`)
+
+func handleImportProps(args []string, dryRun bool) error {
+	if len(args) < 1 || args[0] != "notion" && args[0] != "confluence" {
+		return fmt.Errorf("import-props needs a source: notion or confluence")
+	}
+	source := args[0]
+
+	flags, paths, err := parseCommandFlags(args[1:], append([]string{"yes"}, walkBoolFlags...), append([]string{"mapping"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for import-props")
+	}
+	mapping := &PropertyMapping{}
+	if mappingPath := flags.get("mapping", ""); mappingPath != "" {
+		content, err := os.ReadFile(mappingPath)
+		if err != nil {
+			return fmt.Errorf("failed to read mapping: %w", err)
+		}
+		if err := yaml.Unmarshal(content, mapping); err != nil {
+			return fmt.Errorf("failed to parse mapping %s: %w", mappingPath, err)
+		}
+	}
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+	if err := confirmBulkWrite(files, flags.has("yes"), dryRun); err != nil {
+		return err
+	}
+
+	for _, filePath := range files {
+		fmString, body, err := readFileContent(filePath)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(fmString) != "" {
+			// Already converted, or never exported with properties
+			continue
+		}
+		title, properties, rest := splitPageProperties(source, body)
+		if title == "" && len(properties) == 0 {
+			continue
+		}
+
+		data := make(map[string]any)
+		if title != "" {
+			data["title"] = title
+		}
+		for _, property := range properties {
+			key, value, ok := mapping.convert(property[0], property[1])
+			if ok {
+				data[key] = value
+			}
+		}
+		newFmString, err := serializeFrontmatter(data)
+		if err != nil {
+			return err
+		}
+		if err := writeFileContent(filePath, newFmString, rest, dryRun); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitPageProperties takes the page title (a leading # heading) and the properties
+// after it off an exported page body. Notion writes properties as "Name: value"
+// lines below the title, Confluence as a two-column table; either block ends at the
+// first line that does not fit.
+func splitPageProperties(source, body string) (string, [][2]string, string) {
+	lines := strings.SplitAfter(body, "\n")
+	i := 0
+	skipBlank := func() {
+		for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+			i++
+		}
+	}
+
+	skipBlank()
+	title := ""
+	if i < len(lines) && strings.HasPrefix(lines[i], "# ") {
+		title = strings.TrimSpace(lines[i][2:])
+		i++
+		skipBlank()
+	}
+
+	var properties [][2]string
+	for ; i < len(lines) && (title != "" || source == "confluence"); i++ {
+		line := strings.TrimSpace(lines[i])
+		if source == "notion" {
+			match := notionProperty.FindStringSubmatch(line)
+			if match == nil {
+				break
+			}
+			properties = append(properties, [2]string{strings.TrimSpace(match[1]), strings.TrimSpace(match[2])})
+			continue
+		}
+
+		if !strings.HasPrefix(line, "|") || !strings.HasSuffix(line, "|") {
+			break
+		}
+		cells := strings.Split(strings.Trim(line, "|"), "|")
+		if len(cells) != 2 {
+			break
+		}
+		name, value := strings.TrimSpace(cells[0]), strings.TrimSpace(cells[1])
+		if strings.Trim(name, "-: ") == "" {
+			// Header separator row
+			continue
+		}
+		if (strings.EqualFold(name, "property") || strings.EqualFold(name, "key")) && strings.EqualFold(value, "value") {
+			continue
+		}
+		properties = append(properties, [2]string{name, value})
+	}
+	if title == "" && len(properties) == 0 {
+		return "", nil, body
+	}
+	skipBlank()
+	return title, properties, strings.Join(lines[i:], "")
+}
+
+// convert maps a property to its frontmatter key and typed value. ok is false for
+// empty values and for unmapped properties when only mapped ones are wanted.
+func (m *PropertyMapping) convert(name, text string) (string, any, bool) {
+	key, mapped := m.Fields[name]
+	if !mapped {
+		if m.OnlyMapped {
+			return "", nil, false
+		}
+		key = strings.Join(strings.Fields(strings.ToLower(name)), "_")
+	}
+	if text == "" {
+		return "", nil, false
+	}
+
+	switch m.Types[key] {
+	case "list":
+		var items []string
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return key, uniqueStrings(items), true
+	case "date":
+		for _, layout := range notionDateLayouts {
+			if date, err := time.Parse(layout, text); err == nil {
+				if strings.Contains(layout, ":") {
+					return key, date.Format("2006-01-02T15:04:05"), true
+				}
+				return key, date.Format(time.DateOnly), true
+			}
+		}
+		if date, ok := parseDateValue(text); ok {
+			return key, date.Format(time.RFC3339), true
+		}
+	case "bool":
+		switch strings.ToLower(text) {
+		case "yes", "true", "checked":
+			return key, true, true
+		case "no", "false", "unchecked":
+			return key, false, true
+		}
+	case "number":
+		if number, err := strconv.ParseFloat(text, 64); err == nil {
+			if number == float64(int64(number)) {
+				return key, int64(number), true
+			}
+			return key, number, true
+		}
+	}
+	return key, text, true
+}
+
+// fileRevision is the frontmatter of a file as committed in one revision
+type fileRevision struct {
+	Commit      string
+	Author      string
+	Date        string
+	Frontmatter map[string]any // nil when the committed block does not parse
+}
+
+// HistoryEntry is one change of a key reported by the history command
+type HistoryEntry struct {
+	Commit string `json:"commit"`
+	Author string `json:"author"`
+	Date   string `json:"date"`
+	Change string `json:"change"` // added, changed or removed
+	Old    any    `json:"old,omitempty"`
+	New    any    `json:"new,omitempty"`
+}
+
+// fileRevisions returns the committed frontmatter of filePath in every commit that
+// touched it, oldest first, following renames
+func fileRevisions(filePath string) ([]fileRevision, error) {
+	dir := filepath.Dir(filePath)
+	lines, err := gitOutputLines("-C", dir, "log", "--follow", "--name-only", "--format=%x00%H%x09%aN%x09%aI", "--", filepath.Base(filePath))
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []fileRevision
+	for i := 0; i < len(lines); i++ {
+		header, isHeader := strings.CutPrefix(lines[i], "\x00")
+		if !isHeader || i+1 >= len(lines) || strings.HasPrefix(lines[i+1], "\x00") {
+			// Merge commits list no file
+			continue
+		}
+		fields := strings.SplitN(header, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		// --name-only paths are relative to the repository root
+		i++
+		content, err := exec.Command("git", "-C", dir, "show", fields[0]+":"+lines[i]).Output()
+		revision := fileRevision{Commit: fields[0], Author: fields[1], Date: fields[2]}
+		if err == nil {
+			fmString, _, _ := splitFrontmatter(string(content))
+			revision.Frontmatter, _ = parseFrontmatter(fmString)
+		}
+		revisions = append([]fileRevision{revision}, revisions...)
+	}
+	return revisions, nil
+}
+
+func handleHistory(args []string) error {
+	flags, args, err := parseCommandFlags(args, []string{"json"}, []string{"key"})
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("history needs exactly one file")
+	}
+	key := flags.get("key", "")
+	if key == "" {
+		return fmt.Errorf("--key is required for history")
+	}
+
+	revisions, err := fileRevisions(args[0])
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		return fmt.Errorf("%s has no git history", args[0])
+	}
+
+	entries := []HistoryEntry{}
+	var previous any
+	existed := false
+	for _, revision := range revisions {
+		if revision.Frontmatter == nil {
+			// An unparseable revision (e.g. mid-merge) tells nothing about the key
+			continue
+		}
+		value, exists := getValueByPath(revision.Frontmatter, key)
+		entry := HistoryEntry{Commit: revision.Commit, Author: revision.Author, Date: revision.Date}
+		switch {
+		case exists && !existed:
+			entry.Change, entry.New = "added", normalizeJSONValue(value)
+		case !exists && existed:
+			entry.Change, entry.Old = "removed", normalizeJSONValue(previous)
+		case exists && !valuesEqual(previous, value):
+			entry.Change, entry.Old, entry.New = "changed", normalizeJSONValue(previous), normalizeJSONValue(value)
+		default:
+			continue
+		}
+		entries = append(entries, entry)
+		previous, existed = value, exists
+	}
+
+	if flags.has("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(entries); err != nil {
+			return fmt.Errorf("failed to encode history: %w", err)
+		}
+		return nil
+	}
+	for _, entry := range entries {
+		change := ""
+		switch entry.Change {
+		case "added":
+			change = "+ " + formatInlineValue(entry.New)
+		case "removed":
+			change = "- " + formatInlineValue(entry.Old)
+		default:
+			change = "~ " + formatInlineValue(entry.Old) + " -> " + formatInlineValue(entry.New)
+		}
+		date, _, _ := strings.Cut(entry.Date, "T")
+		fmt.Printf("%s  %s  %s  %s\n", date, entry.Commit[:min(7, len(entry.Commit))], entry.Author, change)
+	}
+	return nil
+}
+
+// BlameEntry attributes the current value of a key to the commit that last changed it
+type BlameEntry struct {
+	Key    string `json:"key"`
+	Commit string `json:"commit,omitempty"` // empty when the change is not committed yet
+	Author string `json:"author"`
+	Date   string `json:"date,omitempty"`
+	Value  any    `json:"value"`
+}
+
+func handleBlame(args []string) error {
+	flags, args, err := parseCommandFlags(args, []string{"json"}, nil)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("blame needs exactly one file")
+	}
+
+	revisions, err := fileRevisions(args[0])
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		return fmt.Errorf("%s has no git history", args[0])
+	}
+
+	blamed := make(map[string]fileRevision)
+	previous := map[string]any{}
+	for _, revision := range revisions {
+		if revision.Frontmatter == nil {
+			continue
+		}
+		for _, key := range changedKeyPaths(previous, revision.Frontmatter) {
+			blamed[key] = revision
+		}
+		previous = revision.Frontmatter
+	}
+
+	current, err := readFrontmatterData(args[0])
+	if err != nil {
+		return err
+	}
+	uncommitted := make(map[string]bool)
+	for _, key := range changedKeyPaths(previous, current) {
+		uncommitted[key] = true
+	}
+	flat := make(map[string]any)
+	flattenFrontmatter("", current, flat)
+
+	entries := []BlameEntry{}
+	for _, key := range sortedKeys(flat) {
+		entry := BlameEntry{Key: key, Author: "Not Committed Yet", Value: normalizeJSONValue(flat[key])}
+		if revision, found := blamed[key]; found && !uncommitted[key] {
+			entry.Commit, entry.Author, entry.Date = revision.Commit, revision.Author, revision.Date
+		}
+		entries = append(entries, entry)
+	}
+
+	if flags.has("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(entries); err != nil {
+			return fmt.Errorf("failed to encode blame: %w", err)
+		}
+		return nil
+	}
+	keyWidth, authorWidth := 0, 0
+	for _, entry := range entries {
+		keyWidth = max(keyWidth, len(entry.Key))
+		authorWidth = max(authorWidth, len(entry.Author))
+	}
+	for _, entry := range entries {
+		commit := "0000000"
+		if entry.Commit != "" {
+			commit = entry.Commit[:min(7, len(entry.Commit))]
+		}
+		date, _, _ := strings.Cut(entry.Date, "T")
+		fmt.Printf("%s  %-*s  %-10s  %-*s  %s\n", commit, authorWidth, entry.Author, date, keyWidth, entry.Key, formatInlineValue(entry.Value))
+	}
+	return nil
+}
+
+func handleResolve(args []string, dryRun bool) error {
+	flags, args, err := parseCommandFlags(args, nil, []string{"ours", "theirs", "union"})
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("resolve needs exactly one file")
+	}
+	filePath := args[0]
+
+	fmString, bodyString, err := readFileContent(filePath)
+	if err != nil {
+		return err
+	}
+	if !hasConflictMarkers(fmString) {
+		return fmt.Errorf("%s has no conflict markers in its frontmatter", filePath)
+	}
+	oursString, theirsString, err := splitConflictSides(fmString)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filePath, err)
+	}
+	ours, err := parseFrontmatter(oursString)
+	if err != nil {
+		return fmt.Errorf("%s: our side: %w", filePath, err)
+	}
+	theirs, err := parseFrontmatter(theirsString)
+	if err != nil {
+		return fmt.Errorf("%s: their side: %w", filePath, err)
+	}
+
+	// Keys without a chosen side must agree on both sides
+	chosen := append(append(append([]string{}, flags["ours"]...), flags["theirs"]...), flags["union"]...)
+	var unresolved []string
+	for _, keyPath := range changedKeyPaths(ours, theirs) {
+		covered := false
+		for _, key := range chosen {
+			covered = covered || keyPath == key || strings.HasPrefix(keyPath, key+".")
+		}
+		if !covered {
+			unresolved = append(unresolved, keyPath)
+		}
+	}
+	if len(unresolved) > 0 {
+		sort.Strings(unresolved)
+		return &ExitError{Code: 1, Message: fmt.Sprintf("%s: conflicting keys need --ours, --theirs or --union: %s", filePath, strings.Join(unresolved, ", "))}
+	}
+
+	// Our side is the base; flagged keys are then taken from theirs or combined
+	resolved, err := parseFrontmatter(oursString)
+	if err != nil {
+		return err
+	}
+	for _, key := range flags["theirs"] {
+		if value, found := getValueByPath(theirs, key); found {
+			if err := setValueByPath(resolved, key, value); err != nil {
+				return err
+			}
+		} else {
+			deleteValueByPath(resolved, key)
+		}
+	}
+	for _, key := range flags["union"] {
+		ourValue, _ := getValueByPath(ours, key)
+		theirValue, _ := getValueByPath(theirs, key)
+		value, err := unionValues(ourValue, theirValue)
+		if err != nil {
+			return &ExitError{Code: 1, Message: fmt.Sprintf("%s: cannot union %s: %v", filePath, key, err)}
+		}
+		if err := setValueByPath(resolved, key, value); err != nil {
+			return err
+		}
+	}
+
+	newFmString, err := serializeFrontmatter(resolved)
+	if err != nil {
+		return err
+	}
+	return writeFileContent(filePath, newFmString, bodyString, dryRun)
+}
+
+// unionValues combines both sides of a conflicting value: lists keep our items and append
+// their missing ones, maps are joined recursively, and a side that lacks the value
+// yields the other. Differing scalars cannot be combined.
+func unionValues(ours, theirs any) (any, error) {
+	switch {
+	case ours == nil:
+		return theirs, nil
+	case theirs == nil || valuesEqual(ours, theirs):
+		return ours, nil
+	}
+	ourList, oursIsList := ours.([]any)
+	theirList, theirsIsList := theirs.([]any)
+	if oursIsList && theirsIsList {
+		result := append([]any{}, ourList...)
+		for _, item := range theirList {
+			if !slices.ContainsFunc(result, func(existing any) bool { return valuesEqual(existing, item) }) {
+				result = append(result, item)
+			}
+		}
+		return result, nil
+	}
+	ourMap, oursIsMap := ours.(map[string]any)
+	theirMap, theirsIsMap := theirs.(map[string]any)
+	if oursIsMap && theirsIsMap {
+		result := make(map[string]any, len(ourMap))
+		for key, value := range ourMap {
+			result[key] = value
+		}
+		for key, value := range theirMap {
+			merged, err := unionValues(result[key], value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			result[key] = merged
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("%s and %s differ and are not both lists or maps", formatInlineValue(ours), formatInlineValue(theirs))
+}
+
+// MergeConflict is a key, or the body, changed differently by both sides of a merge.
+// Values are omitted where the key does not exist on that side.
+type MergeConflict struct {
+	Key    string `json:"key"`
+	Base   any    `json:"base,omitempty"`
+	Ours   any    `json:"ours,omitempty"`
+	Theirs any    `json:"theirs,omitempty"`
+}
+
+// MergeReport is the JSON result of merge3
+type MergeReport struct {
+	Clean     bool            `json:"clean"`
+	Conflicts []MergeConflict `json:"conflicts"`
+}
+
+// bodyConflictKey names the body in merge conflicts, where it cannot clash with a key path
+const bodyConflictKey = "(body)"
+
+// mergeFrontmatter3 merges the changes of ours and theirs relative to base leaf by leaf:
+// a leaf changed on one side only takes that change, and a leaf changed on both sides
+// to different values is a conflict that keeps our value. Lists are merged as a whole.
+func mergeFrontmatter3(base, ours, theirs map[string]any) (map[string]any, []MergeConflict) {
+	flat := [3]map[string]any{{}, {}, {}}
+	for i, data := range []map[string]any{base, ours, theirs} {
+		flattenFrontmatter("", data, flat[i])
+	}
+	keys := make(map[string]bool)
+	for _, side := range flat {
+		for key := range side {
+			keys[key] = true
+		}
+	}
+
+	merged := make(map[string]any)
+	var conflicts []MergeConflict
+	for _, key := range sortedKeys(keys) {
+		baseValue, inBase := flat[0][key]
+		ourValue, inOurs := flat[1][key]
+		theirValue, inTheirs := flat[2][key]
+		same := func(a any, aFound bool, b any, bFound bool) bool {
+			return aFound == bFound && (!aFound || valuesEqual(a, b))
+		}
+
+		value, found := ourValue, inOurs
+		switch {
+		case same(ourValue, inOurs, theirValue, inTheirs), same(baseValue, inBase, theirValue, inTheirs):
+		case same(baseValue, inBase, ourValue, inOurs):
+			value, found = theirValue, inTheirs
+		default:
+			conflict := MergeConflict{Key: key}
+			if inBase {
+				conflict.Base = normalizeJSONValue(baseValue)
+			}
+			if inOurs {
+				conflict.Ours = normalizeJSONValue(ourValue)
+			}
+			if inTheirs {
+				conflict.Theirs = normalizeJSONValue(theirValue)
+			}
+			conflicts = append(conflicts, conflict)
+		}
+		if found {
+			if err := setValueByPath(merged, key, value); err != nil {
+				conflicts = append(conflicts, MergeConflict{Key: key, Ours: normalizeJSONValue(value)})
+			}
+		}
+	}
+	return merged, conflicts
+}
+
+func handleMerge3(args []string, dryRun bool) error {
+	// -o is accepted as a short form of --out
+	rest := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "-o" {
+			arg = "--out"
+		}
+		rest = append(rest, arg)
+	}
+	flags, args, err := parseCommandFlags(rest, []string{"json"}, []string{"out"})
+	if err != nil {
+		return err
+	}
+	if len(args) != 3 {
+		return fmt.Errorf("merge3 needs a base, ours and theirs file")
+	}
+	output := flags.get("out", "")
+
+	var data [3]map[string]any
+	var bodies [3]string
+	for i, filePath := range args {
+		if _, err := os.Stat(filePath); err != nil {
+			return fmt.Errorf("failed to read %s: %w", filePath, err)
+		}
+		fmString, bodyString, err := readFileContent(filePath)
+		if err != nil {
+			return err
+		}
+		if data[i], err = parseFrontmatter(fmString); err != nil {
+			return fmt.Errorf("%s: %w", filePath, err)
+		}
+		bodies[i] = bodyString
+	}
+
+	merged, conflicts := mergeFrontmatter3(data[0], data[1], data[2])
+	body := bodies[1]
+	switch {
+	case bodies[1] == bodies[2] || bodies[0] == bodies[2]:
+	case bodies[0] == bodies[1]:
+		body = bodies[2]
+	default:
+		conflicts = append(conflicts, MergeConflict{Key: bodyConflictKey})
+	}
+
+	newFmString, err := serializeFrontmatter(merged)
+	if err != nil {
+		return err
+	}
+	if output != "" {
+		if err := writeFileContent(output, newFmString, body, dryRun); err != nil {
+			return err
+		}
+	}
+
+	if flags.has("json") {
+		report := MergeReport{Clean: len(conflicts) == 0, Conflicts: conflicts}
+		if report.Conflicts == nil {
+			report.Conflicts = []MergeConflict{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode merge report: %w", err)
+		}
+	} else if output == "" {
+		// Printing is what a dry run does, without touching any file
+		if err := writeFileContent("", newFmString, body, true); err != nil {
+			return err
+		}
+	}
+
+	if len(conflicts) > 0 {
+		for _, conflict := range conflicts {
+			if conflict.Key == bodyConflictKey {
+				fmt.Fprintln(os.Stderr, "CONFLICT body: changed on both sides, keeping ours")
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "CONFLICT %s: base %s, ours %s, theirs %s\n", conflict.Key,
+				formatInlineValue(conflict.Base), formatInlineValue(conflict.Ours), formatInlineValue(conflict.Theirs))
+		}
+		return &ExitError{Code: 1, Message: fmt.Sprintf("%d conflicts, our side was kept for them", len(conflicts))}
+	}
+	return nil
+}
+
+// Plan is the set of writes a command would make, recorded by plan for apply
+type Plan struct {
+	Command []string      `json:"command"`
+	Created string        `json:"created"`
+	Files   []PlannedFile `json:"files"`
+}
+
+// PlannedFile is the new frontmatter of one file and the changes it makes. SHA256 is
+// the file's hash at planning time, empty when the file did not exist; Body is only
+// recorded when it changes.
+type PlannedFile struct {
+	Path        string          `json:"path"`
+	SHA256      string          `json:"sha256"`
+	Frontmatter string          `json:"frontmatter"`
+	Body        *string         `json:"body,omitempty"`
+	Changes     []PlannedChange `json:"changes"`
+}
+
+// PlannedChange is one key changed by a plan; Old or New is omitted when the key is
+// added or removed
+type PlannedChange struct {
+	Key string `json:"key"`
+	Old any    `json:"old,omitempty"`
+	New any    `json:"new,omitempty"`
+}
+
+// fileHash returns the hex SHA-256 of a file, or "" when it does not exist
+func fileHash(filePath string) (string, []byte, error) {
+	content, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), content, nil
+}
+
+// record adds a write to the plan. A nil body keeps the current one. Writes that
+// change neither a value nor the body are left out; a later write to the same file
+// replaces the earlier one.
+func (p *Plan) record(filePath, fmString string, body *string) error {
+	hash, content, err := fileHash(filePath)
+	if err != nil {
+		return err
+	}
+	oldFmString, oldBody, err := splitFrontmatter(string(content))
+	if err != nil {
+		return err
+	}
+	before := make(map[string]any)
+	after := make(map[string]any)
+	if oldData, err := parseFrontmatter(oldFmString); err == nil {
+		flattenFrontmatter("", oldData, before)
+	}
+	newData, err := parseFrontmatter(fmString)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filePath, err)
+	}
+	flattenFrontmatter("", newData, after)
+
+	planned := PlannedFile{Path: filePath, SHA256: hash, Frontmatter: fmString, Changes: []PlannedChange{}}
+	for _, key := range changedKeyPaths(before, after) {
+		change := PlannedChange{Key: key}
+		if value, found := before[key]; found {
+			change.Old = normalizeJSONValue(value)
+		}
+		if value, found := after[key]; found {
+			change.New = normalizeJSONValue(value)
+		}
+		planned.Changes = append(planned.Changes, change)
+	}
+	sort.Slice(planned.Changes, func(i, j int) bool { return planned.Changes[i].Key < planned.Changes[j].Key })
+	if body != nil && (*body != oldBody || hash == "") {
+		planned.Body = body
+	}
+	if len(planned.Changes) == 0 && planned.Body == nil && hash != "" {
+		return nil
+	}
+
+	p.Files = slices.DeleteFunc(p.Files, func(existing PlannedFile) bool { return existing.Path == filePath })
+	p.Files = append(p.Files, planned)
+	return nil
+}
+
+func handlePlan(args []string) error {
+	output := ""
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch name, value, hasValue := strings.Cut(args[0], "="); {
+		case (name == "--out" || name == "-o") && hasValue:
+			output, args = value, args[1:]
+		case (name == "--out" || name == "-o") && len(args) > 1:
+			output, args = args[1], args[2:]
+		default:
+			return fmt.Errorf("unknown flag for plan: %s", args[0])
+		}
+	}
+	if output == "" {
+		return fmt.Errorf("plan needs --out <file>")
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("plan needs a command to plan")
+	}
+	if args[0] == "plan" || args[0] == "apply" {
+		return fmt.Errorf("plan cannot plan %s", args[0])
+	}
+
+	plan := &Plan{Command: args, Created: time.Now().UTC().Format(time.RFC3339), Files: []PlannedFile{}}
+	activePlan = plan
+	// The dry run keeps hooks, trash entries and other side effects from happening
+	err := run(append(append([]string{}, args...), "--dry-run"))
+	activePlan = nil
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+	if err := os.WriteFile(output, append(encoded, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	changes := 0
+	for _, planned := range plan.Files {
+		changes += len(planned.Changes)
+	}
+	fmt.Fprintf(os.Stderr, "Planned %d change(s) in %d file(s), written to %s\n", changes, len(plan.Files), output)
+	return nil
+}
+
+func handleApply(args []string, dryRun bool) error {
+	flags, args, err := parseCommandFlags(args, []string{"yes"}, nil)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("apply needs exactly one plan file")
+	}
+	content, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read plan: %w", err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(content, &plan); err != nil {
+		return fmt.Errorf("invalid plan %s: %w", args[0], err)
+	}
+
+	// Verify every file before writing any, so a stale plan changes nothing
+	var changed, paths []string
+	for _, planned := range plan.Files {
+		hash, _, err := fileHash(planned.Path)
+		if err != nil {
+			return err
+		}
+		if hash != planned.SHA256 {
+			changed = append(changed, planned.Path)
+		}
+		paths = append(paths, planned.Path)
+	}
+	if len(changed) > 0 {
+		return &ExitError{Code: 1, Message: fmt.Sprintf("%d file(s) changed since planning, re-run plan: %s", len(changed), strings.Join(changed, ", "))}
+	}
+	if err := confirmBulkWrite(paths, flags.has("yes"), dryRun); err != nil {
+		return err
+	}
+
+	for _, planned := range plan.Files {
+		var body string
+		if planned.Body != nil {
+			body = *planned.Body
+		} else if _, body, err = readFileContent(planned.Path); err != nil {
+			return err
+		}
+		if planned.SHA256 == "" && !dryRun {
+			if err := os.MkdirAll(filepath.Dir(planned.Path), 0755); err != nil {
+				return fmt.Errorf("failed to create directory for %s: %w", planned.Path, err)
+			}
+		}
+		if err := writeFileContent(planned.Path, planned.Frontmatter, body, dryRun); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func handleGitMeta(args []string, dryRun bool) error {
+	flags, paths, err := parseCommandFlags(args,
+		slices.Concat([]string{"lastmod-from-log", "authors-from-log", "contributors-from-log"}, bulkBoolFlags, walkBoolFlags),
+		slices.Concat([]string{"lastmod-key", "authors-key", "contributors-key"}, bulkValueFlags, walkValueFlags),
+	)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for git-meta")
+	}
+
+	withLastmod := flags.has("lastmod-from-log")
+	withAuthors := flags.has("authors-from-log")
+	withContributors := flags.has("contributors-from-log")
+	if !withLastmod && !withAuthors && !withContributors {
+		return fmt.Errorf("git-meta needs at least one of --lastmod-from-log, --authors-from-log, --contributors-from-log")
+	}
+	lastmodKey := flags.get("lastmod-key", "lastmod")
+	authorsKey := flags.get("authors-key", "authors")
+	contributorsKey := flags.get("contributors-key", "contributors")
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	return runBulkWrite(files, flags, dryRun, func(filePath string) error {
+		dates, authors, err := gitLogForFile(filePath)
+		if err != nil {
+			return err
+		}
+		if len(dates) == 0 {
+			// Untracked files have no history to take metadata from
+			fmt.Fprintf(os.Stderr, "Warning: %s has no git history, skipping\n", filePath)
+			return nil
+		}
+
+		_, err = updateFileFrontmatter(filePath, dryRun, func(data map[string]any) error {
+			if withLastmod {
+				if err := setValueByPath(data, lastmodKey, dates[0]); err != nil {
+					return err
+				}
+			}
+			if withAuthors {
+				if err := setValueByPath(data, authorsKey, uniqueStrings(authors)); err != nil {
+					return err
+				}
+			}
+			if withContributors {
+				existing, _ := getValueByPath(data, contributorsKey)
+				if err := setValueByPath(data, contributorsKey, mergeIntoList(existing, authors)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return err
+	})
+}
+
+func handleCompute(args []string, dryRun bool) error {
+	flags, paths, err := parseCommandFlags(args, slices.Concat([]string{"detect-lang"}, bulkBoolFlags, walkBoolFlags), slices.Concat([]string{"lang-key"}, bulkValueFlags, walkValueFlags))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for compute")
+	}
+	if !flags.has("detect-lang") {
+		return fmt.Errorf("compute needs at least one computation, e.g. --detect-lang")
+	}
+	langKey := flags.get("lang-key", "lang")
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	return runBulkWrite(files, flags, dryRun, func(filePath string) error {
+		_, bodyString, err := readFileContent(filePath)
+		if err != nil {
+			return err
+		}
+
+		_, err = updateFileFrontmatter(filePath, dryRun, func(data map[string]any) error {
+			if !flags.has("force") {
+				for _, key := range []string{"lang", "language", langKey} {
+					if _, found := getValueByPath(data, key); found {
+						return nil
+					}
+				}
+			}
+			lang := detectLanguage(bodyString)
+			if lang == "" {
+				fmt.Fprintf(os.Stderr, "Warning: could not detect language of %s\n", filePath)
+				return nil
+			}
+			return setValueByPath(data, langKey, lang)
+		})
+		return err
+	})
+}
+
+// detectLanguage guesses the ISO 639-1 code of text by counting stopwords.
+// It returns an empty string when the text is too short or ambiguous.
+func detectLanguage(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	counts := make(map[string]int)
+	for _, word := range words {
+		counts[word]++
+	}
+
+	best, bestScore, secondScore := "", 0, 0
+	for lang, stopwords := range languageStopwords {
+		score := 0
+		for _, stopword := range stopwords {
+			score += counts[stopword]
+		}
+		if score > bestScore || score == bestScore && lang < best {
+			best, bestScore, secondScore = lang, score, bestScore
+		} else if score > secondScore {
+			secondScore = score
+		}
+	}
+
+	// Require a handful of hits and a clear winner
+	if bestScore < 3 || bestScore == secondScore {
+		return ""
+	}
+	return best
+}
+
+func handleIDs(args []string, dryRun bool) error {
+	if len(args) < 1 || args[0] != "assign" {
+		return fmt.Errorf("ids needs a subcommand: assign")
+	}
+
+	flags, paths, err := parseCommandFlags(args[1:], append([]string{"yes"}, walkBoolFlags...), append([]string{"key", "format", "state"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for ids assign")
+	}
+	key := flags.get("key", "id")
+	format := flags.get("format", "uuid")
+	if format == "seq" {
+		format = "sequence"
+	}
+	statePath := flags.get("state", "")
+	if statePath != "" && format != "sequence" {
+		return fmt.Errorf("--state only applies to --format seq")
+	}
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+	if err := confirmBulkWrite(files, flags.has("yes"), dryRun); err != nil {
+		return err
+	}
+
+	// Read every file first so generated IDs never collide with existing ones
+	var existing []any
+	var missing []string
+	for _, filePath := range files {
+		fmString, err := readFrontmatterBlock(filePath)
+		if err != nil {
+			return err
+		}
+		data, err := parseFrontmatter(fmString)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filePath, err)
+		}
+		if value, found := getValueByPath(data, key); found && value != nil {
+			existing = append(existing, value)
+		} else {
+			missing = append(missing, filePath)
+		}
+	}
+
+	if format == "sequence" {
+		// Number files by path so the result does not depend on argument order
+		sort.Strings(missing)
+	}
+	if statePath != "" {
+		last, err := readSequenceState(statePath)
+		if err != nil {
+			return err
+		}
+		existing = append(existing, last)
+	}
+
+	generate, err := newIDGenerator(format, existing)
+	if err != nil {
+		return err
+	}
+
+	var lastID any
+	for _, filePath := range missing {
+		_, err := updateFileFrontmatter(filePath, dryRun, func(data map[string]any) error {
+			if value, found := getValueByPath(data, key); found && value != nil {
+				return nil
+			}
+			id, err := generate()
+			if err != nil {
+				return err
+			}
+			lastID = id
+			return setValueByPath(data, key, id)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if statePath != "" && lastID != nil && !dryRun {
+		if err := os.WriteFile(statePath, []byte(fmt.Sprintf("%v\n", lastID)), 0644); err != nil {
+			return fmt.Errorf("failed to write sequence state: %w", err)
+		}
+	}
+	return nil
+}
+
+// readSequenceState returns the last number recorded in a sequence state file,
+// or 0 if the file does not exist yet
+func readSequenceState(statePath string) (int, error) {
+	content, err := os.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read sequence state: %w", err)
+	}
+	last, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid sequence state in %s: %w", statePath, err)
+	}
+	return last, nil
+}
+
+// idAlphabets are the characters used by the random identifier formats
+const (
+	crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	nanoidAlphabet    = "useandom-26T198340PX75pxJACKVERYMINDBUSHWOLF_GQZbfghjklqvwyzrict"
+)
+
+// newIDGenerator returns a function producing identifiers in the given format
+// (uuid, ulid, nanoid or sequence) that differ from every value in existing
+func newIDGenerator(format string, existing []any) (func() (any, error), error) {
+	taken := make(map[string]bool)
+	for _, value := range existing {
+		taken[fmt.Sprint(value)] = true
+	}
+
+	if format == "sequence" {
+		next := 1
+		for _, value := range existing {
+			if n, ok := value.(uint64); ok && int(n) >= next {
+				next = int(n) + 1
+			}
+			if n, ok := value.(int64); ok && int(n) >= next {
+				next = int(n) + 1
+			}
+			if n, ok := value.(int); ok && n >= next {
+				next = n + 1
+			}
+		}
+		return func() (any, error) {
+			id := next
+			next++
+			return id, nil
+		}, nil
+	}
+
+	var random func() (string, error)
+	switch format {
+	case "uuid":
+		random = newUUID
+	case "ulid":
+		random = newULID
+	case "nanoid":
+		random = newNanoID
+	default:
+		return nil, fmt.Errorf("unknown id format %q (want uuid, ulid, nanoid or seq)", format)
+	}
+	return func() (any, error) {
+		for {
+			id, err := random()
+			if err != nil {
+				return nil, err
+			}
+			if !taken[id] {
+				taken[id] = true
+				return id, nil
+			}
+		}
+	}, nil
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate uuid: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	encoded := hex.EncodeToString(b[:])
+	return encoded[:8] + "-" + encoded[8:12] + "-" + encoded[12:16] + "-" + encoded[16:20] + "-" + encoded[20:], nil
+}
+
+// newULID returns a ULID: a 48-bit millisecond timestamp followed by 80 random
+// bits, written as 26 Crockford base32 characters
+func newULID() (string, error) {
+	var b [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", fmt.Errorf("failed to generate ulid: %w", err)
+	}
+
+	// 128 bits are encoded as 26 characters of 5 bits, the first one carrying only 3
+	out := make([]byte, 26)
+	hi := uint64(b[0])<<56 | uint64(b[1])<<48 | uint64(b[2])<<40 | uint64(b[3])<<32 | uint64(b[4])<<24 | uint64(b[5])<<16 | uint64(b[6])<<8 | uint64(b[7])
+	lo := uint64(b[8])<<56 | uint64(b[9])<<48 | uint64(b[10])<<40 | uint64(b[11])<<32 | uint64(b[12])<<24 | uint64(b[13])<<16 | uint64(b[14])<<8 | uint64(b[15])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out), nil
+}
+
+// newNanoID returns a 21 character URL-safe random identifier
+func newNanoID() (string, error) {
+	b := make([]byte, 21)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate nanoid: %w", err)
+	}
+	for i := range b {
+		b[i] = nanoidAlphabet[b[i]&63]
+	}
+	return string(b), nil
+}
+
+func handleRemove(args []string, dryRun bool) error {
+	flags, args, err := parseCommandFlags(args, append(bulkBoolFlags, walkBoolFlags...), append(bulkValueFlags, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	// Leading key=value arguments name the values, the rest are files and directories
+	var pairs [][2]string
+	for len(args) > 0 {
+		key, value, found := strings.Cut(args[0], "=")
+		if !found {
+			break
+		}
+		pairs = append(pairs, [2]string{key, value})
+		args = args[1:]
+	}
+	if len(pairs) == 0 || len(args) == 0 {
+		return fmt.Errorf("remove needs at least one key=value pair and a file or directory")
+	}
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(args, opts)
+	if err != nil {
+		return err
+	}
+
+	return runBulkWrite(files, flags, dryRun, func(filePath string) error {
+		_, err := updateFileFrontmatter(filePath, dryRun, func(data map[string]any) error {
+			for _, pair := range pairs {
+				existing, found := getValueByPath(data, pair[0])
+				if !found {
+					continue
+				}
+				list, isList := existing.([]any)
+				if !isList {
+					fmt.Fprintf(os.Stderr, "Warning: %s: %s is not a list, skipping\n", filePath, pair[0])
+					continue
+				}
+				// Values are compared as text so tags=2024 also removes the number 2024
+				kept := slices.DeleteFunc(slices.Clone(list), func(item any) bool {
+					switch item.(type) {
+					case map[string]any, []any:
+						return false
+					}
+					return fmt.Sprint(item) == pair[1]
+				})
+				if len(kept) == len(list) {
+					continue
+				}
+				if err := setValueByPath(data, pair[0], kept); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return err
+	})
+}
+
+func handleDedupe(args []string, dryRun bool) error {
+	flags, args, err := parseCommandFlags(args, append(bulkBoolFlags, walkBoolFlags...), append(bulkValueFlags, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	return updateLists("dedupe", args, flags, dryRun, func(list []any) ([]any, error) {
+		// Scalars are compared as text like in remove; maps and lists are always kept
+		seen := make(map[string]bool)
+		return slices.DeleteFunc(list, func(item any) bool {
+			switch item.(type) {
+			case map[string]any, []any:
+				return false
+			}
+			text := fmt.Sprint(item)
+			duplicate := seen[text]
+			seen[text] = true
+			return duplicate
+		}), nil
+	})
+}
+
+func handleSort(args []string, dryRun bool) error {
+	flags, args, err := parseCommandFlags(args,
+		slices.Concat([]string{"numeric", "reverse"}, bulkBoolFlags, walkBoolFlags),
+		slices.Concat([]string{"by"}, bulkValueFlags, walkValueFlags),
+	)
+	if err != nil {
+		return err
+	}
+	numeric, reverse := flags.has("numeric"), flags.has("reverse")
+	by := flags.get("by", "")
+
+	return updateLists("sort", args, flags, dryRun, func(list []any) ([]any, error) {
+		// Elements without a sort key (no --by field, not a number for --numeric) keep
+		// their order after the others
+		type sortItem struct {
+			value  any
+			text   string
+			number float64
+			valid  bool
+		}
+		items := make([]sortItem, len(list))
+		for i, value := range list {
+			key := value
+			if by != "" {
+				itemMap, isMap := value.(map[string]any)
+				if !isMap {
+					return nil, fmt.Errorf("--by needs a list of maps, found %s", formatInlineValue(value))
+				}
+				key, _ = getValueByPath(itemMap, by)
+			}
+			item := sortItem{value: value}
+			switch key.(type) {
+			case nil, map[string]any, []any:
+			default:
+				item.text, item.valid = fmt.Sprint(key), true
+				if numeric {
+					number, err := strconv.ParseFloat(item.text, 64)
+					item.number, item.valid = number, err == nil
+				}
+			}
+			items[i] = item
+		}
+		slices.SortStableFunc(items, func(a, b sortItem) int {
+			if a.valid != b.valid {
+				if a.valid {
+					return -1
+				}
+				return 1
+			}
+			if !a.valid {
+				return 0
+			}
+			order := strings.Compare(a.text, b.text)
+			if numeric {
+				order = cmp.Compare(a.number, b.number)
+			}
+			if reverse {
+				order = -order
+			}
+			return order
+		})
+		sorted := make([]any, len(items))
+		for i, item := range items {
+			sorted[i] = item.value
+		}
+		return sorted, nil
+	})
+}
+
+// updateLists runs a list transformation of dedupe or sort on the given keys in every
+// file. The last argument is the file or directory; keys may hold wildcards and keys
+// that are not lists are skipped with a warning.
+func updateLists(command string, args []string, flags commandFlags, dryRun bool, transform func(list []any) ([]any, error)) error {
+	if len(args) < 2 {
+		return fmt.Errorf("%s needs at least one key and a file or directory", command)
+	}
+	keys := args[:len(args)-1]
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(args[len(args)-1:], opts)
+	if err != nil {
+		return err
+	}
+	return runBulkWrite(files, flags, dryRun, func(filePath string) error {
+		_, err := updateFileFrontmatter(filePath, dryRun, func(data map[string]any) error {
+			for _, key := range keys {
+				for _, target := range expandKeyPath(data, key) {
+					existing, found := getValueByPath(data, target)
+					if !found {
+						continue
+					}
+					list, isList := existing.([]any)
+					if !isList {
+						fmt.Fprintf(os.Stderr, "Warning: %s: %s is not a list, skipping\n", filePath, target)
+						continue
+					}
+					updated, err := transform(slices.Clone(list))
+					if err != nil {
+						return fmt.Errorf("%s: %w", target, err)
+					}
+					if err := setValueByPath(data, target, updated); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		return err
+	})
+}
+
+func handleInsert(args []string, dryRun bool) error {
+	if len(args) < 2 {
+		return fmt.Errorf("insert needs at least one key[index]=value pair and a file")
+	}
+	filePath := args[len(args)-1]
+
+	type insertion struct {
+		listPath string
+		index    int
+		value    any
+	}
+	var insertions []insertion
+	for _, arg := range args[:len(args)-1] {
+		key, value, found := cutAssignment(arg)
+		open := strings.LastIndex(key, "[")
+		if !found || open <= 0 || !strings.HasSuffix(key, "]") {
+			return fmt.Errorf("invalid insert argument %q: expected key[index]=value, e.g. menu.items[2]='{name: Blog}'", arg)
+		}
+		index, err := strconv.Atoi(key[open+1 : len(key)-1])
+		if err != nil {
+			return fmt.Errorf("invalid index in %q: %w", key, err)
+		}
+		insertions = append(insertions, insertion{key[:open], index, parseSetValue(value)})
+	}
+
+	_, err := updateFileFrontmatter(filePath, dryRun, func(data map[string]any) error {
+		for _, ins := range insertions {
+			for _, target := range expandKeyPath(data, ins.listPath) {
+				existing, _ := getValueByPath(data, target)
+				list, isList := existing.([]any)
+				if existing != nil && !isList {
+					return fmt.Errorf("cannot insert into '%s': it is not a list", target)
+				}
+				// Negative indices count from the end; the length itself appends
+				index := ins.index
+				if index < 0 {
+					index += len(list)
+				}
+				if index < 0 || index > len(list) {
+					return fmt.Errorf("index %d is out of range for '%s' (length %d)", ins.index, target, len(list))
+				}
+				if err := setValueByPath(data, target, slices.Insert(slices.Clone(list), index, ins.value)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func handleGrep(args []string) error {
+	flags, paths, err := parseCommandFlags(args, append([]string{"ignore-case", "show-secrets"}, walkBoolFlags...), append([]string{"key", "regex", "redact"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for grep")
+	}
+	if !flags.has("regex") {
+		return fmt.Errorf("grep needs --regex")
+	}
+	expression := flags.get("regex", "")
+	if flags.has("ignore-case") {
+		expression = "(?i)" + expression
+	}
+	pattern, err := regexp.Compile(expression)
+	if err != nil {
+		return fmt.Errorf("invalid --regex: %w", err)
+	}
+	keyGlob := strings.ReplaceAll(flags.get("key", "**"), ".", "/")
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	matches := 0
+	for _, filePath := range files {
+		data, err := readFrontmatterData(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", filePath, err)
+			continue
+		}
+		if data, err = redactForOutput(filePath, data, flags); err != nil {
+			return err
+		}
+		walkLeaves("", nil, data, func(keyPath string, segments []string, value any) {
+			text := fmt.Sprint(value)
+			if _, isString := value.(string); !isString {
+				text = formatInlineValue(normalizeJSONValue(value))
+			}
+			if matchGlobSegments(strings.Split(keyGlob, "/"), segments) && pattern.MatchString(text) {
+				fmt.Printf("%s:%s: %s\n", filePath, keyPath, text)
+				matches++
+			}
+		})
+	}
+	if matches == 0 {
+		return &ExitError{Code: 2, Message: "no matches"}
+	}
+	return nil
+}
+
+func handleSearch(args []string) error {
+	flags, args, err := parseCommandFlags(args, walkBoolFlags, slices.Concat([]string{"near", "within", "bbox", "geo-key"}, walkValueFlags))
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		return fmt.Errorf("search needs a query")
+	}
+	query, err := resolveQuery(args[0])
+	if err != nil {
+		return err
+	}
+	geo, err := geoFilterFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	paths := args[1:]
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+	matching, err := filterWhere(files, query)
+	if err != nil {
+		return err
+	}
+	if geo != nil {
+		matching = geo.apply(matching)
+	}
+	for _, filePath := range matching {
+		fmt.Println(filePath)
+	}
+	if len(matching) == 0 {
+		return &ExitError{Code: 2, Message: "no matches"}
+	}
+	return nil
+}
+
+// walkLeaves calls visit for every scalar below value, in key order, with its key path
+// as get accepts it (list elements as [N]) and the path's segments for glob matching
+func walkLeaves(keyPath string, segments []string, value any, visit func(keyPath string, segments []string, value any)) {
+	switch v := value.(type) {
+	case nil:
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			walkLeaves(joinKeyPath(keyPath, key), append(slices.Clip(segments), key), v[key], visit)
+		}
+	case []any:
+		for i, item := range v {
+			walkLeaves(fmt.Sprintf("%s[%d]", keyPath, i), append(slices.Clip(segments), strconv.Itoa(i)), item, visit)
+		}
+	default:
+		visit(keyPath, segments, v)
+	}
+}
+
+func handleStale(args []string, dryRun bool) error {
+	flags, paths, err := parseCommandFlags(args, append([]string{"mark", "yes"}, walkBoolFlags...), append([]string{"key", "older-than", "mark-key"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for stale")
+	}
+	if !flags.has("older-than") {
+		return fmt.Errorf("stale needs --older-than, e.g. --older-than 180d")
+	}
+	maxAge, err := parseAge(flags.get("older-than", ""))
+	if err != nil {
+		return fmt.Errorf("invalid --older-than value: %w", err)
+	}
+	key := flags.get("key", "lastmod")
+	markKey := flags.get("mark-key", "needs_review")
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	var stale []string
+	for _, filePath := range files {
+		data, err := readFrontmatterData(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", filePath, err)
+			continue
+		}
+
+		value, found := getValueByPath(data, key)
+		date, valid := parseDateValue(value)
+		switch {
+		case !found || value == nil:
+			fmt.Printf("%s: %s missing\n", filePath, key)
+		case !valid:
+			fmt.Printf("%s: %s is not a date: %v\n", filePath, key, value)
+		case date.Before(cutoff):
+			fmt.Printf("%s: %s %s (%d days old)\n", filePath, key, date.Format(time.DateOnly), int(time.Since(date).Hours()/24))
+		default:
+			continue
+		}
+		stale = append(stale, filePath)
+	}
+
+	if !flags.has("mark") {
+		return nil
+	}
+	if err := confirmBulkWrite(stale, flags.has("yes"), dryRun); err != nil {
+		return err
+	}
+	for _, filePath := range stale {
+		_, err := updateFileFrontmatter(filePath, dryRun, func(data map[string]any) error {
+			return setValueByPath(data, markKey, true)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func handleSuggest(args []string, dryRun bool) error {
+	if len(args) < 1 || args[0] != "related" {
+		return fmt.Errorf("suggest needs a subcommand: related")
+	}
+
+	flags, args, err := parseCommandFlags(args[1:], append([]string{"write"}, walkBoolFlags...), append([]string{"by", "top", "in", "related-key"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one file must be specified for suggest related")
+	}
+	filePath := args[0]
+	byKeys := strings.Split(flags.get("by", "tags"), ",")
+	top, err := strconv.Atoi(flags.get("top", "5"))
+	if err != nil || top < 1 {
+		return fmt.Errorf("invalid --top value: %s", flags.get("top", ""))
+	}
+
+	root, err := projectRootDir()
+	if err != nil {
+		return err
+	}
+	corpus := flags["in"]
+	if len(corpus) == 0 {
+		corpus = []string{root}
+	}
+	// Candidates are shown and written relative to the config directory, or to the
+	// working directory without a config
+	display := func(candidate string) string {
+		absPath, err := filepath.Abs(candidate)
+		if err != nil {
+			return filepath.ToSlash(candidate)
+		}
+		relPath, err := filepath.Rel(root, absPath)
+		if err != nil {
+			return filepath.ToSlash(candidate)
+		}
+		return filepath.ToSlash(relPath)
+	}
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(corpus, opts)
+	if err != nil {
+		return err
+	}
+
+	targetFm, err := readFrontmatterBlock(filePath)
+	if err != nil {
+		return err
+	}
+	target, err := parseFrontmatter(targetFm)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filePath, err)
+	}
+	targetPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+
+	// Inverted index from each key/value pair to the files carrying it
+	index := make(map[string][]string)
+	for _, candidate := range files {
+		if candidatePath, err := filepath.Abs(candidate); err == nil && candidatePath == targetPath {
+			continue
+		}
+		data, err := readFrontmatterData(candidate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", candidate, err)
+			continue
+		}
+		for _, term := range relatedTerms(data, byKeys) {
+			index[term] = append(index[term], candidate)
+		}
+	}
+
+	scores := make(map[string]int)
+	for _, term := range relatedTerms(target, byKeys) {
+		for _, candidate := range index[term] {
+			scores[candidate]++
+		}
+	}
+	ranked := sortedKeys(scores)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i]] > scores[ranked[j]]
+	})
+	if len(ranked) > top {
+		ranked = ranked[:top]
+	}
+
+	if !flags.has("write") {
+		for _, candidate := range ranked {
+			fmt.Printf("%d  %s\n", scores[candidate], display(candidate))
+		}
+		return nil
+	}
+
+	related := make([]any, 0, len(ranked))
+	for _, candidate := range ranked {
+		related = append(related, display(candidate))
+	}
+	_, err = updateFileFrontmatter(filePath, dryRun, func(data map[string]any) error {
+		return setValueByPath(data, flags.get("related-key", "related"), related)
+	})
+	return err
+}
+
+// relatedTerms lists the distinct values of keys in data as "key=value" terms;
+// list values contribute each element and strings are compared case-insensitively
+func relatedTerms(data map[string]any, keys []string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		value, found := getValueByPath(data, key)
+		if !found {
+			continue
+		}
+		values, isList := value.([]any)
+		if !isList {
+			values = []any{value}
+		}
+		for _, v := range values {
+			if v == nil {
+				continue
+			}
+			term := key + "=" + strings.ToLower(strings.TrimSpace(fmt.Sprint(v)))
+			if !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
+
+// GraphNode is a file (or a referenced file missing from the corpus) in a graph export
+type GraphNode struct {
+	ID      string `json:"id"`
+	Title   string `json:"title,omitempty"`
+	Missing bool   `json:"missing,omitempty"`
+}
+
+// GraphEdge is a reference from one file to another through a frontmatter key
+type GraphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Key    string `json:"key"`
+}
+
+// Graph is the node/edge export of the corpus
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+func handleGraph(args []string) error {
+	flags, paths, err := parseCommandFlags(args, walkBoolFlags, append([]string{"edges", "format"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for graph")
+	}
+	edgeKeys := strings.Split(flags.get("edges", "related"), ",")
+	format := flags.get("format", "dot")
+	if format != "dot" && format != "json" {
+		return fmt.Errorf("unknown graph format %q (want dot or json)", format)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	graph, err := buildGraph(config, files, edgeKeys)
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(graph); err != nil {
+			return fmt.Errorf("failed to encode graph: %w", err)
+		}
+		return nil
+	}
+
+	fmt.Println("digraph frontmatter {")
+	for _, node := range graph.Nodes {
+		label := node.ID
+		if node.Title != "" {
+			label = node.Title
+		}
+		attrs := []string{"label=" + strconv.Quote(label)}
+		if node.Missing {
+			attrs = append(attrs, "style=dashed")
+		}
+		fmt.Printf("  %s [%s];\n", strconv.Quote(node.ID), strings.Join(attrs, ", "))
+	}
+	for _, edge := range graph.Edges {
+		fmt.Printf("  %s -> %s [label=%s];\n", strconv.Quote(edge.Source), strconv.Quote(edge.Target), strconv.Quote(edge.Key))
+	}
+	fmt.Println("}")
+	return nil
+}
+
+// buildGraph makes a node for every file and an edge for every value of edgeKeys.
+// References are resolved as paths relative to the project root or to the
+// referencing file (the extension may be left out), or as id or slug values.
+func buildGraph(config *Config, files []string, edgeKeys []string) (*Graph, error) {
+	graph := &Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	frontmatters := make(map[string]map[string]any)
+	aliases := make(map[string]string)
+	var ids []string
+
+	for _, filePath := range files {
+		data, err := readFrontmatterData(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", filePath, err)
+			continue
+		}
+
+		id := config.relativeToConfig(filePath)
+		ids = append(ids, id)
+		frontmatters[id] = data
+		aliases[id] = id
+		aliases[strings.TrimSuffix(id, path.Ext(id))] = id
+		for _, key := range []string{"id", "slug"} {
+			if value, found := data[key]; found && value != nil {
+				aliases[fmt.Sprint(value)] = id
+			}
+		}
+
+		node := GraphNode{ID: id}
+		if title, ok := data["title"].(string); ok {
+			node.Title = title
+		}
+		graph.Nodes = append(graph.Nodes, node)
+	}
+
+	missing := make(map[string]bool)
+	for _, source := range ids {
+		for _, key := range edgeKeys {
+			value, found := getValueByPath(frontmatters[source], key)
+			if !found {
+				continue
+			}
+			references, isList := value.([]any)
+			if !isList {
+				references = []any{value}
+			}
+			for _, reference := range references {
+				if reference == nil {
+					continue
+				}
+				target := resolveReference(aliases, source, fmt.Sprint(reference))
+				if _, known := frontmatters[target]; !known && !missing[target] {
+					missing[target] = true
+					graph.Nodes = append(graph.Nodes, GraphNode{ID: target, Missing: true})
+				}
+				graph.Edges = append(graph.Edges, GraphEdge{Source: source, Target: target, Key: key})
+			}
+		}
+	}
+	return graph, nil
+}
+
+// resolveReference maps a reference found in source to a node ID, returning the
+// reference itself when no file matches
+func resolveReference(aliases map[string]string, source, reference string) string {
+	reference = strings.TrimSpace(reference)
+	candidates := []string{
+		reference,
+		strings.TrimPrefix(reference, "/"),
+		path.Join(path.Dir(source), reference),
+	}
+	for _, candidate := range candidates {
+		if id, ok := aliases[candidate]; ok {
+			return id
+		}
+		if id, ok := aliases[strings.TrimSuffix(candidate, path.Ext(candidate))]; ok {
+			return id
+		}
+	}
+	return reference
+}
+
+// Board is the output of the board command: one column per value of the group key
+type Board struct {
+	GroupBy string        `json:"group_by"`
+	Columns []BoardColumn `json:"columns"`
+}
+
+// BoardColumn holds the cards of the files sharing one group value
+type BoardColumn struct {
+	Name  string      `json:"name"`
+	Cards []BoardCard `json:"cards"`
+}
+
+// BoardCard is one file with the values of the requested fields
+type BoardCard struct {
+	Path   string         `json:"path"`
+	Fields map[string]any `json:"fields"`
+}
+
+// noGroupColumn collects files without the group key; it is always the last column
+const noGroupColumn = "(none)"
+
+// maxBoardColumnWidth caps the width of a column in the text board
+const maxBoardColumnWidth = 40
+
+func handleBoard(args []string) error {
+	flags, paths, err := parseCommandFlags(args, append([]string{"json", "show-secrets"}, walkBoolFlags...), append([]string{"group-by", "fields", "columns", "redact"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for board")
+	}
+	groupBy := flags.get("group-by", "status")
+	fields, err := listFields(flags, "title")
+	if err != nil {
+		return err
+	}
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	cards := make(map[string][]BoardCard)
+	for _, filePath := range files {
+		data, err := readFrontmatterData(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", filePath, err)
+			continue
+		}
+		if data, err = redactForOutput(filePath, data, flags); err != nil {
+			return err
+		}
+		column := noGroupColumn
+		if value, found := getValueByPath(data, groupBy); found && fmt.Sprint(value) != "" {
+			column = fmt.Sprint(value)
+		}
+		card := BoardCard{Path: filePath, Fields: make(map[string]any)}
+		for _, field := range fields {
+			if value, found := getValueByPath(data, field); found {
+				card.Fields[field] = normalizeJSONValue(value)
+			}
+		}
+		cards[column] = append(cards[column], card)
+	}
+
+	// Columns named by --columns come first, even when empty, then the rest by name
+	var order []string
+	if flags.has("columns") {
+		order = strings.Split(flags.get("columns", ""), ",")
+	}
+	for _, column := range sortedKeys(cards) {
+		if column != noGroupColumn && !slices.Contains(order, column) {
+			order = append(order, column)
+		}
+	}
+	if len(cards[noGroupColumn]) > 0 {
+		order = append(order, noGroupColumn)
+	}
+	board := Board{GroupBy: groupBy, Columns: []BoardColumn{}}
+	for _, column := range order {
+		board.Columns = append(board.Columns, BoardColumn{Name: column, Cards: append([]BoardCard{}, cards[column]...)})
+	}
+
+	if flags.has("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(board); err != nil {
+			return fmt.Errorf("failed to encode board: %w", err)
+		}
+		return nil
+	}
+	printBoard(board, fields)
+	return nil
+}
+
+// printBoard lays the columns out side by side. A card shows its field values joined
+// by " · ", falling back to the file name when none of the fields is set.
+func printBoard(board Board, fields []string) {
+	cells := make([][]string, len(board.Columns))
+	widths := make([]int, len(board.Columns))
+	rows := 0
+	for i, column := range board.Columns {
+		cells[i] = append(cells[i], fmt.Sprintf("%s (%d)", column.Name, len(column.Cards)))
+		for _, card := range column.Cards {
+			var parts []string
+			for _, field := range fields {
+				if value, found := card.Fields[field]; found {
+					parts = append(parts, formatBoardValue(value))
+				}
+			}
+			if len(parts) == 0 {
+				parts = []string{filepath.Base(card.Path)}
+			}
+			cells[i] = append(cells[i], truncateRunes(strings.Join(parts, " · "), maxBoardColumnWidth))
+		}
+		for _, cell := range cells[i] {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+		rows = max(rows, len(cells[i]))
+	}
+
+	for row := 0; row < rows; row++ {
+		var line []string
+		last := 0
+		for i := range board.Columns {
+			cell := ""
+			if row < len(cells[i]) {
+				cell, last = cells[i][row], i
+			}
+			line = append(line, cell+strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)))
+		}
+		// Empty cells after the last card of a row are left out
+		fmt.Println(strings.TrimRight(strings.Join(line[:last+1], " | "), " "))
+		if row == 0 {
+			var rule []string
+			for _, width := range widths {
+				rule = append(rule, strings.Repeat("-", width))
+			}
+			fmt.Println(strings.Join(rule, "-+-"))
+		}
+	}
+}
+
+// formatBoardValue prints lists as comma-separated values
+func formatBoardValue(value any) string {
+	if list, ok := value.([]any); ok {
+		return strings.Join(exportStrings(list), ", ")
+	}
+	return fmt.Sprint(value)
+}
+
+// truncateRunes shortens text to at most limit runes, ending it with an ellipsis
+func truncateRunes(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+func handleStats(args []string) error {
+	flags, paths, err := parseCommandFlags(args, append([]string{"show-secrets"}, walkBoolFlags...), append([]string{"key", "redact"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for stats")
+	}
+	keys := flags["key"]
+	if len(keys) == 0 {
+		return fmt.Errorf("stats needs at least one --key")
+	}
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string][]any)
+	for _, filePath := range files {
+		data, err := readFrontmatterData(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", filePath, err)
+			continue
+		}
+		if data, err = redactForOutput(filePath, data, flags); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if value, found := getValueByPath(data, key); found && value != nil {
+				values[key] = append(values[key], value)
+			}
+		}
+	}
+
+	for i, key := range keys {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s: %d of %d files\n", key, len(values[key]), len(files))
+		printKeyStats(values[key])
+	}
+	return nil
+}
+
+// printKeyStats prints min/max/mean when every value is a number, a monthly
+// histogram when every value is a date, and the most common values otherwise
+func printKeyStats(values []any) {
+	if len(values) == 0 {
+		return
+	}
+
+	numbers := make([]float64, 0, len(values))
+	for _, value := range values {
+		switch v := value.(type) {
+		case int:
+			numbers = append(numbers, float64(v))
+		case int64:
+			numbers = append(numbers, float64(v))
+		case uint64:
+			numbers = append(numbers, float64(v))
+		case float64:
+			numbers = append(numbers, v)
+		}
+	}
+	if len(numbers) == len(values) {
+		lowest, highest, sum := numbers[0], numbers[0], 0.0
+		for _, n := range numbers {
+			lowest = min(lowest, n)
+			highest = max(highest, n)
+			sum += n
+		}
+		fmt.Printf("  min %s  max %s  mean %s\n", formatStat(lowest), formatStat(highest), formatStat(sum/float64(len(numbers))))
+		return
+	}
+
+	months := make(map[string]int)
+	for _, value := range values {
+		date, ok := parseDateValue(value)
+		if !ok {
+			months = nil
+			break
+		}
+		months[date.Format("2006-01")]++
+	}
+	if months != nil {
+		// List every month of the range so gaps are visible
+		labels := sortedKeys(months)
+		first, _ := time.Parse("2006-01", labels[0])
+		last, _ := time.Parse("2006-01", labels[len(labels)-1])
+		labels = labels[:0]
+		for month := first; !month.After(last); month = month.AddDate(0, 1, 0) {
+			labels = append(labels, month.Format("2006-01"))
+		}
+		printHistogram(labels, months)
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, value := range values {
+		counts[formatInlineValue(value)]++
+	}
+	common := sortedKeys(counts)
+	sort.SliceStable(common, func(i, j int) bool { return counts[common[i]] > counts[common[j]] })
+	if len(common) > 10 {
+		common = common[:10]
+	}
+	printHistogram(common, counts)
+}
+
+// printHistogram prints one bar per label, scaled so the longest is 40 characters
+func printHistogram(labels []string, counts map[string]int) {
+	width, highest := 0, 0
+	for _, label := range labels {
+		width = max(width, len(label))
+		highest = max(highest, counts[label])
+	}
+	for _, label := range labels {
+		bar := ""
+		if counts[label] > 0 {
+			bar = strings.Repeat("#", max(1, counts[label]*40/highest)) + " "
+		}
+		fmt.Printf("  %-*s  %s%d\n", width, label, bar, counts[label])
+	}
+}
+
+// formatStat prints whole numbers without decimals and others with two
+func formatStat(n float64) string {
+	if n == float64(int64(n)) {
+		return strconv.FormatInt(int64(n), 10)
+	}
+	return strconv.FormatFloat(n, 'f', 2, 64)
+}
+
+// MissingEntry is a file listed by the missing command; Status is "none" when the
+// file has no frontmatter block and "empty" when the block holds no keys
+type MissingEntry struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
+func handleMissing(args []string) error {
+	flags, paths, err := parseCommandFlags(args, append([]string{"json"}, walkBoolFlags...), append([]string{"output"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for missing")
+	}
+	asJSON, err := jsonOutput(flags)
+	if err != nil {
+		return err
+	}
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	entries := []MissingEntry{}
+	for _, filePath := range files {
+		info, err := readFrontmatterInfo(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", filePath, err)
+			continue
+		}
+		if !info.HasFM {
+			entries = append(entries, MissingEntry{filePath, "none"})
+			continue
+		}
+		data, err := parseFrontmatter(info.Content)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", filePath, err)
+			continue
+		}
+		if len(data) == 0 {
+			entries = append(entries, MissingEntry{filePath, "empty"})
+		}
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(entries); err != nil {
+			return fmt.Errorf("failed to encode missing files: %w", err)
+		}
+	} else {
+		for _, entry := range entries {
+			fmt.Printf("%-5s  %s\n", entry.Status, entry.Path)
+		}
+	}
+	if len(entries) > 0 {
+		return &ExitError{Code: 1, Message: fmt.Sprintf("%d of %d file(s) without frontmatter", len(entries), len(files))}
+	}
+	return nil
+}
+
+// ScheduledEntry is a file listed by the scheduled command
+type ScheduledEntry struct {
+	Path   string    `json:"path"`
+	Status string    `json:"status"`
+	Date   time.Time `json:"date"`
+}
+
+func handleScheduled(args []string) error {
+	flags, paths, err := parseCommandFlags(args, append([]string{"json"}, walkBoolFlags...), append([]string{"date-key", "expiry-key"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for scheduled")
+	}
+	dateKey := flags.get("date-key", "date")
+	expiryKey := flags.get("expiry-key", "expiryDate")
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	entries := []ScheduledEntry{}
+	for _, filePath := range files {
+		data, err := readFrontmatterData(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", filePath, err)
+			continue
+		}
+
+		if value, found := getValueByPath(data, dateKey); found {
+			if date, ok := parseDateValue(value); ok && date.After(now) {
+				entries = append(entries, ScheduledEntry{filePath, "scheduled", date})
+			}
+		}
+		if value, found := getValueByPath(data, expiryKey); found {
+			if date, ok := parseDateValue(value); ok && !date.After(now) {
+				entries = append(entries, ScheduledEntry{filePath, "expired", date})
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date.Before(entries[j].Date)
+	})
+
+	if flags.has("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(entries); err != nil {
+			return fmt.Errorf("failed to encode scheduled files: %w", err)
+		}
+		return nil
+	}
+	for _, entry := range entries {
+		fmt.Printf("%s  %-9s  %s\n", entry.Date.Format(time.DateOnly), entry.Status, entry.Path)
+	}
+	return nil
+}
+
+// dateLayouts are the formats parseDateValue accepts, most specific first
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	time.DateOnly,
+}
+
+// parseDateValue interprets a frontmatter value as a date or timestamp. Values
+// without a time zone are read as UTC.
+func parseDateValue(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		text := strings.TrimSpace(v)
+		for _, layout := range dateLayouts {
+			if date, err := time.Parse(layout, text); err == nil {
+				return date, true
+			}
+		}
+		return parseMonthNameDate(text)
+	}
+	return time.Time{}, false
+}
+
+// monthNames lists the spellings of the twelve months per locale in lower case.
+// Polish dates use the genitive ("1 maja 2023"), so both forms are listed there.
+var monthNames = map[string][12][]string{
+	"en": {{"january"}, {"february"}, {"march"}, {"april"}, {"may"}, {"june"}, {"july"}, {"august"}, {"september", "sept"}, {"october"}, {"november"}, {"december"}},
+	"de": {{"januar", "jänner"}, {"februar"}, {"märz"}, {"april"}, {"mai"}, {"juni"}, {"juli"}, {"august"}, {"september"}, {"oktober"}, {"november"}, {"dezember"}},
+	"es": {{"enero"}, {"febrero"}, {"marzo"}, {"abril"}, {"mayo"}, {"junio"}, {"julio"}, {"agosto"}, {"septiembre", "setiembre"}, {"octubre"}, {"noviembre"}, {"diciembre"}},
+	"fr": {{"janvier"}, {"février"}, {"mars"}, {"avril"}, {"mai"}, {"juin"}, {"juillet"}, {"août"}, {"septembre"}, {"octobre"}, {"novembre"}, {"décembre"}},
+	"it": {{"gennaio"}, {"febbraio"}, {"marzo"}, {"aprile"}, {"maggio"}, {"giugno"}, {"luglio"}, {"agosto"}, {"settembre"}, {"ottobre"}, {"novembre"}, {"dicembre"}},
+	"nl": {{"januari"}, {"februari"}, {"maart"}, {"april"}, {"mei"}, {"juni"}, {"juli"}, {"augustus"}, {"september"}, {"oktober"}, {"november"}, {"december"}},
+	"pl": {{"styczeń", "stycznia"}, {"luty", "lutego"}, {"marzec", "marca"}, {"kwiecień", "kwietnia"}, {"maj", "maja"}, {"czerwiec", "czerwca"}, {"lipiec", "lipca"}, {"sierpień", "sierpnia"}, {"wrzesień", "września"}, {"październik", "października"}, {"listopad", "listopada"}, {"grudzień", "grudnia"}},
+	"pt": {{"janeiro"}, {"fevereiro"}, {"março"}, {"abril"}, {"maio"}, {"junho"}, {"julho"}, {"agosto"}, {"setembro"}, {"outubro"}, {"novembro"}, {"dezembro"}},
+}
+
+// dateLocales are the locales whose month names dates may use besides English, set by
+// --locale or else read from the config's locales on first use
+var (
+	dateLocales       []string
+	dateLocalesLoaded bool
+)
+
+// activeDateLocales returns English followed by the configured locales
+func activeDateLocales() []string {
+	if !dateLocalesLoaded {
+		dateLocalesLoaded = true
+		if config, err := loadConfig(); err == nil {
+			dateLocales = config.Locales
+		}
+	}
+	return append([]string{"en"}, dateLocales...)
+}
+
+// setDateLocales sets the locales of --locale, a comma-separated list
+func setDateLocales(value string) error {
+	for _, locale := range strings.Split(value, ",") {
+		locale = strings.ToLower(strings.TrimSpace(locale))
+		if _, ok := monthNames[locale]; !ok {
+			return fmt.Errorf("unknown locale %q, expected one of %s", locale, strings.Join(sortedKeys(monthNames), ", "))
+		}
+		dateLocales = append(dateLocales, locale)
+	}
+	dateLocalesLoaded = true
+	return nil
+}
+
+// monthNameDateWords are words dates may contain around the day, month and year
+var monthNameDateWords = []string{"de", "del", "of", "the", "r."}
+
+// parseMonthNameDate reads dates that spell out the month, day first or month first,
+// such as "1 maja 2023", "5. März 2021", "5 de marzo de 2021" or "March 5th, 2021".
+// Months may be abbreviated to any unambiguous prefix of three or more letters.
+func parseMonthNameDate(text string) (time.Time, bool) {
+	var fields []string
+	for _, field := range strings.Fields(strings.ToLower(strings.ReplaceAll(text, ",", " "))) {
+		if !slices.Contains(monthNameDateWords, field) {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) != 3 {
+		return time.Time{}, false
+	}
+
+	for _, order := range [][3]int{{0, 1, 2}, {1, 0, 2}} {
+		day, month, year := fields[order[0]], fields[order[1]], fields[order[2]]
+		dayNumber, ok := parseDayOfMonth(day)
+		if !ok {
+			continue
+		}
+		yearNumber, err := strconv.Atoi(strings.TrimSuffix(year, "."))
+		if err != nil || len(year) < 4 {
+			continue
+		}
+		monthNumber, ok := lookupMonth(strings.TrimSuffix(month, "."))
+		if !ok {
+			continue
+		}
+		date := time.Date(yearNumber, time.Month(monthNumber), dayNumber, 0, 0, 0, 0, time.UTC)
+		if date.Day() != dayNumber {
+			// Day 31 of a 30-day month rolls over; that is not a real date
+			return time.Time{}, false
+		}
+		return date, true
+	}
+	return time.Time{}, false
+}
+
+// parseDayOfMonth reads a day number with an optional ordinal suffix ("5th", "1er", "5.")
+func parseDayOfMonth(text string) (int, bool) {
+	digits := strings.TrimRightFunc(text, func(r rune) bool { return !unicode.IsDigit(r) })
+	if digits == "" || len(digits) > 2 {
+		return 0, false
+	}
+	switch strings.TrimPrefix(text, digits) {
+	case "", ".", "st", "nd", "rd", "th", "er", "º", "°":
+	default:
+		return 0, false
+	}
+	day, err := strconv.Atoi(digits)
+	if err != nil || day < 1 || day > 31 {
+		return 0, false
+	}
+	return day, true
+}
+
+// lookupMonth returns the month number (1-12) of a month name in one of the active
+// locales, accepting unambiguous prefixes of at least three letters
+func lookupMonth(name string) (int, bool) {
+	for _, locale := range activeDateLocales() {
+		match := 0
+		for i, spellings := range monthNames[locale] {
+			for _, spelling := range spellings {
+				if spelling == name {
+					return i + 1, true
+				}
+				if utf8.RuneCountInString(name) >= 3 && strings.HasPrefix(spelling, name) {
+					if match != 0 && match != i+1 {
+						match = -1
+					} else if match == 0 {
+						match = i + 1
+					}
+				}
+			}
+		}
+		if match > 0 {
+			return match, true
+		}
+	}
+	return 0, false
+}
+
+// parseAge parses a duration such as 180d, 6w, 1y or any time.ParseDuration value
+func parseAge(value string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+		"y": 365 * 24 * time.Hour,
+	}
+	if len(value) > 1 {
+		if unit, ok := units[value[len(value)-1:]]; ok {
+			n, err := strconv.Atoi(value[:len(value)-1])
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("%q is not a valid age", value)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a valid age", value)
+	}
+	return age, nil
+}
+
+// durationUnits maps the unit words of duration values to their length
+var durationUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+}
+
+// durationPart matches one number and unit of a duration value such as 1h30m or 1 hour 30 min
+var durationPart = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([a-z]+)[\s,]*(?:and\s+)?`)
+
+// isoDuration matches ISO 8601 durations without years and months, such as PT1H30M
+var isoDuration = regexp.MustCompile(`^p(?:(\d+(?:\.\d+)?)d)?(?:t(?:(\d+(?:\.\d+)?)h)?(?:(\d+(?:\.\d+)?)m)?(?:(\d+(?:\.\d+)?)s)?)?$`)
+
+// parseDurationValue reads a duration written with units ("5m", "1h30m", "1 hour 30 min")
+// or in ISO 8601 ("PT1H30M"). Bare numbers have no unit and are not durations.
+func parseDurationValue(value any) (time.Duration, bool) {
+	text, ok := value.(string)
+	if !ok {
+		return 0, false
+	}
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" {
+		return 0, false
+	}
+
+	if match := isoDuration.FindStringSubmatch(text); match != nil && text != "p" && !strings.HasSuffix(text, "t") {
+		var total time.Duration
+		for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+			if match[i+1] != "" {
+				n, _ := strconv.ParseFloat(match[i+1], 64)
+				total += time.Duration(n * float64(unit))
+			}
+		}
+		return total, true
+	}
+
+	var total time.Duration
+	for text != "" {
+		match := durationPart.FindStringSubmatch(text)
+		if match == nil {
+			return 0, false
+		}
+		unit, known := durationUnits[match[2]]
+		if !known {
+			return 0, false
+		}
+		n, _ := strconv.ParseFloat(match[1], 64)
+		total += time.Duration(n * float64(unit))
+		text = text[len(match[0]):]
+	}
+	return total, true
+}
+
+// formatDuration writes d in a canonical form: compact (1h30m, the default), iso
+// (PT1H30M), or a whole number of minutes or seconds
+func formatDuration(d time.Duration, format string) (any, error) {
+	switch format {
+	case "", "compact":
+		if d == 0 {
+			return "0s", nil
+		}
+		text := ""
+		for _, part := range []struct {
+			unit time.Duration
+			name string
+		}{{time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}} {
+			if n := d / part.unit; n > 0 {
+				text += strconv.FormatInt(int64(n), 10) + part.name
+				d -= n * part.unit
+			}
+		}
+		if d > 0 {
+			text += strconv.FormatInt(d.Milliseconds(), 10) + "ms"
+		}
+		return text, nil
+	case "iso":
+		if d == 0 {
+			return "PT0S", nil
+		}
+		text := "PT"
+		for _, part := range []struct {
+			unit time.Duration
+			name string
+		}{{time.Hour, "H"}, {time.Minute, "M"}} {
+			if n := d / part.unit; n > 0 {
+				text += strconv.FormatInt(int64(n), 10) + part.name
+				d -= n * part.unit
+			}
+		}
+		if d > 0 {
+			text += strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "S"
+		}
+		return text, nil
+	case "minutes":
+		return int(d.Round(time.Minute) / time.Minute), nil
+	case "seconds":
+		return int(d.Round(time.Second) / time.Second), nil
+	}
+	return nil, fmt.Errorf("unknown duration format %q (want compact, iso, minutes or seconds)", format)
+}
+
+// timeOfDayLayouts are the accepted spellings of a time of day, compared in lower case
+var timeOfDayLayouts = []string{"15:04", "15:04:05", "3:04pm", "3:04:05pm", "3pm"}
+
+// parseTimeOfDay reads a time of day such as 09:30, 17:45:10, 5:45pm or 5 PM and
+// returns the time since midnight
+func parseTimeOfDay(value any) (time.Duration, bool) {
+	text, ok := value.(string)
+	if !ok {
+		return 0, false
+	}
+	text = strings.NewReplacer(" ", "", ".", "").Replace(strings.ToLower(strings.TrimSpace(text)))
+	for _, layout := range timeOfDayLayouts {
+		if parsed, err := time.Parse(layout, text); err == nil {
+			return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute + time.Duration(parsed.Second())*time.Second, true
+		}
+	}
+	return 0, false
+}
+
+// formatTimeOfDay writes a time since midnight with a Go time layout, 15:04 by
+// default; results wrap around midnight
+func formatTimeOfDay(d time.Duration, layout string) string {
+	if layout == "" {
+		layout = "15:04"
+	}
+	d %= 24 * time.Hour
+	if d < 0 {
+		d += 24 * time.Hour
+	}
+	return time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).Add(d).Format(layout)
+}
+
+// geoPoint is a latitude and longitude in degrees
+type geoPoint struct {
+	Lat, Lng float64
+}
+
+// geoLatKeys and geoLngKeys are the accepted names of the parts of a coordinate map
+var (
+	geoLatKeys = []string{"lat", "latitude"}
+	geoLngKeys = []string{"lng", "lon", "long", "longitude"}
+)
+
+// parseGeoValue reads a coordinate pair written as a map ({lat: 51.1, lng: 17.03}) or
+// as a "lat,lng" string, and rejects latitudes and longitudes out of range
+func parseGeoValue(value any) (geoPoint, bool) {
+	var point geoPoint
+	switch v := value.(type) {
+	case map[string]any:
+		if len(v) != 2 {
+			return point, false
+		}
+		var foundLat, foundLng bool
+		for key, part := range v {
+			n, ok := queryNumber(part)
+			if !ok {
+				return point, false
+			}
+			switch {
+			case slices.Contains(geoLatKeys, strings.ToLower(key)):
+				point.Lat, foundLat = n, true
+			case slices.Contains(geoLngKeys, strings.ToLower(key)):
+				point.Lng, foundLng = n, true
+			}
+		}
+		if !foundLat || !foundLng {
+			return point, false
+		}
+	case string:
+		lat, lng, found := strings.Cut(v, ",")
+		if !found {
+			return point, false
+		}
+		var err error
+		if point.Lat, err = strconv.ParseFloat(strings.TrimSpace(lat), 64); err != nil {
+			return point, false
+		}
+		if point.Lng, err = strconv.ParseFloat(strings.TrimSpace(lng), 64); err != nil {
+			return point, false
+		}
+	default:
+		return point, false
+	}
+	if math.Abs(point.Lat) > 90 || math.Abs(point.Lng) > 180 {
+		return point, false
+	}
+	return point, true
+}
+
+// format writes the point in a canonical form: a {lat, lng} map (the default) or a
+// "lat,lng" string
+func (p geoPoint) format(format string) (any, error) {
+	switch format {
+	case "", "map":
+		return map[string]any{"lat": p.Lat, "lng": p.Lng}, nil
+	case "string":
+		return strconv.FormatFloat(p.Lat, 'f', -1, 64) + "," + strconv.FormatFloat(p.Lng, 'f', -1, 64), nil
+	}
+	return nil, fmt.Errorf("unknown geo format %q (want map or string)", format)
+}
+
+// earthRadiusKm is the mean radius of the Earth used for distances between points
+const earthRadiusKm = 6371.0
+
+// distanceKm returns the great-circle distance between two points in kilometres
+func (p geoPoint) distanceKm(other geoPoint) float64 {
+	rad := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat := rad(other.Lat - p.Lat)
+	dLng := rad(other.Lng - p.Lng)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(p.Lat))*math.Cos(rad(other.Lat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(min(a, 1)))
+}
+
+// parseDistanceKm reads a distance such as 50km, 500m or 10mi; bare numbers are kilometres
+func parseDistanceKm(value string) (float64, error) {
+	units := []struct {
+		suffix string
+		km     float64
+	}{{"km", 1}, {"mi", 1.609344}, {"m", 0.001}, {"", 1}}
+	for _, unit := range units {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+			if err != nil || n < 0 {
+				break
+			}
+			return n * unit.km, nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not a valid distance, e.g. 50km, 500m or 10mi", value)
+}
+
+// canonicalIdentifier checks a scholarly identifier and returns its canonical spelling:
+// ISBNs as 13 digits (ISBN-10s are converted), DOIs as a lower-case 10.x/y name and
+// ORCID iDs as four hyphenated groups. Prefixes such as ISBN: and resolver URLs are
+// dropped. ISBN and ORCID check digits must match.
+func canonicalIdentifier(format string, value any) (string, error) {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = strings.TrimSpace(v)
+	case int, int64, uint64:
+		// An ISBN without hyphens reads as a number
+		text = fmt.Sprint(v)
+	default:
+		return "", fmt.Errorf("expected a string, got %s", describeType(value))
+	}
+	switch format {
+	case "isbn":
+		return canonicalISBN(text)
+	case "doi":
+		return canonicalDOI(text)
+	case "orcid":
+		return canonicalORCID(text)
+	}
+	return "", fmt.Errorf("unknown identifier format %q", format)
+}
+
+// isbnPrefix matches the label ISBN numbers are often written with
+var isbnPrefix = regexp.MustCompile(`^(?i)isbn(?:-1[03])?:?\s*`)
+
+func canonicalISBN(text string) (string, error) {
+	digits := strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(isbnPrefix.ReplaceAllString(text, "")))
+	switch len(digits) {
+	case 10:
+		sum := 0
+		for i, c := range digits {
+			switch {
+			case c >= '0' && c <= '9':
+				sum += (10 - i) * int(c-'0')
+			case c == 'X' && i == 9:
+				sum += 10
+			default:
+				return "", fmt.Errorf("unexpected %q", c)
+			}
+		}
+		if sum%11 != 0 {
+			return "", fmt.Errorf("check digit does not match")
+		}
+		body := "978" + digits[:9]
+		return body + strconv.Itoa(isbn13CheckDigit(body)), nil
+	case 13:
+		if strings.Trim(digits, "0123456789") != "" {
+			return "", fmt.Errorf("expected only digits")
+		}
+		if !strings.HasPrefix(digits, "978") && !strings.HasPrefix(digits, "979") {
+			return "", fmt.Errorf("ISBN-13s start with 978 or 979")
+		}
+		if isbn13CheckDigit(digits[:12]) != int(digits[12]-'0') {
+			return "", fmt.Errorf("check digit does not match")
+		}
+		return digits, nil
+	}
+	return "", fmt.Errorf("expected 10 or 13 digits")
+}
+
+// isbn13CheckDigit computes the check digit of the first 12 digits of an ISBN-13
+func isbn13CheckDigit(digits string) int {
+	sum := 0
+	for i, c := range digits {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(c-'0')
+	}
+	return (10 - sum%10) % 10
+}
+
+// doiName matches a DOI: the 10. directory, a registrant code and any suffix
+var doiName = regexp.MustCompile(`^10\.\d{4,9}(?:\.\d+)*/\S+$`)
+
+func canonicalDOI(text string) (string, error) {
+	lower := strings.ToLower(text)
+	for _, prefix := range []string{"https://doi.org/", "http://doi.org/", "https://dx.doi.org/", "http://dx.doi.org/", "doi.org/", "doi:"} {
+		if strings.HasPrefix(lower, prefix) {
+			text = strings.TrimSpace(text[len(prefix):])
+			if unescaped, err := url.PathUnescape(text); err == nil {
+				text = unescaped
+			}
+			break
+		}
+	}
+	if !doiName.MatchString(text) {
+		return "", fmt.Errorf("expected 10.<registrant>/<suffix>")
+	}
+	// DOI names are case-insensitive
+	return strings.ToLower(text), nil
+}
+
+func canonicalORCID(text string) (string, error) {
+	for _, prefix := range []string{"https://orcid.org/", "http://orcid.org/", "orcid.org/"} {
+		if trimmed, found := strings.CutPrefix(strings.ToLower(text), prefix); found {
+			text = trimmed
+			break
+		}
+	}
+	digits := strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(text))
+	if len(digits) != 16 || strings.Trim(digits[:15], "0123456789") != "" {
+		return "", fmt.Errorf("expected 16 digits such as 0000-0002-1825-0097")
+	}
+	// ISO 7064 MOD 11-2
+	total := 0
+	for _, c := range digits[:15] {
+		total = (total + int(c-'0')) * 2
+	}
+	check := (12 - total%11) % 11
+	want := strconv.Itoa(check)
+	if check == 10 {
+		want = "X"
+	}
+	if digits[15:] != want {
+		return "", fmt.Errorf("check digit does not match")
+	}
+	return digits[:4] + "-" + digits[4:8] + "-" + digits[8:12] + "-" + digits[12:], nil
+}
+
+// geoFilter keeps files whose coordinates under key lie within a radius of a point
+// or inside a bounding box
+type geoFilter struct {
+	key      string
+	near     *geoPoint
+	radiusKm float64
+	box      *[2]geoPoint
+}
+
+// geoFilterFromFlags builds the filter of --near, --within, --bbox and --geo-key; it
+// returns nil when neither --near nor --bbox is given
+func geoFilterFromFlags(flags commandFlags) (*geoFilter, error) {
+	if !flags.has("near") && !flags.has("bbox") {
+		if flags.has("within") {
+			return nil, fmt.Errorf("--within needs --near")
+		}
+		return nil, nil
+	}
+	filter := &geoFilter{key: flags.get("geo-key", "location")}
+	if flags.has("near") {
+		point, ok := parseGeoValue(flags.get("near", ""))
+		if !ok {
+			return nil, fmt.Errorf("invalid --near %q, expected lat,lng", flags.get("near", ""))
+		}
+		radius, err := parseDistanceKm(flags.get("within", "10km"))
+		if err != nil {
+			return nil, err
+		}
+		filter.near, filter.radiusKm = &point, radius
+	}
+	if flags.has("bbox") {
+		var corners []float64
+		for _, part := range strings.Split(flags.get("bbox", ""), ",") {
+			n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				corners = nil
+				break
+			}
+			corners = append(corners, n)
+		}
+		if len(corners) != 4 || corners[0] > corners[2] {
+			return nil, fmt.Errorf("invalid --bbox %q, expected south,west,north,east", flags.get("bbox", ""))
+		}
+		filter.box = &[2]geoPoint{{corners[0], corners[1]}, {corners[2], corners[3]}}
+	}
+	return filter, nil
+}
+
+// contains reports whether point passes the radius and the bounding box. A box whose
+// west edge lies east of its east edge crosses the antimeridian.
+func (f *geoFilter) contains(point geoPoint) bool {
+	if f.near != nil && f.near.distanceKm(point) > f.radiusKm {
+		return false
+	}
+	if f.box != nil {
+		south, north := f.box[0].Lat, f.box[1].Lat
+		west, east := f.box[0].Lng, f.box[1].Lng
+		if point.Lat < south || point.Lat > north {
+			return false
+		}
+		if west <= east && (point.Lng < west || point.Lng > east) || west > east && point.Lng < west && point.Lng > east {
+			return false
+		}
+	}
+	return true
+}
+
+// apply keeps the files whose coordinates pass the filter, nearest first with --near.
+// Files without coordinates under the key are dropped silently; invalid ones with a warning.
+func (f *geoFilter) apply(files []string) []string {
+	distances := make(map[string]float64)
+	var matching []string
+	for _, filePath := range files {
+		data, err := readFrontmatterData(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", filePath, err)
+			continue
+		}
+		value, found := getValueByPath(data, f.key)
+		if !found || value == nil {
+			continue
+		}
+		point, ok := parseGeoValue(value)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %s is not a coordinate pair\n", filePath, f.key)
+			continue
+		}
+		if f.contains(point) {
+			matching = append(matching, filePath)
+			if f.near != nil {
+				distances[filePath] = f.near.distanceKm(point)
+			}
+		}
+	}
+	if f.near != nil {
+		slices.SortStableFunc(matching, func(a, b string) int { return cmp.Compare(distances[a], distances[b]) })
+	}
+	return matching
+}
+
+func handleValidate(args []string, dryRun bool) error {
+	flags, paths, err := parseCommandFlags(args, append([]string{"fix-case", "normalize"}, walkBoolFlags...), append([]string{"schema"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for validate")
+	}
+
+	resolve, err := newSchemaResolver(flags.get("schema", ""))
+	if err != nil {
+		return err
+	}
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	failed := map[string]bool{}
+	index := uniqueIndex{}
+	for _, filePath := range files {
+		schema, err := resolve(filePath)
+		if err != nil {
+			return err
+		}
+		uniqueKeys := append([]string{}, config.Unique...)
+		if schema != nil {
+			uniqueKeys = append(uniqueKeys, schemaPathsWhere(schema, "", func(property *Schema) bool { return property.Unique })...)
+		}
+		if schema == nil && len(config.Patterns) == 0 && len(config.Enums) == 0 && len(config.Formats) == 0 && len(config.Rules) == 0 && len(uniqueKeys) == 0 {
+			continue
+		}
+
+		if flags.has("fix-case") || flags.has("normalize") {
+			_, err := updateFileFrontmatter(filePath, dryRun, func(data map[string]any) error {
+				if flags.has("fix-case") {
+					fixEnumCase(config, schema, data)
+				}
+				if flags.has("normalize") {
+					return normalizeFormats(config, schema, data)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		data, err := readFrontmatterData(filePath)
+		if err != nil {
+			fmt.Printf("%s: %v\n", filePath, err)
+			failed[filePath] = true
+			continue
+		}
+
+		violations := validateFrontmatter(config, schema, data)
+		for _, violation := range violations {
+			fmt.Printf("%s: %s\n", filePath, violation)
+		}
+		if len(violations) > 0 {
+			failed[filePath] = true
+		}
+		index.add(filePath, uniqueKeys, data)
+	}
+
+	for _, duplicate := range index.duplicates() {
+		fmt.Printf("%s: %s\n", duplicate.filePath, duplicate.violation)
+		failed[duplicate.filePath] = true
+	}
+
+	if len(failed) > 0 {
+		return &ExitError{Code: 1, Message: fmt.Sprintf("validation failed for %d file(s)", len(failed))}
+	}
+	return nil
+}
+
+// uniqueIndex maps each unique key to the files holding each of its values,
+// so duplicates are found in a single pass over the corpus
+type uniqueIndex map[string]map[string][]string
+
+// add records the values of keys in data as held by filePath
+func (idx uniqueIndex) add(filePath string, keys []string, data map[string]any) {
+	for _, key := range keys {
+		value, found := getValueByPath(data, key)
+		if !found || value == nil {
+			continue
+		}
+		if idx[key] == nil {
+			idx[key] = map[string][]string{}
+		}
+		encoded := formatInlineValue(value)
+		if holders := idx[key][encoded]; len(holders) > 0 && holders[len(holders)-1] == filePath {
+			continue
+		}
+		idx[key][encoded] = append(idx[key][encoded], filePath)
+	}
+}
+
+// fileViolation is a violation attributed to a file
+type fileViolation struct {
+	filePath  string
+	violation violation
+}
+
+// duplicates reports every file sharing a unique key's value with other files
+func (idx uniqueIndex) duplicates() []fileViolation {
+	var result []fileViolation
+	for _, key := range sortedKeys(idx) {
+		for _, encoded := range sortedKeys(idx[key]) {
+			holders := idx[key][encoded]
+			if len(holders) < 2 {
+				continue
+			}
+			for i, filePath := range holders {
+				others := append(append([]string{}, holders[:i]...), holders[i+1:]...)
+				message := fmt.Sprintf("value %s is not unique, also used by %s", encoded, strings.Join(others, ", "))
+				result = append(result, fileViolation{filePath, violation{key, message}})
+			}
+		}
+	}
+	return result
+}
+
+// permalinkToken matches the :name placeholders of a permalink pattern
+var permalinkToken = regexp.MustCompile(`:[A-Za-z_][A-Za-z0-9_]*`)
+
+func handleURL(args []string) error {
+	flags, paths, err := parseCommandFlags(args, append([]string{"check-collisions", "show-secrets"}, walkBoolFlags...), append([]string{"pattern", "date-key", "redact"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for url")
+	}
+	pattern := flags.get("pattern", "")
+	if pattern == "" {
+		config, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		pattern = config.Permalink
+	}
+	if pattern == "" {
+		return fmt.Errorf("no permalink pattern: pass --pattern or set permalink in %s", configFileName)
+	}
+	dateKey := flags.get("date-key", "date")
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	// A single file that gets no URL is an error; in a walk it is skipped
+	urls := make(map[string][]string)
+	for _, filePath := range files {
+		data, err := readFrontmatterData(filePath)
+		var url string
+		if err == nil {
+			if data, err = redactForOutput(filePath, data, flags); err != nil {
+				return err
+			}
+			url, err = renderPermalink(pattern, filePath, data, dateKey)
+		}
+		if err != nil && len(files) == 1 {
+			return fmt.Errorf("%s: %w", filePath, err)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", filePath, err)
+			continue
+		}
+		urls[url] = append(urls[url], filePath)
+		if len(files) == 1 {
+			fmt.Println(url)
+		} else if !flags.has("check-collisions") {
+			fmt.Printf("%s: %s\n", filePath, url)
+		}
+	}
+
+	if !flags.has("check-collisions") {
+		return nil
+	}
+	collisions := 0
+	for _, url := range sortedKeys(urls) {
+		if len(urls[url]) > 1 {
+			collisions++
+			fmt.Printf("%s: %s\n", url, strings.Join(urls[url], ", "))
+		}
+	}
+	if collisions > 0 {
+		return &ExitError{Code: 1, Message: fmt.Sprintf("%d URL(s) shared by more than one file", collisions)}
+	}
+	return nil
+}
+
+// DuplicateGroup is a set of files whose bodies hash the same, listed by dupes
+type DuplicateGroup struct {
+	Hash  string   `json:"hash"`
+	Files []string `json:"files"`
+}
+
+func handleDupes(args []string) error {
+	flags, paths, err := parseCommandFlags(args, append([]string{"exact", "json"}, walkBoolFlags...), append([]string{"by"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for dupes")
+	}
+	if by := flags.get("by", "body-hash"); by != "body-hash" {
+		return fmt.Errorf("unknown --by value %q, expected body-hash", by)
+	}
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	byHash := make(map[string][]string)
+	for _, filePath := range files {
+		_, body, err := readFileContent(filePath)
+		if err != nil {
+			return err
+		}
+		if !flags.has("exact") {
+			body = normalizeBody(body)
+		}
+		if strings.TrimSpace(body) == "" {
+			// Files without a body are not copies of each other
+			continue
+		}
+		sum := sha256.Sum256([]byte(body))
+		hash := hex.EncodeToString(sum[:])
+		byHash[hash] = append(byHash[hash], filePath)
+	}
+
+	groups := []DuplicateGroup{}
+	for _, hash := range sortedKeys(byHash) {
+		if len(byHash[hash]) > 1 {
+			groups = append(groups, DuplicateGroup{hash, byHash[hash]})
+		}
+	}
+	// Largest groups first, then in order of their first file
+	sort.SliceStable(groups, func(i, j int) bool {
+		if len(groups[i].Files) != len(groups[j].Files) {
+			return len(groups[i].Files) > len(groups[j].Files)
+		}
+		return groups[i].Files[0] < groups[j].Files[0]
+	})
+
+	if flags.has("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(groups); err != nil {
+			return fmt.Errorf("failed to encode duplicate groups: %w", err)
+		}
+	} else {
+		for _, group := range groups {
+			fmt.Printf("%s: %s\n", group.Hash[:12], strings.Join(group.Files, ", "))
+		}
+	}
+	if len(groups) > 0 {
+		return &ExitError{Code: 1, Message: fmt.Sprintf("%d group(s) of files with the same body", len(groups))}
+	}
+	return nil
+}
+
+// normalizeBody reduces a body to its words in lower case so that copies differing
+// only in whitespace, line endings or capitalization hash the same
+func normalizeBody(body string) string {
+	return strings.ToLower(strings.Join(strings.Fields(body), " "))
+}
+
+// renderPermalink fills the placeholders of a permalink pattern from a file's
+// frontmatter. An explicit url key wins over the pattern. :year, :month and :day come
+// from the date key, :slug from slug or else the title or file name, :filename and
+// :section from the path; any other :key is the slugified value of that key.
+func renderPermalink(pattern, filePath string, data map[string]any, dateKey string) (string, error) {
+	if url, ok := data["url"].(string); ok && url != "" {
+		return url, nil
+	}
+
+	filename := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	var missing []string
+	url := permalinkToken.ReplaceAllStringFunc(pattern, func(token string) string {
+		name := token[1:]
+		switch name {
+		case "year", "month", "day":
+			value, _ := getValueByPath(data, dateKey)
+			date, ok := parseDateValue(value)
+			if !ok {
+				if !slices.Contains(missing, dateKey) {
+					missing = append(missing, dateKey)
+				}
+				return token
+			}
+			return date.Format(map[string]string{"year": "2006", "month": "01", "day": "02"}[name])
+		case "slug":
+			if slug, ok := data["slug"]; ok {
+				return slugify(fmt.Sprint(slug))
+			}
+			if title, ok := data["title"]; ok {
+				return slugify(fmt.Sprint(title))
+			}
+			return slugify(filename)
+		case "filename":
+			return slugify(filename)
+		case "section":
+			section := filepath.ToSlash(filepath.Dir(filePath))
+			return slugify(path.Base(section))
+		}
+		value, ok := getValueByPath(data, name)
+		if !ok {
+			if !slices.Contains(missing, name) {
+				missing = append(missing, name)
+			}
+			return token
+		}
+		return slugify(fmt.Sprint(value))
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("pattern %s needs %s", pattern, strings.Join(missing, ", "))
+	}
+	return url, nil
+}
+
+// JSONFeed is the JSON Feed 1.1 document written by export --format json-feed
+type JSONFeed struct {
+	Version string         `json:"version"`
+	Title   string         `json:"title"`
+	Items   []JSONFeedItem `json:"items"`
+}
+
+// JSONFeedItem is one file of a JSON feed. Exported keys without a JSON Feed
+// counterpart are kept in the _frontmatter extension object.
+type JSONFeedItem struct {
+	ID            string         `json:"id"`
+	URL           string         `json:"url,omitempty"`
+	Title         string         `json:"title,omitempty"`
+	Summary       string         `json:"summary,omitempty"`
+	DatePublished string         `json:"date_published,omitempty"`
+	Tags          []string       `json:"tags,omitempty"`
+	Frontmatter   map[string]any `json:"_frontmatter,omitempty"`
+}
+
+// exportEntry is a file picked for export with its frontmatter and date
+type exportEntry struct {
+	Path string
+	Data map[string]any
+	Date time.Time
+}
+
+func handleExport(args []string) error {
+	flags, paths, err := parseCommandFlags(args, append([]string{"show-secrets"}, walkBoolFlags...), append([]string{"format", "fields", "date-key", "title-key", "base-url", "title", "redact"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for export")
+	}
+	format := flags.get("format", "")
+	fields, err := listFields(flags, "title,date,description,url")
+	if err != nil {
+		return err
+	}
+	// Only ics uses more than one date key; the first one orders the entries
+	dateKeys := flags["date-key"]
+	if len(dateKeys) == 0 {
+		dateKeys = []string{"date"}
+	}
+	dateKey := dateKeys[0]
+	baseURL := strings.TrimSuffix(flags.get("base-url", ""), "/")
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+	entries, err := readExportEntries(files, dateKey, flags)
+	if err != nil {
+		return err
+	}
+
+	// url is filled from the frontmatter or, failing that, the config permalink
+	urlOf := func(entry exportEntry) string {
+		url, _ := entry.Data["url"].(string)
+		if url == "" && config.Permalink != "" {
+			url, _ = renderPermalink(config.Permalink, entry.Path, entry.Data, dateKey)
+		}
+		if strings.HasPrefix(url, "/") {
+			url = baseURL + url
+		}
+		return url
+	}
+
+	switch format {
+	case "rss-items":
+		for _, entry := range entries {
+			fmt.Print(rssItem(entry, fields, dateKey, urlOf(entry)))
+		}
+		return nil
+	case "json-feed":
+		feed := JSONFeed{Version: "https://jsonfeed.org/version/1.1", Title: flags.get("title", "Feed"), Items: []JSONFeedItem{}}
+		for _, entry := range entries {
+			feed.Items = append(feed.Items, jsonFeedItem(entry, fields, dateKey, urlOf(entry)))
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(feed); err != nil {
+			return fmt.Errorf("failed to encode feed: %w", err)
+		}
+		return nil
+	case "html-meta":
+		mapping := defaultMetaMapping
+		if len(config.Meta) > 0 {
+			mapping = nil
+			for _, tag := range sortedKeys(config.Meta) {
+				mapping = append(mapping, metaMapping{Tag: tag, Key: config.Meta[tag]})
+			}
+		}
+		for i, entry := range entries {
+			if len(entries) > 1 {
+				if i > 0 {
+					fmt.Println()
+				}
+				fmt.Printf("<!-- %s -->\n", entry.Path)
+			}
+			fmt.Print(htmlMetaTags(entry, mapping, urlOf(entry)))
+		}
+		return nil
+	case "ics":
+		calendar := newICSCalendar(time.Now())
+		for _, entry := range entries {
+			calendar.addEntry(entry, dateKeys, flags.get("title-key", "title"), urlOf(entry))
+		}
+		fmt.Print(calendar.String())
+		return nil
+	case "":
+		return fmt.Errorf("--format is required for export")
+	default:
+		return fmt.Errorf("unknown export format %q (want rss-items, json-feed, html-meta or ics)", format)
+	}
+}
+
+// icsCalendar builds an iCalendar (RFC 5545) document with one event per dated key
+type icsCalendar struct {
+	lines []string
+	stamp string
+}
+
+// newICSCalendar starts a calendar whose events are stamped with now
+func newICSCalendar(now time.Time) *icsCalendar {
+	return &icsCalendar{
+		lines: []string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//marad//frontmatter//EN", "CALSCALE:GREGORIAN"},
+		stamp: now.UTC().Format("20060102T150405Z"),
+	}
+}
+
+// addEntry adds an event for every date key the file has. Dates without a time become
+// all-day events. The first key's event is named after the title, the others get the
+// key appended, e.g. "Launch post (deadline)".
+func (c *icsCalendar) addEntry(entry exportEntry, dateKeys []string, titleKey, url string) {
+	title := filepath.Base(entry.Path)
+	if value, found := getValueByPath(entry.Data, titleKey); found {
+		title = fmt.Sprint(value)
+	}
+	for i, key := range dateKeys {
+		value, found := getValueByPath(entry.Data, key)
+		if !found {
+			continue
+		}
+		date, ok := parseDateValue(value)
+		if !ok {
+			continue
+		}
+
+		summary := title
+		if i > 0 {
+			summary = fmt.Sprintf("%s (%s)", title, key)
+		}
+		uid := sha256.Sum256([]byte(filepath.ToSlash(entry.Path) + "#" + key))
+		c.lines = append(c.lines, "BEGIN:VEVENT",
+			"UID:"+hex.EncodeToString(uid[:16])+"@frontmatter",
+			"DTSTAMP:"+c.stamp)
+		if text, isString := value.(string); isString && isDateOnlyString(strings.TrimSpace(text)) {
+			c.lines = append(c.lines,
+				"DTSTART;VALUE=DATE:"+date.Format("20060102"),
+				"DTEND;VALUE=DATE:"+date.AddDate(0, 0, 1).Format("20060102"))
+		} else {
+			c.lines = append(c.lines, "DTSTART:"+date.UTC().Format("20060102T150405Z"))
+		}
+		c.lines = append(c.lines, "SUMMARY:"+icsEscape(summary))
+		if description, found := getValueByPath(entry.Data, "description"); found {
+			c.lines = append(c.lines, "DESCRIPTION:"+icsEscape(fmt.Sprint(description)))
+		}
+		if url != "" {
+			c.lines = append(c.lines, "URL:"+url)
+		}
+		c.lines = append(c.lines, "END:VEVENT")
+	}
+}
+
+// String ends the calendar and returns it with CRLF line endings and long lines folded
+func (c *icsCalendar) String() string {
+	var ics strings.Builder
+	for _, line := range append(c.lines, "END:VCALENDAR") {
+		// Content lines are folded at 75 octets without splitting UTF-8 sequences
+		for len(line) > 75 {
+			cut := 75
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			ics.WriteString(line[:cut] + "\r\n")
+			line = " " + line[cut:]
+		}
+		ics.WriteString(line + "\r\n")
+	}
+	return ics.String()
+}
+
+// icsEscape escapes text for an iCalendar TEXT value
+func icsEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// metaMapping fills the HTML tag Tag from the frontmatter key Key. Tag "title" is the
+// <title> element, og: and article: tags are <meta property>, others <meta name>.
+type metaMapping struct {
+	Tag string
+	Key string
+}
+
+// defaultMetaMapping is used by export --format html-meta when the config has no meta map
+var defaultMetaMapping = []metaMapping{
+	{"title", "title"},
+	{"description", "description"},
+	{"author", "author"},
+	{"og:type", "type"},
+	{"og:title", "title"},
+	{"og:description", "description"},
+	{"og:url", "url"},
+	{"og:image", "image"},
+	{"article:published_time", "date"},
+	{"article:modified_time", "lastmod"},
+	{"article:tag", "tags"},
+}
+
+// htmlMetaTags renders the <title> and <meta> tags a file's frontmatter implies. Keys
+// missing from the file are skipped and list values repeat the tag once per element.
+// The url key falls back to the computed URL and dates of *_time tags become ISO 8601.
+func htmlMetaTags(entry exportEntry, mapping []metaMapping, url string) string {
+	var tags strings.Builder
+	for _, m := range mapping {
+		var values []string
+		switch value, found := getValueByPath(entry.Data, m.Key); {
+		case m.Key == "url" && url != "":
+			values = []string{url}
+		case !found:
+			continue
+		case strings.HasSuffix(m.Tag, "_time"):
+			if date, ok := parseDateValue(value); ok {
+				values = []string{date.Format(time.RFC3339)}
+			} else {
+				values = exportStrings(value)
+			}
+		default:
+			values = exportStrings(value)
+		}
+
+		for _, text := range values {
+			text = html.EscapeString(text)
+			switch {
+			case m.Tag == "title":
+				fmt.Fprintf(&tags, "<title>%s</title>\n", text)
+			case strings.HasPrefix(m.Tag, "og:") || strings.HasPrefix(m.Tag, "article:"):
+				fmt.Fprintf(&tags, "<meta property=\"%s\" content=\"%s\">\n", html.EscapeString(m.Tag), text)
+			default:
+				fmt.Fprintf(&tags, "<meta name=\"%s\" content=\"%s\">\n", html.EscapeString(m.Tag), text)
+			}
+		}
+	}
+	return tags.String()
+}
+
+// readExportEntries reads the frontmatter of files and orders them newest first by
+// dateKey; files without a date keep their path order after the dated ones
+func readExportEntries(files []string, dateKey string, flags commandFlags) ([]exportEntry, error) {
+	entries := make([]exportEntry, 0, len(files))
+	for _, filePath := range files {
+		data, err := readFrontmatterData(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		entry := exportEntry{Path: filePath}
+		if value, found := getValueByPath(data, dateKey); found {
+			entry.Date, _ = parseDateValue(value)
+		}
+		if entry.Data, err = redactForOutput(filePath, data, flags); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date.After(entries[j].Date)
+	})
+	return entries, nil
+}
+
+// exportStrings returns a value as a list of strings, one per list element
+func exportStrings(value any) []string {
+	if list, ok := value.([]any); ok {
+		values := make([]string, 0, len(list))
+		for _, item := range list {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	}
+	return []string{fmt.Sprint(value)}
+}
+
+// rssItem renders an RSS 2.0 <item>. title, description, url and the date key map to
+// their RSS elements, tags and categories to <category>, other keys to an element
+// of the same name.
+func rssItem(entry exportEntry, fields []string, dateKey, url string) string {
+	var item strings.Builder
+	element := func(name, text string) {
+		item.WriteString("  <" + name + ">")
+		xml.EscapeText(&item, []byte(text))
+		item.WriteString("</" + name + ">\n")
+	}
+
+	item.WriteString("<item>\n")
+	for _, field := range fields {
+		switch {
+		case field == "url":
+			if url != "" {
+				element("link", url)
+				element("guid", url)
+			}
+			continue
+		case field == dateKey:
+			if !entry.Date.IsZero() {
+				element("pubDate", entry.Date.Format(time.RFC1123Z))
+			}
+			continue
+		}
+		value, found := getValueByPath(entry.Data, field)
+		if !found {
+			continue
+		}
+		name := field
+		if field == "tags" || field == "categories" {
+			name = "category"
+		}
+		for _, text := range exportStrings(value) {
+			element(name, text)
+		}
+	}
+	item.WriteString("</item>\n")
+	return item.String()
+}
+
+// jsonFeedItem maps the exported fields of a file onto a JSON Feed item
+func jsonFeedItem(entry exportEntry, fields []string, dateKey, url string) JSONFeedItem {
+	item := JSONFeedItem{ID: url}
+	if item.ID == "" {
+		item.ID = filepath.ToSlash(entry.Path)
+	}
+	for _, field := range fields {
+		switch {
+		case field == "url":
+			item.URL = url
+			continue
+		case field == dateKey:
+			if !entry.Date.IsZero() {
+				item.DatePublished = entry.Date.Format(time.RFC3339)
+			}
+			continue
+		}
+		value, found := getValueByPath(entry.Data, field)
+		if !found {
+			continue
+		}
+		switch field {
+		case "title":
+			item.Title = fmt.Sprint(value)
+		case "description", "summary":
+			item.Summary = fmt.Sprint(value)
+		case "tags", "categories":
+			item.Tags = append(item.Tags, exportStrings(value)...)
+		default:
+			if item.Frontmatter == nil {
+				item.Frontmatter = make(map[string]any)
+			}
+			item.Frontmatter[field] = normalizeJSONValue(value)
+		}
+	}
+	return item
+}
+
+// defaultSidecarExtensions are appended to a primary file's name to form its sidecar,
+// e.g. photo.jpg.yaml holds the metadata of photo.jpg
+var defaultSidecarExtensions = []string{".yaml", ".yml"}
+
+func handleSidecar(args []string) error {
+	if len(args) < 1 || args[0] != "check" {
+		return fmt.Errorf("sidecar needs a subcommand: check")
+	}
+
+	flags, paths, err := parseCommandFlags(args[1:], walkBoolFlags, append([]string{"ext", "primary"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one directory must be specified for sidecar check")
+	}
+	extensions := defaultSidecarExtensions
+	if flags.has("ext") {
+		extensions = nil
+		for _, ext := range flags["ext"] {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			extensions = append(extensions, ext)
+		}
+	}
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	opts.AllFiles = true
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	hasSidecar := make(map[string]bool)
+	for _, filePath := range files {
+		primary, ok := sidecarPrimary(filePath, extensions)
+		if !ok {
+			continue
+		}
+		hasSidecar[primary] = true
+		if _, err := os.Stat(primary); os.IsNotExist(err) {
+			problems = append(problems, fmt.Sprintf("%s: orphaned sidecar, %s does not exist", filePath, primary))
+		}
+	}
+	for _, filePath := range files {
+		if hasSidecar[filePath] || !matchesAnyGlob(flags["primary"], filepath.ToSlash(filePath)) {
+			continue
+		}
+		if _, ok := sidecarPrimary(filePath, extensions); !ok {
+			problems = append(problems, fmt.Sprintf("%s: missing sidecar %s", filePath, filePath+extensions[0]))
+		}
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return &ExitError{Code: 1, Message: fmt.Sprintf("sidecar check found %d problem(s)", len(problems))}
+	}
+	return nil
+}
+
+// sidecarPrimary returns the primary file a sidecar path belongs to. Only names with
+// a sidecar extension on top of the primary's own extension qualify, so project files
+// such as _defaults.yaml are never mistaken for sidecars.
+func sidecarPrimary(filePath string, extensions []string) (string, bool) {
+	for _, ext := range extensions {
+		primary, found := strings.CutSuffix(filePath, ext)
+		if found && filepath.Ext(primary) != "" && !strings.HasPrefix(filepath.Base(primary), ".") {
+			return primary, true
+		}
+	}
+	return "", false
+}
+
+func handleCheck(args []string) error {
+	flags, paths, err := parseCommandFlags(args, append([]string{"check-links"}, walkBoolFlags...), slices.Concat([]string{"max-frontmatter-bytes"}, linkValueFlags, walkValueFlags))
+	if err != nil {
+		return err
+	}
+	if err := setFrontmatterByteBudget(flags); err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for check")
+	}
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	deadLinks, err := checkLinksIfRequested(files, flags)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, filePath := range files {
+		problems, err := checkFile(filePath)
+		if err != nil {
+			return err
+		}
+		problems = append(problems, deadLinks[filePath]...)
+		for _, problem := range problems {
+			fmt.Printf("%s: %s\n", filePath, problem)
+		}
+		if len(problems) > 0 {
+			failed++
+		}
+	}
+
+	printOversizedReport()
+	if failed > 0 {
+		return &ExitError{Code: 1, Message: fmt.Sprintf("check failed for %d file(s)", failed)}
+	}
+	return nil
+}
+
+func handleLint(args []string) error {
+	flags, paths, err := parseCommandFlags(args, append([]string{"check-links"}, walkBoolFlags...), slices.Concat([]string{"max-frontmatter-bytes"}, linkValueFlags, walkValueFlags))
+	if err != nil {
+		return err
+	}
+	if err := setFrontmatterByteBudget(flags); err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for lint")
+	}
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	deadLinks, err := checkLinksIfRequested(files, flags)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, filePath := range files {
+		data, err := readFrontmatterData(filePath)
+		if err != nil {
+			fmt.Printf("%s: %v\n", filePath, err)
+			failed++
+			continue
+		}
+
+		problems := append(runLintRules(filePath, data), deadLinks[filePath]...)
+		for _, problem := range problems {
+			fmt.Printf("%s: %s\n", filePath, problem)
+		}
+		if len(problems) > 0 {
+			failed++
+		}
+	}
+
+	printOversizedReport()
+	if failed > 0 {
+		return &ExitError{Code: 1, Message: fmt.Sprintf("lint failed for %d file(s)", failed)}
+	}
+	return nil
+}
+
+// runLintRules applies every lint rule and prefixes problems with the rule name
+func runLintRules(filePath string, data map[string]any) []string {
+	var problems []string
+	for _, rule := range lintRules {
+		for _, problem := range rule.check(filePath, data) {
+			problems = append(problems, fmt.Sprintf("[%s] %s", rule.name, problem))
+		}
+	}
+	return problems
+}
+
+// lintSecrets reports string values at any depth that look like credentials.
+// The matched value itself is never printed.
+func lintSecrets(filePath string, data map[string]any) []string {
+	var problems []string
+	walkStrings("", data, func(keyPath, value string) {
+		for _, secret := range secretPatterns {
+			if secret.pattern.MatchString(value) {
+				problems = append(problems, fmt.Sprintf("%s: value looks like a credential (%s)", keyPath, secret.name))
+				return
+			}
+		}
+	})
+	return problems
+}
+
+// lintPatterns reports values not matching the config patterns or the pattern
+// constraints of the file's schema
+func lintPatterns(filePath string, data map[string]any) []string {
+	config, err := loadConfig()
+	if err != nil {
+		return []string{err.Error()}
+	}
+	violations := configPatternViolations(config, data)
+
+	schema, err := config.loadSchemaFor(filePath)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if schema != nil {
+		for _, violation := range validateValue(schema, "", data) {
+			if strings.Contains(violation.Message, "pattern") {
+				violations = append(violations, violation)
+			}
+		}
+	}
+
+	problems := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		problems = append(problems, violation.String())
+	}
+	return problems
+}
+
+// checkURL describes what makes value an invalid absolute http(s) URL, or returns ""
+func checkURL(value any) string {
+	text, ok := value.(string)
+	if !ok {
+		return fmt.Sprintf("expected a URL, got %s", describeType(value))
+	}
+	parsed, err := url.Parse(text)
+	switch {
+	case err != nil:
+		return fmt.Sprintf("value %q is not a valid URL: %v", text, errors.Unwrap(err))
+	case parsed.Scheme != "http" && parsed.Scheme != "https":
+		return fmt.Sprintf("value %q is not an http or https URL", text)
+	case parsed.Host == "":
+		return fmt.Sprintf("value %q has no host", text)
+	}
+	return ""
+}
+
+// urlKeys returns the keys holding URLs for filePath: those with the url (or uri)
+// format in the config's formats map or in the file's schema
+func urlKeys(config *Config, filePath string) ([]string, error) {
+	var keys []string
+	for _, key := range sortedKeys(config.Formats) {
+		if format := config.Formats[key]; format == "url" || format == "uri" {
+			keys = append(keys, key)
+		}
+	}
+	schema, err := config.loadSchemaFor(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if schema != nil {
+		keys = append(keys, schemaPathsWhere(schema, "", func(property *Schema) bool {
+			return property.Format == "url" || property.Format == "uri"
+		})...)
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys), nil
+}
+
+// lintURLs reports values of URL keys that are not absolute http(s) URLs
+func lintURLs(filePath string, data map[string]any) []string {
+	config, err := loadConfig()
+	if err != nil {
+		return []string{err.Error()}
+	}
+	keys, err := urlKeys(config, filePath)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var problems []string
+	for _, key := range keys {
+		value, found := getValueByPath(data, key)
+		if !found || value == nil {
+			continue
+		}
+		if problem := checkURL(value); problem != "" {
+			problems = append(problems, key+": "+problem)
+		}
+	}
+	return problems
+}
+
+// linkValueFlags are the value flags tuning --check-links
+var linkValueFlags = []string{"concurrency", "link-cache-ttl", "link-timeout"}
+
+// linkResult is the outcome of requesting one URL, as kept in the link cache
+type linkResult struct {
+	Status    int       `json:"status,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// dead describes why the link counts as dead, or returns "" for a live one
+func (r linkResult) dead() string {
+	switch {
+	case r.Error != "":
+		return r.Error
+	case r.Status >= 400:
+		return fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status))
+	}
+	return ""
+}
+
+// checkLinksIfRequested requests the URLs stored under the URL keys of files when
+// --check-links is given, and returns a problem for every dead one by file
+func checkLinksIfRequested(files []string, flags commandFlags) (map[string][]string, error) {
+	if !flags.has("check-links") {
+		for _, name := range linkValueFlags {
+			if flags.has(name) {
+				return nil, fmt.Errorf("--%s needs --check-links", name)
+			}
+		}
+		return nil, nil
+	}
+	concurrency, err := strconv.Atoi(flags.get("concurrency", "8"))
+	if err != nil || concurrency < 1 {
+		return nil, fmt.Errorf("invalid --concurrency value %q", flags.get("concurrency", ""))
+	}
+	ttl, err := parseAge(flags.get("link-cache-ttl", "24h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --link-cache-ttl value: %w", err)
+	}
+	timeout, err := time.ParseDuration(flags.get("link-timeout", "10s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --link-timeout value: %w", err)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	type link struct{ filePath, key, url string }
+	var links []link
+	for _, filePath := range files {
+		data, err := readFrontmatterData(filePath)
+		if err != nil {
+			// Reported by the regular checks
+			continue
+		}
+		keys, err := urlKeys(config, filePath)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			value, found := getValueByPath(data, key)
+			if found && value != nil && checkURL(value) == "" {
+				links = append(links, link{filePath, key, value.(string)})
+			}
+		}
+	}
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	cache := loadLinkCache()
+	var pending []string
+	for _, link := range links {
+		if result, found := cache.results[link.url]; (!found || time.Since(result.CheckedAt) > ttl) && !slices.Contains(pending, link.url) {
+			pending = append(pending, link.url)
+		}
+	}
+	client := &http.Client{Timeout: timeout}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	for range min(concurrency, len(pending)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range queue {
+				result := requestLink(client, target)
+				mu.Lock()
+				cache.results[target] = result
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, target := range pending {
+		queue <- target
+	}
+	close(queue)
+	wg.Wait()
+	if len(pending) > 0 {
+		cache.save()
+	}
+
+	problems := make(map[string][]string)
+	for _, link := range links {
+		if reason := cache.results[link.url].dead(); reason != "" {
+			problems[link.filePath] = append(problems[link.filePath], fmt.Sprintf("%s: dead link %s (%s)", link.key, link.url, reason))
+		}
+	}
+	return problems, nil
+}
+
+// requestLink sends a HEAD request for target, retrying with GET for servers that
+// refuse HEAD
+func requestLink(client *http.Client, target string) linkResult {
+	result := linkResult{CheckedAt: time.Now().UTC()}
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		request, err := http.NewRequest(method, target, nil)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		request.Header.Set("User-Agent", "frontmatter")
+		response, err := client.Do(request)
+		if err != nil {
+			result.Error = errors.Unwrap(err).Error()
+			return result
+		}
+		response.Body.Close()
+		result.Status = response.StatusCode
+		if response.StatusCode != http.StatusMethodNotAllowed && response.StatusCode != http.StatusNotImplemented {
+			break
+		}
+	}
+	return result
+}
+
+// linkCache holds the results of earlier link checks by URL
+type linkCache struct {
+	path    string
+	results map[string]linkResult
+}
+
+// loadLinkCache reads the link cache of the project; a missing or unreadable cache is empty
+func loadLinkCache() *linkCache {
+	cache := &linkCache{results: make(map[string]linkResult)}
+	rootDir, err := projectRootDir()
+	if err != nil || parseCacheDisabled {
+		return cache
+	}
+	cache.path = filepath.Join(rootDir, cacheDirName, linkCacheFileName)
+	if content, err := os.ReadFile(cache.path); err == nil {
+		json.Unmarshal(content, &cache.results)
+	}
+	return cache
+}
+
+// save writes the cache back. Failures are ignored: the links are checked again next time.
+func (c *linkCache) save() {
+	if c.path == "" {
+		return
+	}
+	content, err := json.MarshalIndent(c.results, "", "  ")
+	if err != nil || makeCacheDir(c.path) != nil {
+		return
+	}
+	os.WriteFile(c.path, content, 0644)
+}
+
+// setFrontmatterByteBudget applies --max-frontmatter-bytes, which accepts sizes like 4K
+func setFrontmatterByteBudget(flags commandFlags) error {
+	if !flags.has("max-frontmatter-bytes") {
+		return nil
+	}
+	budget, err := parseByteSize(flags.get("max-frontmatter-bytes", ""))
+	if err != nil {
+		return fmt.Errorf("invalid --max-frontmatter-bytes value: %w", err)
+	}
+	frontmatterByteBudget = budget
+	return nil
+}
+
+// lintFrontmatterSize reports a frontmatter block larger than the budget from
+// --max-frontmatter-bytes or the config's maxFrontmatterBytes
+func lintFrontmatterSize(filePath string, data map[string]any) []string {
+	budget := frontmatterByteBudget
+	if budget == 0 {
+		config, err := loadConfig()
+		if err != nil {
+			return []string{err.Error()}
+		}
+		budget = config.MaxFrontmatterBytes
+	}
+	if budget <= 0 {
+		return nil
+	}
+
+	fmString, err := readFrontmatterBlock(filePath)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	size := int64(len(fmString))
+	if size <= budget {
+		return nil
+	}
+	oversizedFiles = append(oversizedFiles, fileSize{Path: filePath, Size: size})
+	return []string{fmt.Sprintf("frontmatter is %d bytes, budget is %d", size, budget)}
+}
+
+// printOversizedReport lists the largest frontmatter blocks over budget, biggest first
+func printOversizedReport() {
+	if len(oversizedFiles) == 0 {
+		return
+	}
+	sort.SliceStable(oversizedFiles, func(i, j int) bool {
+		return oversizedFiles[i].Size > oversizedFiles[j].Size
+	})
+	fmt.Printf("\nLargest frontmatter blocks over budget (%d file(s)):\n", len(oversizedFiles))
+	for i, file := range oversizedFiles {
+		if i == largestOffendersShown {
+			break
+		}
+		fmt.Printf("%8d  %s\n", file.Size, file.Path)
+	}
+}
+
+// walkStrings calls visit for every string value below value, in key order,
+// with its dot path (list elements use their index)
+func walkStrings(keyPath string, value any, visit func(keyPath, value string)) {
+	switch v := value.(type) {
+	case string:
+		visit(keyPath, v)
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			walkStrings(joinKeyPath(keyPath, key), v[key], visit)
+		}
+	case []any:
+		for i, item := range v {
+			walkStrings(joinKeyPath(keyPath, strconv.Itoa(i)), item, visit)
+		}
+	}
+}
+
+// checkFile runs every project check on one file and returns the problems found
+func checkFile(filePath string) ([]string, error) {
+	data, err := readFrontmatterData(filePath)
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+
+	problems := runLintRules(filePath, data)
+
+	keys, err := immutableKeys(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 {
+		headContent, tracked := gitShowHead(filePath)
+		if tracked {
+			headFm, _, _ := splitFrontmatter(headContent)
+			if headData, err := parseFrontmatter(headFm); err == nil {
+				for _, key := range changedImmutableKeys(keys, headData, data) {
+					problems = append(problems, fmt.Sprintf("immutable key %s changed since HEAD", key))
+				}
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// gitShowHead returns the content of filePath at git HEAD and whether it is tracked there
+func gitShowHead(filePath string) (string, bool) {
+	cmd := exec.Command("git", "-C", filepath.Dir(filePath), "show", "HEAD:./"+filepath.Base(filePath))
+	output, err := cmd.Output()
+	if err != nil {
+		return "", false
+	}
+	return string(output), true
+}
+
+// commitWrittenFiles stages and commits the files written by command. The message
+// template may use {command}, {keys} (frontmatter keys changed since HEAD) and {files}.
+func commitWrittenFiles(command, template string) error {
+	if len(writtenFiles) == 0 {
+		return nil
+	}
+	if template == "" {
+		template = defaultCommitTemplate
+	}
+
+	var paths []string
+	seenPaths := make(map[string]bool)
+	changed := make(map[string]bool)
+	for _, filePath := range writtenFiles {
+		if seenPaths[filePath] {
+			continue
+		}
+		seenPaths[filePath] = true
+		paths = append(paths, filePath)
+
+		fmString, err := readFrontmatterBlock(filePath)
+		if err != nil {
+			return err
+		}
+		current, _ := parseFrontmatter(fmString)
+		var head map[string]any
+		if headContent, tracked := gitShowHead(filePath); tracked {
+			headFm, _, _ := splitFrontmatter(headContent)
+			head, _ = parseFrontmatter(headFm)
+		}
+		for _, key := range changedKeyPaths(head, current) {
+			changed[key] = true
+		}
+	}
+	changedKeys := sortedKeys(changed)
+
+	message := strings.NewReplacer(
+		"{command}", command,
+		"{keys}", strings.Join(changedKeys, ", "),
+		"{files}", strings.Join(paths, ", "),
+	).Replace(template)
+
+	add := exec.Command("git", append([]string{"add", "--"}, paths...)...)
+	if output, err := add.CombinedOutput(); err != nil {
+		return fmt.Errorf("git add failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	commit := exec.Command("git", append([]string{"commit", "-q", "-m", message, "--"}, paths...)...)
+	if output, err := commit.CombinedOutput(); err != nil {
+		return fmt.Errorf("git commit failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// changedKeyPaths lists the dot paths whose values differ between before and after
+func changedKeyPaths(before, after map[string]any) []string {
+	beforeFlat := make(map[string]any)
+	afterFlat := make(map[string]any)
+	flattenFrontmatter("", before, beforeFlat)
+	flattenFrontmatter("", after, afterFlat)
+
+	var keys []string
+	for key, value := range beforeFlat {
+		if other, found := afterFlat[key]; !found || !valuesEqual(value, other) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range afterFlat {
+		if _, found := beforeFlat[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// immutableKeys returns the keys that may not change for filePath: the config's
+// immutable list plus readOnly properties of the file's schema
+func immutableKeys(filePath string) ([]string, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	keys := append([]string{}, config.Immutable...)
+
+	schema, err := config.loadSchemaFor(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if schema != nil {
+		keys = append(keys, schemaPathsWhere(schema, "", func(property *Schema) bool { return property.ReadOnly })...)
+	}
+	return keys, nil
+}
+
+// schemaPathsWhere lists the dot paths of schema properties matching flagged;
+// children of a flagged property are not visited
+func schemaPathsWhere(schema *Schema, prefix string, flagged func(*Schema) bool) []string {
+	var paths []string
+	for _, key := range sortedKeys(schema.Properties) {
+		property := schema.Properties[key]
+		if property == nil {
+			continue
+		}
+		keyPath := joinKeyPath(prefix, key)
+		if flagged(property) {
+			paths = append(paths, keyPath)
+			continue
+		}
+		paths = append(paths, schemaPathsWhere(property, keyPath, flagged)...)
+	}
+	return paths
+}
+
+// secretKeys returns the keys to redact for filePath: the config's secrets list,
+// secret properties of the file's schema and the ad-hoc comma-separated redact list
+func secretKeys(filePath, redact string) ([]string, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	keys := append([]string{}, config.Secrets...)
+
+	schema, err := config.loadSchemaFor(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if schema != nil {
+		keys = append(keys, schemaPathsWhere(schema, "", func(property *Schema) bool { return property.Secret })...)
+	}
+
+	for _, key := range strings.Split(redact, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// redactSecrets replaces the values at the given key paths with a placeholder
+func redactSecrets(data map[string]any, keys []string) {
+	for _, key := range keys {
+		if _, found := getValueByPath(data, key); found {
+			setValueByPath(data, key, redactedPlaceholder)
+		}
+	}
+}
+
+// redactForOutput returns the frontmatter of filePath as commands print it, with its
+// secrets and the --redact keys replaced unless --show-secrets is given. Redaction
+// works on a copy, since data may be shared with the parse cache.
+func redactForOutput(filePath string, data map[string]any, flags commandFlags) (map[string]any, error) {
+	if flags.has("show-secrets") {
+		return data, nil
+	}
+	keys, err := secretKeys(filePath, flags.get("redact", ""))
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return data, nil
+	}
+	redacted := copyValue(data).(map[string]any)
+	redactSecrets(redacted, keys)
+	return redacted, nil
+}
+
+// copyValue returns a copy of value that shares none of its maps and lists
+func copyValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for key, element := range v {
+			copied[key] = copyValue(element)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, element := range v {
+			copied[i] = copyValue(element)
+		}
+		return copied
+	}
+	return value
+}
+
+// changedImmutableKeys returns the immutable keys that existed in before and
+// were changed or removed in after. Keys missing from before may be assigned.
+func changedImmutableKeys(keys []string, before, after map[string]any) []string {
+	var changed []string
+	for _, key := range keys {
+		oldValue, existed := getValueByPath(before, key)
+		if !existed {
+			continue
+		}
+		newValue, exists := getValueByPath(after, key)
+		if !exists || !valuesEqual(oldValue, newValue) {
+			changed = append(changed, key)
+		}
+	}
+	return changed
+}
+
+// checkImmutable returns an error when a write would change immutable keys of filePath
+func checkImmutable(filePath string, before, after map[string]any) error {
+	keys, err := immutableKeys(filePath)
+	if err != nil {
+		return err
+	}
+	if changed := changedImmutableKeys(keys, before, after); len(changed) > 0 {
+		return fmt.Errorf("refusing to change immutable key(s) %s, use --force to override", strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+func handleScaffold(args []string, dryRun bool) error {
+	flags, paths, err := parseCommandFlags(args, append([]string{"yes"}, walkBoolFlags...), append([]string{"schema", "template"}, walkValueFlags...))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for scaffold")
+	}
+
+	resolve, err := newSchemaResolver(flags.get("schema", ""))
+	if err != nil {
+		return err
+	}
+	var template map[string]any
+	if flags.has("template") {
+		if template, err = loadTemplate(flags.get("template", "")); err != nil {
+			return err
+		}
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+	if err := confirmBulkWrite(files, flags.has("yes"), dryRun); err != nil {
+		return err
+	}
+
+	for _, filePath := range files {
+		schema, err := resolve(filePath)
+		if err != nil {
+			return err
+		}
+		data, err := readFrontmatterData(filePath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filePath, err)
+		}
+		typeDefaults := config.Types[config.typeFor(filePath, data)].Defaults
+		if schema == nil && template == nil && typeDefaults == nil {
+			fmt.Fprintf(os.Stderr, "Warning: no schema matches %s, skipping\n", filePath)
+			continue
+		}
+
+		_, err = updateFileFrontmatter(filePath, dryRun, func(data map[string]any) error {
+			// Template and content type values only fill keys the file does not set yet
+			for key, value := range deepMerge(deepMerge(typeDefaults, template), data) {
+				data[key] = value
+			}
+			if schema != nil {
+				scaffoldRequired(schema, data)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// templateExtendsKey names the template a template builds on
+const templateExtendsKey = "extends"
+
+// loadTemplate reads a frontmatter template, plain YAML or wrapped in --- delimiters.
+// A template with an extends key is deep-merged over the template it names, resolved
+// relative to its own directory, so content types can share a base.
+func loadTemplate(templatePath string) (map[string]any, error) {
+	return loadTemplateChain(templatePath, nil)
+}
+
+func loadTemplateChain(templatePath string, seen []string) (map[string]any, error) {
+	absPath, err := filepath.Abs(templatePath)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(seen, absPath) {
+		return nil, fmt.Errorf("template %s extends itself", templatePath)
+	}
+
+	content, err := os.ReadFile(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+	if fmString, _, err := splitFrontmatter(string(content)); err == nil && fmString != "" {
+		content = []byte(fmString)
+	}
+	template, err := unmarshalYAMLMap(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %s: %w", templatePath, err)
+	}
+
+	parent, found := template[templateExtendsKey]
+	if !found {
+		return template, nil
+	}
+	delete(template, templateExtendsKey)
+	parentPath, ok := parent.(string)
+	if !ok || parentPath == "" {
+		return nil, fmt.Errorf("invalid template %s: %s must be a file name", templatePath, templateExtendsKey)
+	}
+	if !filepath.IsAbs(parentPath) {
+		parentPath = filepath.Join(filepath.Dir(templatePath), parentPath)
+	}
+	base, err := loadTemplateChain(parentPath, append(seen, absPath))
+	if err != nil {
+		return nil, err
+	}
+	return deepMerge(base, template), nil
+}
+
+// handleEnsure adds the frontmatter of a template to files without a frontmatter block;
+// files that already have one, even an empty one, are never touched
+func handleEnsure(args []string, dryRun bool) error {
+	flags, paths, err := parseCommandFlags(args, append(bulkBoolFlags, walkBoolFlags...), slices.Concat([]string{"template"}, bulkValueFlags, walkValueFlags))
+	if err != nil {
+		return err
+	}
+	if !flags.has("template") {
+		return fmt.Errorf("ensure needs --template <file>")
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for ensure")
+	}
+
+	template, err := loadTemplate(flags.get("template", ""))
+	if err != nil {
+		return err
+	}
+	fmString, err := serializeFrontmatter(template)
+	if err != nil {
+		return err
+	}
+
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, filePath := range files {
+		info, err := readFrontmatterInfo(filePath)
+		if err != nil {
+			return err
+		}
+		if !info.HasFM {
+			missing = append(missing, filePath)
+		}
+	}
+
+	return runBulkWrite(missing, flags, dryRun, func(filePath string) error {
+		// The whole file becomes the body so nothing of it is reinterpreted
+		body, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		return writeFileContent(filePath, fmString, string(body), dryRun)
+	})
+}
+
+// gitLogForFile returns commit dates (newest first, ISO 8601) and author names
+// (oldest first) of every commit touching the file
+func gitLogForFile(filePath string) ([]string, []string, error) {
+	cmd := exec.Command("git", "-C", filepath.Dir(filePath), "log", "--follow", "--format=%cI%x09%aN", "--", filepath.Base(filePath))
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read git log for %s: %w", filePath, err)
+	}
+
+	var dates, authors []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		date, author, found := strings.Cut(line, "\t")
+		if !found {
+			continue
+		}
+		dates = append(dates, date)
+		authors = append([]string{author}, authors...)
+	}
+	return dates, authors, nil
+}
+
+// uniqueStrings returns values with duplicates removed, keeping first-seen order
+func uniqueStrings(values []string) []any {
+	result := []any{}
+	seen := make(map[string]bool)
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// mergeIntoList appends the values missing from an existing list, keeping manually
+// added entries and their order. A scalar existing value becomes the first list element.
+func mergeIntoList(existing any, values []string) []any {
+	var result []any
+	switch v := existing.(type) {
+	case nil:
+		result = []any{}
+	case []any:
+		result = append([]any{}, v...)
+	default:
+		result = []any{v}
+	}
+
+	seen := make(map[string]bool)
+	for _, item := range result {
+		seen[fmt.Sprint(item)] = true
+	}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// normalizeJSONValue converts json.Number values into the int64/float64 types used by set
+func normalizeJSONValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, nested := range v {
+			v[key] = normalizeJSONValue(nested)
+		}
+		return v
+	case []any:
+		for i, nested := range v {
+			v[i] = normalizeJSONValue(nested)
+		}
+		return v
+	case json.Number:
+		if valInt, err := v.Int64(); err == nil {
+			return valInt
+		}
+		if valFloat, err := v.Float64(); err == nil {
+			return valFloat
+		}
+		return v.String()
+	default:
+		return v
+	}
+}
+
+// loadConfig finds .frontmatter.yaml in the working directory or its parents.
+// A missing config file yields an empty configuration.
+func loadConfig() (*Config, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	for {
+		configPath := filepath.Join(dir, configFileName)
+		content, err := os.ReadFile(configPath)
+		if err == nil {
+			config := &Config{}
+			if err := yaml.Unmarshal(content, config); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", configPath, err)
+			}
+			config.Dir = dir
+			return config, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read %s: %w", configPath, err)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return &Config{}, nil
+		}
+		dir = parent
+	}
+}
+
+// relativeToConfig returns filePath relative to the config directory using forward slashes
+func (c *Config) relativeToConfig(filePath string) string {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil || c.Dir == "" {
+		return filepath.ToSlash(filePath)
+	}
+	relPath, err := filepath.Rel(c.Dir, absPath)
+	if err != nil {
+		return filepath.ToSlash(filePath)
+	}
+	return filepath.ToSlash(relPath)
+}
+
+// schemaFor returns the schema path of the first rule matching filePath, or "" if none
+func (c *Config) schemaFor(filePath string) string {
+	if len(c.Types) > 0 {
+		// Reading fails the same way for validation later, so a file that cannot be
+		// read simply resolves its type by path
+		data, _ := readFrontmatterData(filePath)
+		if contentType, ok := c.Types[c.typeFor(filePath, data)]; ok && contentType.Schema != "" {
+			return filepath.Join(c.Dir, contentType.Schema)
+		}
+	}
+	return c.ruleSchemaFor(filePath)
+}
+
+// ruleSchemaFor returns the schema of the first schemas rule matching filePath
+func (c *Config) ruleSchemaFor(filePath string) string {
+	relPath := c.relativeToConfig(filePath)
+	for _, rule := range c.Schemas {
+		if matchGlob(rule.Path, relPath) {
+			return filepath.Join(c.Dir, rule.Schema)
+		}
+	}
+	return ""
+}
+
+// typeFor returns the content type of a file with frontmatter data, or "" when none applies
+func (c *Config) typeFor(filePath string, data map[string]any) string {
+	if len(c.Types) == 0 {
+		return ""
+	}
+	if name, ok := data[cmp.Or(c.TypeKey, "type")].(string); ok {
+		if _, known := c.Types[name]; known {
+			return name
+		}
+	}
+	relPath := c.relativeToConfig(filePath)
+	for _, name := range sortedKeys(c.Types) {
+		for _, pattern := range c.Types[name].Paths {
+			if matchGlob(pattern, relPath) {
+				return name
+			}
+		}
+	}
+	if schemaPath := c.ruleSchemaFor(filePath); schemaPath != "" {
+		for _, name := range sortedKeys(c.Types) {
+			if schema := c.Types[name].Schema; schema != "" && filepath.Join(c.Dir, schema) == schemaPath {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// projectRootDir returns the directory of .frontmatter.yaml, or the working directory
+// when there is no config
+func projectRootDir() (string, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+	if config.Dir != "" {
+		return config.Dir, nil
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return dir, nil
+}
+
+// loadCascadedDefaults merges the _defaults.yaml files from the directories above
+// filePath, with closer directories overriding further ones. The cascade stops at
+// the config directory, or at the working directory when there is no config.
+func loadCascadedDefaults(filePath string) (map[string]any, error) {
+	stopDir, err := projectRootDir()
+	if err != nil {
+		return nil, err
+	}
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", filePath, err)
+	}
+
+	var dirs []string
+	for dir := filepath.Dir(absPath); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == stopDir || filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	if dirs[len(dirs)-1] != stopDir {
+		// The file lives outside the project; only its own directory applies
+		dirs = dirs[:1]
+	}
+
+	merged := make(map[string]any)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		content, err := os.ReadFile(filepath.Join(dirs[i], defaultsFileName))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read defaults: %w", err)
+		}
+		defaults, err := parseFrontmatter(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Join(dirs[i], defaultsFileName), err)
+		}
+		merged = deepMerge(merged, defaults)
+	}
+	return merged, nil
+}
+
+// deepMerge returns base with override merged on top; nested maps are merged
+// recursively and every other value from override replaces the base value
+func deepMerge(base, override map[string]any) map[string]any {
+	result := make(map[string]any, len(base)+len(override))
+	for key, value := range base {
+		result[key] = value
+	}
+	for key, value := range override {
+		baseMap, baseIsMap := result[key].(map[string]any)
+		overrideMap, overrideIsMap := value.(map[string]any)
+		if baseIsMap && overrideIsMap {
+			result[key] = deepMerge(baseMap, overrideMap)
+		} else {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// aliasesFor returns the other names key is known by: its canonical key first, then
+// the remaining aliases of that canonical key in name order
+func (c *Config) aliasesFor(key string) []string {
+	canonical := key
+	if target, ok := c.Aliases[key]; ok {
+		canonical = target
+	}
+	var names []string
+	if canonical != key {
+		names = append(names, canonical)
+	}
+	for _, alias := range sortedKeys(c.Aliases) {
+		if c.Aliases[alias] == canonical && alias != key {
+			names = append(names, alias)
+		}
+	}
+	return names
+}
+
+// loadSchemaFor loads the schema of the first rule matching filePath, or returns nil if none matches
+func (c *Config) loadSchemaFor(filePath string) (*Schema, error) {
+	schemaPath := c.schemaFor(filePath)
+	if schemaPath == "" {
+		return nil, nil
+	}
+	return loadSchema(schemaPath)
+}
+
+// matchGlob matches a slash-separated path against a glob where "**" spans any number of segments
+func matchGlob(pattern, name string) bool {
+	return matchGlobSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlobSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// newSchemaResolver returns a function picking the schema for a file: the explicit
+// schema when given, otherwise the first matching rule from the project config.
+// Loaded schemas are cached by path.
+func newSchemaResolver(explicitSchema string) (func(filePath string) (*Schema, error), error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	cache := make(map[string]*Schema)
+	return func(filePath string) (*Schema, error) {
+		schemaPath := explicitSchema
+		if schemaPath == "" {
+			schemaPath = config.schemaFor(filePath)
+		}
+		if schemaPath == "" {
+			return nil, nil
+		}
+		if schema, ok := cache[schemaPath]; ok {
+			return schema, nil
+		}
+		schema, err := loadSchema(schemaPath)
+		if err != nil {
+			return nil, err
+		}
+		cache[schemaPath] = schema
+		return schema, nil
+	}, nil
+}
+
+func handleType(args []string) error {
+	flags, paths, err := parseCommandFlags(args, walkBoolFlags, walkValueFlags)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one file or directory must be specified for type")
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	opts, err := walkOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, filePath := range files {
+		data, err := readFrontmatterData(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", filePath, err)
+			continue
+		}
+		typeName := config.typeFor(filePath, data)
+		if len(files) == 1 {
+			if typeName == "" {
+				return &ExitError{Code: 2, Message: "no content type"}
+			}
+			fmt.Println(typeName)
+		} else if typeName != "" {
+			fmt.Printf("%s: %s\n", filePath, typeName)
+		}
+	}
+	return nil
+}
+
+// SchemaKey describes one key a schema knows about, for editor completion. Keys of
+// list elements are written with a * segment, like authors.*.name.
+type SchemaKey struct {
+	Key      string `json:"key"`
+	Type     string `json:"type,omitempty"`
+	Required bool   `json:"required"`
+	Enum     []any  `json:"enum,omitempty"`
+	Default  any    `json:"default,omitempty"`
+	Pattern  string `json:"pattern,omitempty"`
+}
+
+func handleSchema(args []string) error {
+	if len(args) < 1 || args[0] != "keys" {
+		return fmt.Errorf("schema needs a subcommand: keys")
+	}
+
+	flags, args, err := parseCommandFlags(args[1:], []string{"json"}, []string{"schema", "output"})
+	if err != nil {
+		return err
+	}
+	asJSON, err := jsonOutput(flags)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 || (len(args) == 0 && !flags.has("schema")) {
+		return fmt.Errorf("schema keys needs --schema <file> or exactly one file to find the schema for")
+	}
+	filePath := ""
+	if len(args) == 1 {
+		filePath = args[0]
+	}
+	resolve, err := newSchemaResolver(flags.get("schema", ""))
+	if err != nil {
+		return err
+	}
+	schema, err := resolve(filePath)
+	if err != nil {
+		return err
+	}
+	if schema == nil {
+		return fmt.Errorf("no schema matches %s", filePath)
+	}
+
+	keys := []SchemaKey{}
+	collectSchemaKeys(schema, "", &keys)
+	// Enums from the config fill in keys whose schema has none
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if len(key.Enum) == 0 {
+			keys[i].Enum = config.Enums[key.Key]
+		}
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(keys); err != nil {
+			return fmt.Errorf("failed to encode schema keys: %w", err)
+		}
+		return nil
+	}
+	for _, key := range keys {
+		line := key.Key
+		if key.Type != "" {
+			line += "  " + key.Type
+		}
+		if key.Required {
+			line += "  required"
+		}
+		if len(key.Enum) > 0 {
+			line += fmt.Sprintf("  %v", key.Enum)
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// collectSchemaKeys appends the properties of schema under prefix in name order,
+// descending into nested objects and list items
+func collectSchemaKeys(schema *Schema, prefix string, keys *[]SchemaKey) {
+	for _, name := range sortedKeys(schema.Properties) {
+		property := schema.Properties[name]
+		if property == nil {
+			property = &Schema{}
+		}
+		keyPath := name
+		if prefix != "" {
+			keyPath = prefix + "." + name
+		}
+		*keys = append(*keys, SchemaKey{
+			Key:      keyPath,
+			Type:     property.Type,
+			Required: slices.Contains(schema.Required, name),
+			Enum:     property.Enum,
+			Default:  property.Default,
+			Pattern:  property.Pattern,
+		})
+		collectSchemaKeys(property, keyPath, keys)
+		if property.Items != nil {
+			collectSchemaKeys(property.Items, keyPath+".*", keys)
+		}
+	}
+}
+
+// loadSchema reads a schema file; JSON schemas parse fine as YAML
+func loadSchema(schemaPath string) (*Schema, error) {
+	content, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	schema := &Schema{}
+	if err := yaml.Unmarshal(content, schema); err != nil {
+		return nil, fmt.Errorf("failed to parse schema %s: %w", schemaPath, err)
+	}
+	return schema, nil
+}
+
+// violation is a single validation failure at a key path
+type violation struct {
+	Path    string
+	Message string
+}
+
+func (v violation) String() string {
+	return v.Path + ": " + v.Message
+}
+
+// validateValue checks value against schema and returns the violations found
+func validateValue(schema *Schema, keyPath string, value any) []violation {
+	var violations []violation
+	label := keyPath
+	if label == "" {
+		label = "frontmatter"
+	}
+
+	if schema.Type != "" && !matchesSchemaType(schema.Type, value) {
+		return []violation{{label, fmt.Sprintf("expected %s, got %s", schema.Type, describeType(value))}}
+	}
+
+	if len(schema.Enum) > 0 {
+		allowed := false
+		for _, option := range schema.Enum {
+			if fmt.Sprint(option) == fmt.Sprint(value) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			violations = append(violations, violation{label, fmt.Sprintf("value %v is not one of %v", value, schema.Enum)})
+		}
+	}
+
+	if schema.Pattern != "" {
+		if str, ok := value.(string); ok {
+			violations = append(violations, checkPattern(label, schema.Pattern, str)...)
+		}
+	}
+
+	if schema.Format != "" {
+		violations = append(violations, checkFormat(label, schema.Format, value)...)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range schema.Required {
+			if _, found := v[key]; !found {
+				violations = append(violations, violation{joinKeyPath(keyPath, key), "is required"})
+			}
+		}
+		for _, key := range sortedKeys(v) {
+			propertySchema, known := schema.Properties[key]
+			if !known {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					violations = append(violations, violation{joinKeyPath(keyPath, key), "is not allowed"})
+				}
+				continue
+			}
+			violations = append(violations, validateValue(propertySchema, joinKeyPath(keyPath, key), v[key])...)
+		}
+	case []any:
+		if schema.Items != nil {
+			for i, item := range v {
+				violations = append(violations, validateValue(schema.Items, fmt.Sprintf("%s.%d", label, i), item)...)
+			}
+		}
+	}
+
+	return violations
+}
+
+// validateSetValues validates the frontmatter a set would produce and fails on
+// violations at, above or below the keys being set; unrelated existing problems are ignored
+func validateSetValues(filePath string, data map[string]any, keyPaths []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	schema, err := config.loadSchemaFor(filePath)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, violation := range validateFrontmatter(config, schema, data) {
+		for _, keyPath := range keyPaths {
+			if pathsOverlap(violation.Path, keyPath) {
+				problems = append(problems, violation.String())
+				break
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid value(s): %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// pathsOverlap reports whether one dot path equals or contains the other
+func pathsOverlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".")
+}
+
+// checkPattern reports a violation when value does not match the regular expression
+func checkPattern(keyPath, pattern, value string) []violation {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return []violation{{keyPath, fmt.Sprintf("invalid pattern %q: %v", pattern, err)}}
+	}
+	if !re.MatchString(value) {
+		return []violation{{keyPath, fmt.Sprintf("value %q does not match pattern %q", value, pattern)}}
+	}
+	return nil
+}
+
+// configPatternViolations checks the values of keys listed in the config's patterns
+// map; non-string scalars are matched by their printed form
+func configPatternViolations(config *Config, data map[string]any) []violation {
+	var violations []violation
+	for _, key := range sortedKeys(config.Patterns) {
+		value, found := getValueByPath(data, key)
+		if !found || value == nil {
+			continue
+		}
+		switch value.(type) {
+		case map[string]any, []any:
+			violations = append(violations, violation{key, "expected a scalar value to match against pattern"})
+		default:
+			violations = append(violations, checkPattern(key, config.Patterns[key], fmt.Sprint(value))...)
+		}
+	}
+	return violations
+}
+
+// checkFormat reports a violation when value is not written in format, duration, time,
+// url (or uri), geo, isbn, doi or orcid. Numbers count as durations in the unit of the durationFormat config key.
+func checkFormat(keyPath, format string, value any) []violation {
+	switch format {
+	case "duration":
+		if _, ok := queryNumber(value); ok {
+			return nil
+		}
+		if _, ok := parseDurationValue(value); !ok {
+			return []violation{{keyPath, fmt.Sprintf("value %v is not a duration such as 5m or 1h30m", value)}}
+		}
+	case "time":
+		if _, ok := parseTimeOfDay(value); !ok {
+			return []violation{{keyPath, fmt.Sprintf("value %v is not a time of day such as 09:30", value)}}
+		}
+	case "url", "uri":
+		if problem := checkURL(value); problem != "" {
+			return []violation{{keyPath, problem}}
+		}
+	case "geo":
+		if _, ok := parseGeoValue(value); !ok {
+			return []violation{{keyPath, fmt.Sprintf("value %s is not a coordinate pair such as 51.1,17.03 or {lat: 51.1, lng: 17.03}", formatInlineValue(value))}}
+		}
+	case "isbn", "doi", "orcid":
+		if _, err := canonicalIdentifier(format, value); err != nil {
+			return []violation{{keyPath, fmt.Sprintf("value %v is not a valid %s: %v", value, strings.ToUpper(format), err)}}
+		}
+	}
+	return nil
+}
+
+// configFormatViolations checks the values of keys listed in the config's formats map
+func configFormatViolations(config *Config, data map[string]any) []violation {
+	var violations []violation
+	for _, key := range sortedKeys(config.Formats) {
+		value, found := getValueByPath(data, key)
+		if !found || value == nil {
+			continue
+		}
+		violations = append(violations, checkFormat(key, config.Formats[key], value)...)
+	}
+	return violations
+}
+
+// normalizeFormats rewrites the duration, time, geo and identifier values of keys with a
+// format, from the config or the schema, into their canonical form
+func normalizeFormats(config *Config, schema *Schema, data map[string]any) error {
+	formats := make(map[string]string)
+	if schema != nil {
+		for _, format := range []string{"duration", "time", "geo", "isbn", "doi", "orcid"} {
+			for _, key := range schemaPathsWhere(schema, "", func(property *Schema) bool { return property.Format == format }) {
+				formats[key] = format
+			}
+		}
+	}
+	maps.Copy(formats, config.Formats)
+
+	for _, key := range sortedKeys(formats) {
+		value, found := getValueByPath(data, key)
+		if !found || value == nil {
+			continue
+		}
+		var canonical any
+		switch formats[key] {
+		case "duration":
+			duration, ok := parseDurationValue(value)
+			if !ok {
+				continue
+			}
+			var err error
+			if canonical, err = formatDuration(duration, config.DurationFormat); err != nil {
+				return err
+			}
+		case "time":
+			timeOfDay, ok := parseTimeOfDay(value)
+			if !ok {
+				continue
+			}
+			canonical = formatTimeOfDay(timeOfDay, config.TimeFormat)
+		case "geo":
+			point, ok := parseGeoValue(value)
+			if !ok {
+				continue
+			}
+			var err error
+			if canonical, err = point.format(config.GeoFormat); err != nil {
+				return err
+			}
+		case "isbn", "doi", "orcid":
+			identifier, err := canonicalIdentifier(formats[key], value)
+			if err != nil {
+				continue
+			}
+			canonical = identifier
+		default:
+			continue
+		}
+		if err := setValueByPath(data, key, canonical); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateFrontmatter validates data against a schema (if any) and the config patterns, enums and rules
+func validateFrontmatter(config *Config, schema *Schema, data map[string]any) []violation {
+	var violations []violation
+	if schema != nil {
+		violations = append(violations, validateValue(schema, "", data)...)
+	}
+	violations = append(violations, configPatternViolations(config, data)...)
+	violations = append(violations, configFormatViolations(config, data)...)
+	violations = append(violations, configEnumViolations(config, data)...)
+	return append(violations, configRuleViolations(config, data)...)
+}
+
+// ruleFunctions are the functions an equals expression may apply to a key
+var ruleFunctions = map[string]func(string) string{
+	"slugify": slugify,
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+}
+
+// ruleExpression matches a function call such as slugify(title) in an equals expression
+var ruleExpression = regexp.MustCompile(`^(\w+)\(\s*([^()]+?)\s*\)$`)
+
+// configRuleViolations evaluates the config's cross-field rules against data
+func configRuleViolations(config *Config, data map[string]any) []violation {
+	var violations []violation
+	for i, rule := range config.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		report := func(keyPath, message string) {
+			violations = append(violations, violation{keyPath, fmt.Sprintf("rule %s: %s", name, message)})
+		}
+
+		if !ruleApplies(rule, data) {
+			continue
+		}
+		for _, key := range rule.Require {
+			if value, found := getValueByPath(data, key); !found || value == nil {
+				report(key, "key is required")
+			}
+		}
+		if rule.Key == "" {
+			continue
+		}
+		value, found := getValueByPath(data, rule.Key)
+		if !found || value == nil {
+			continue
+		}
+
+		for _, bound := range []struct{ other, relation string }{{rule.After, "after"}, {rule.Before, "before"}} {
+			if bound.other == "" {
+				continue
+			}
+			otherValue, found := getValueByPath(data, bound.other)
+			if !found || otherValue == nil {
+				continue
+			}
+			date, ok := parseDateValue(value)
+			otherDate, otherOk := parseDateValue(otherValue)
+			if !ok || !otherOk {
+				report(rule.Key, fmt.Sprintf("cannot compare %v with %s %v as dates", value, bound.other, otherValue))
+				continue
+			}
+			if bound.relation == "after" && !date.After(otherDate) || bound.relation == "before" && !date.Before(otherDate) {
+				report(rule.Key, fmt.Sprintf("%v must be %s %s (%v)", value, bound.relation, bound.other, otherValue))
+			}
+		}
+
+		if rule.Equals != "" {
+			expected, ok, err := evaluateRuleExpression(rule.Equals, data)
+			switch {
+			case err != nil:
+				report(rule.Key, err.Error())
+			case ok && fmt.Sprint(value) != expected:
+				report(rule.Key, fmt.Sprintf("%q must equal %s (%q)", fmt.Sprint(value), rule.Equals, expected))
+			}
+		}
+	}
+	return violations
+}
+
+// ruleApplies reports whether data holds every value of the rule's when condition
+func ruleApplies(rule ConsistencyRule, data map[string]any) bool {
+	for key, expected := range rule.When {
+		value, found := getValueByPath(data, key)
+		if !found || !valuesEqual(value, expected) {
+			return false
+		}
+	}
+	return true
+}
+
+// evaluateRuleExpression computes an equals expression: a key, or a function of a
+// key. ok is false when the key is not set.
+func evaluateRuleExpression(expression string, data map[string]any) (string, bool, error) {
+	key := expression
+	var apply func(string) string
+	if match := ruleExpression.FindStringSubmatch(expression); match != nil {
+		function, known := ruleFunctions[match[1]]
+		if !known {
+			return "", false, fmt.Errorf("unknown function %s in %q", match[1], expression)
+		}
+		key, apply = match[2], function
+	}
+
+	value, found := getValueByPath(data, key)
+	if !found || value == nil {
+		return "", false, nil
+	}
+	result := fmt.Sprint(value)
+	if apply != nil {
+		result = apply(result)
+	}
+	return result, true, nil
+}
+
+// slugify lowercases text and joins its letters and digits with single dashes
+func slugify(text string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return slug.String()
+}
+
+// configEnumViolations checks the values of keys listed in the config's enums map
+func configEnumViolations(config *Config, data map[string]any) []violation {
+	var violations []violation
+	for _, key := range sortedKeys(config.Enums) {
+		value, found := getValueByPath(data, key)
+		if !found {
+			continue
+		}
+		if _, exact, _ := matchEnum(config.Enums[key], value); !exact {
+			violations = append(violations, violation{key, fmt.Sprintf("value %v is not one of %v", value, config.Enums[key])})
+		}
+	}
+	return violations
+}
+
+// schemaAt returns the property schema at a dot path, or nil when the schema does not describe it
+func schemaAt(schema *Schema, keyPath string) *Schema {
+	for _, part := range strings.Split(keyPath, ".") {
+		if schema == nil {
+			return nil
+		}
+		schema = schema.Properties[part]
+	}
+	return schema
+}
+
+// allowedValues returns the enum for keyPath, preferring the config over the schema
+func allowedValues(config *Config, schema *Schema, keyPath string) []any {
+	if values, ok := config.Enums[keyPath]; ok {
+		return values
+	}
+	if property := schemaAt(schema, keyPath); property != nil {
+		return property.Enum
+	}
+	return nil
+}
+
+// matchEnum looks value up among the allowed options. exact reports an exact match;
+// otherwise found reports a near match (same text ignoring case and surrounding
+// spaces) whose canonical spelling is returned.
+func matchEnum(allowed []any, value any) (canonical any, exact bool, found bool) {
+	text := fmt.Sprint(value)
+	for _, option := range allowed {
+		if fmt.Sprint(option) == text {
+			return option, true, true
+		}
+	}
+	for _, option := range allowed {
+		if strings.EqualFold(fmt.Sprint(option), strings.TrimSpace(text)) {
+			return option, false, true
+		}
+	}
+	return nil, false, false
+}
+
+// fixEnumCase replaces near-matches of enum values with their canonical spelling
+func fixEnumCase(config *Config, schema *Schema, data map[string]any) {
+	keys := sortedKeys(config.Enums)
+	if schema != nil {
+		keys = append(keys, schemaPathsWhere(schema, "", func(property *Schema) bool { return len(property.Enum) > 0 })...)
+	}
+	for _, key := range keys {
+		value, found := getValueByPath(data, key)
+		if !found {
+			continue
+		}
+		if canonical, exact, near := matchEnum(allowedValues(config, schema, key), value); near && !exact {
+			setValueByPath(data, key, canonical)
+		}
+	}
+}
+
+// joinKeyPath appends key to a dot-separated parent path
+func joinKeyPath(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// matchesSchemaType reports whether value has the given JSON Schema type
+func matchesSchemaType(schemaType string, value any) bool {
+	switch schemaType {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "null":
+		return value == nil
+	case "integer":
+		switch v := value.(type) {
+		case int, int64, uint64:
+			return true
+		case float64:
+			return v == float64(int64(v))
+		case decimal:
+			n, ok := exactNumber(v)
+			return ok && n.IsInt()
+		}
+		return false
+	case "number":
+		switch value.(type) {
+		case int, int64, uint64, float64, decimal:
+			return true
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// describeType names the JSON Schema type of a parsed YAML value
+func describeType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "integer"
+	case float64, decimal:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// scaffoldRequired adds required keys missing from data, using schema defaults
+// or an empty value of the declared type
+func scaffoldRequired(schema *Schema, data map[string]any) {
+	for _, key := range schema.Required {
+		propertySchema := schema.Properties[key]
+		if _, found := data[key]; !found {
+			data[key] = schemaPlaceholder(propertySchema)
+		}
+		if nested, ok := data[key].(map[string]any); ok && propertySchema != nil {
+			scaffoldRequired(propertySchema, nested)
+		}
+	}
+}
+
+// schemaPlaceholder returns the default or zero value for a property schema
+func schemaPlaceholder(schema *Schema) any {
+	if schema == nil {
+		return nil
+	}
+	if schema.Default != nil {
+		return schema.Default
+	}
+	switch schema.Type {
+	case "string":
+		return ""
+	case "boolean":
+		return false
+	case "integer", "number":
+		return 0
+	case "array":
+		return []any{}
+	case "object":
+		return make(map[string]any)
+	default:
+		return nil
+	}
+}
+
+// readFrontmatterInfo reads only the frontmatter section and returns position info
+func readFrontmatterInfo(filePath string) (*FrontmatterInfo, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &FrontmatterInfo{Content: "", StartPos: 0, EndPos: 0, HasFM: false}, nil
+		}
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	if isYAMLFile(filePath) {
+		content, err := io.ReadAll(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		return &FrontmatterInfo{Content: string(content), StartPos: 0, EndPos: int64(len(content)), HasFM: true}, nil
+	}
+	reader := bufio.NewReader(file)
+	if format := detectFormat(reader); format != formatYAML {
+		content, raw, closed, err := scanFormattedBlock(reader, filePath, format)
+		if err != nil {
+			return nil, err
+		}
+		if !closed {
+			return &FrontmatterInfo{Content: "", StartPos: 0, EndPos: 0, HasFM: false}, nil
+		}
+		fileFormats[filePath] = format
+		return &FrontmatterInfo{Content: content, StartPos: 0, EndPos: int64(len(raw)), HasFM: true}, nil
+	}
+	var frontmatterContent strings.Builder
+	var bytesRead int64
+	separatorCount := 0
+
+	for {
+		line, err := reader.ReadString('\n')
+		bytesRead += int64(len(line))
+
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+
+		trimmed := strings.TrimSpace(line)
+		closing, closes := closesYAMLBlock(line)
+		if trimmed == frontmatterSeparator && separatorCount == 0 || closes && separatorCount == 1 {
+			separatorCount++
+			if separatorCount == 2 {
+				// Found end of frontmatter
+				if closing != formatYAML {
+					fileFormats[filePath] = closing
+				}
+				return &FrontmatterInfo{
+					Content:  frontmatterContent.String(),
+					StartPos: 0,
+					EndPos:   bytesRead,
+					HasFM:    true,
+				}, nil
+			}
+			if err == io.EOF {
+				break
+			}
+			continue
+		}
+
+		if separatorCount == 1 {
+			frontmatterContent.WriteString(line)
+		} else if separatorCount == 0 {
+			// No frontmatter at the beginning
+			if err == io.EOF || bytesRead > 1024 { // Check only first 1KB
+				return &FrontmatterInfo{Content: "", StartPos: 0, EndPos: 0, HasFM: false}, nil
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	// Incomplete frontmatter or none
+	return &FrontmatterInfo{Content: "", StartPos: 0, EndPos: 0, HasFM: false}, nil
+}
+
+// readBodyFromPosition reads file content from a specific position to the end
+func readBodyFromPosition(filePath string, startPos int64) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	// Seek to position after frontmatter
+	if _, err := file.Seek(startPos, 0); err != nil {
+		return "", fmt.Errorf("failed to seek to position %d: %w", startPos, err)
+	}
+
+	// Read the rest of the file
+	bodyBytes, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read body content: %w", err)
+	}
+
+	return string(bodyBytes), nil
+}
+
+// writeOptimizedFrontmatter writes frontmatter using optimized strategy
+func writeOptimizedFrontmatter(filePath, newFmString string, info *FrontmatterInfo, dryRun bool) error {
+	if activePlan != nil {
+		return activePlan.record(filePath, newFmString, nil)
+	}
+	if dryRun {
+		return writeFileContentForDryRun(filePath, newFmString, info)
+	}
+
+	// For safety, always use complete file rewriting
+	// In-place editing is risky and can damage data
+	return writeFileContentSafe(filePath, newFmString, info)
+}
+
+// writeFileContentForDryRun handles dry-run output efficiently
+func writeFileContentForDryRun(filePath, newFmString string, info *FrontmatterInfo) error {
+	block, err := frontmatterBlock(filePath, newFmString)
+	if err != nil {
+		return err
+	}
+	var finalContent strings.Builder
+	finalContent.WriteString(block)
+
+	// Add body content if it exists
+	if info.HasFM && info.EndPos > 0 {
+		bodyContent, err := readBodyFromPosition(filePath, info.EndPos)
+		if err != nil {
+			return err
+		}
+		finalContent.WriteString(bodyContent)
+	} else if !info.HasFM {
+		// Entire file is body
+		content, err := os.ReadFile(filePath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			finalContent.WriteString(string(content))
+		}
+	}
+
+	fmt.Print(finalContent.String())
+	return nil
+}
+
+// writeFileContentSafe safely rewrites the entire file (fallback method)
+func writeFileContentSafe(filePath, newFmString string, info *FrontmatterInfo) error {
+	block, err := frontmatterBlock(filePath, newFmString)
+	if err != nil {
+		return err
+	}
+	var finalContent strings.Builder
+	finalContent.WriteString(block)
+
+	// Add body content if it exists
+	if info.HasFM && info.EndPos > 0 {
+		bodyContent, err := readBodyFromPosition(filePath, info.EndPos)
+		if err != nil {
+			return err
+		}
+		finalContent.WriteString(bodyContent)
+	} else if !info.HasFM {
+		// Entire file is body - read it completely
+		content, err := os.ReadFile(filePath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			finalContent.WriteString(string(content))
+		}
+	}
+
+	if err := checkWritablePath(filePath); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(filePath, finalContent.String()); err != nil {
+		return err
+	}
+
+	writtenFiles = append(writtenFiles, filePath)
+	return nil
+}
+
+// pathSegment is one step of a key path: a map key, for [N] suffixes a list index, or
+// for * and [*] a wildcard standing for every key or element at that level
+type pathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool          // *, [*] or a [field=value] selector, expanded by expandKeyPath
+	selector *pathSelector // set for [field=value]
+}
+
+// pathSelector keeps the elements of a list of maps whose field equals value as text
+type pathSelector struct {
+	field string
+	value string
+}
+
+// matches reports whether a list element is a map with the selected field value
+func (s *pathSelector) matches(item any) bool {
+	itemMap, ok := item.(map[string]any)
+	if !ok {
+		return false
+	}
+	value, found := getValueByPath(itemMap, s.field)
+	return found && fmt.Sprint(value) == s.value
+}
+
+// parseKeyPath splits a dot-separated key path into segments. A part may end in one
+// or more [N] suffixes addressing list elements, e.g. characters[1].character_name;
+// negative indices count from the end, so [-1] is the last element. A [field=value]
+// suffix selects the elements of a list of maps by a field, e.g.
+// characters[character_id=ABC].character_name.
+// Brackets that do not hold a plain number, * or a selector stay part of the key.
+func parseKeyPath(path string) []pathSegment {
+	var segments []pathSegment
+	for _, part := range splitKeyPath(path) {
+		var indices []pathSegment
+		for strings.HasSuffix(part, "]") {
+			open := strings.LastIndexByte(part, '[')
+			if open < 0 {
+				break
+			}
+			inner := part[open+1 : len(part)-1]
+			field, value, isSelector := strings.Cut(inner, "=")
+			if inner == "*" {
+				indices = append([]pathSegment{{wildcard: true}}, indices...)
+			} else if index, err := strconv.Atoi(inner); err == nil && inner[0] != '+' {
+				indices = append([]pathSegment{{index: index, isIndex: true}}, indices...)
+			} else if isSelector && field != "" {
+				selector := &pathSelector{field: field, value: unquoteSelectorValue(value)}
+				indices = append([]pathSegment{{wildcard: true, selector: selector}}, indices...)
+			} else {
+				break
+			}
+			part = part[:open]
+		}
+		switch {
+		case part == "*":
+			segments = append(segments, pathSegment{wildcard: true})
+		case part != "" || len(indices) == 0:
+			segments = append(segments, pathSegment{key: part})
+		}
+		segments = append(segments, indices...)
+	}
+	return segments
+}
+
+// splitKeyPath splits a key path at the dots outside of brackets, so selector values
+// may contain dots
+func splitKeyPath(path string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range path {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth = max(depth-1, 0)
+		case '.':
+			if depth == 0 {
+				parts = append(parts, path[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, path[start:])
+}
+
+// cutAssignment splits a key=value argument at the first = outside of brackets, so
+// keys may hold [field=value] selectors
+func cutAssignment(arg string) (key, value string, found bool) {
+	depth := 0
+	for i, c := range arg {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth = max(depth-1, 0)
+		case '=':
+			if depth == 0 {
+				return arg[:i], arg[i+1:], true
+			}
+		}
+	}
+	return arg, "", false
+}
+
+// unquoteSelectorValue strips one pair of matching quotes from a selector value
+func unquoteSelectorValue(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// hasWildcard reports whether a key path contains * or [field=value] segments
+func hasWildcard(path string) bool {
+	return slices.ContainsFunc(parseKeyPath(path), func(segment pathSegment) bool { return segment.wildcard })
+}
+
+// expandKeyPath replaces the wildcards of a key path with every key (in sorted order)
+// or list index present at that level of data. Other segments are kept whether they
+// exist or not, so set can still create them below a wildcard.
+func expandKeyPath(data map[string]any, path string) []string {
+	if !hasWildcard(path) {
+		return []string{path}
+	}
+	return expandSegments(data, parseKeyPath(path))
+}
+
+// expandSegments is expandKeyPath on parsed segments
+func expandSegments(data map[string]any, segments []pathSegment) []string {
+	prefixes := []string{""}
+	for _, segment := range segments {
+		var next []string
+		for _, prefix := range prefixes {
+			switch {
+			case segment.wildcard:
+				var value any = data
+				if prefix != "" {
+					value, _ = getValueByPath(data, prefix)
+				}
+				switch v := value.(type) {
+				case map[string]any:
+					if segment.selector != nil {
+						break
+					}
+					for _, key := range sortedKeys(v) {
+						next = append(next, joinKeyPath(prefix, key))
+					}
+				case []any:
+					for i, item := range v {
+						if segment.selector == nil || segment.selector.matches(item) {
+							next = append(next, fmt.Sprintf("%s[%d]", prefix, i))
+						}
+					}
+				}
+			case segment.isIndex:
+				next = append(next, fmt.Sprintf("%s[%d]", prefix, segment.index))
+			default:
+				next = append(next, joinKeyPath(prefix, segment.key))
+			}
+		}
+		prefixes = next
+	}
+	return prefixes
+}
+
+// createSelectedElements appends an element to every list a [field=value] selector of
+// path matches nothing in, for set --create-missing. The new element is a map holding
+// just the selected field, so the rest of the path is set inside it.
+func createSelectedElements(data map[string]any, path string) error {
+	segments := parseKeyPath(path)
+	for i, segment := range segments {
+		if segment.selector == nil {
+			continue
+		}
+		for _, prefix := range expandSegments(data, segments[:i]) {
+			existing, _ := getValueByPath(data, prefix)
+			list, isList := existing.([]any)
+			if existing != nil && !isList || slices.ContainsFunc(list, segment.selector.matches) {
+				continue
+			}
+			element := make(map[string]any)
+			if err := setValueByPath(element, segment.selector.field, parseSetValue(segment.selector.value)); err != nil {
+				return err
+			}
+			if err := setValueByPath(data, prefix, append(list, element)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// asListIndex turns a numeric key segment into an index when it is applied to a list,
+// so authors.0.email addresses the first author like authors[0].email
+func (segment pathSegment) asListIndex(current any) pathSegment {
+	if _, isList := current.([]any); !isList || segment.isIndex || segment.wildcard {
+		return segment
+	}
+	index, err := strconv.Atoi(segment.key)
+	if err != nil {
+		return segment
+	}
+	return pathSegment{index: index, isIndex: true}
+}
+
+// setValueByPath sets a value in a nested map structure based on a dot-separated path.
+// Missing maps along the path are created; list elements are addressed with [N], and
+// an index one past the end appends. A value in the way of the path, like a string at
+// a when setting a.b, is a *PathConflictError.
+func setValueByPath(data map[string]any, path string, value any) error {
+	setter := &pathSetter{path: path}
+	_, err := setter.set(data, parseKeyPath(path), value, "")
+	return err
+}
+
+// forceValueByPath is setValueByPath replacing values in the way of the path with new
+// maps and lists. It returns what was replaced.
+func forceValueByPath(data map[string]any, path string, value any) ([]PathOverwrite, error) {
+	setter := &pathSetter{path: path, force: true}
+	_, err := setter.set(data, parseKeyPath(path), value, "")
+	return setter.overwrites, err
+}
+
+// PathOverwrite is a value destroyed because a deeper path was set through it
+type PathOverwrite struct {
+	Path     string `json:"path"`
+	At       string `json:"at"`
+	OldValue any    `json:"old_value"`
+}
+
+// PathConflictError reports a value that setting a deeper path would destroy
+type PathConflictError struct {
+	PathOverwrite
+}
+
+func (e *PathConflictError) Error() string {
+	return fmt.Sprintf("path conflict: setting %s would replace %s, which holds %s", e.Path, e.At, formatInlineValue(e.OldValue))
+}
+
+// pathSetter carries the state of one setValueByPath call through the recursion
+type pathSetter struct {
+	path       string
+	force      bool
+	overwrites []PathOverwrite
+}
+
+// conflict handles a non-container value at a position the path goes through: an
+// error by default, recorded and replaced with force
+func (s *pathSetter) conflict(at string, old any) error {
+	overwrite := PathOverwrite{Path: s.path, At: at, OldValue: old}
+	if !s.force {
+		return &PathConflictError{overwrite}
+	}
+	s.overwrites = append(s.overwrites, overwrite)
+	return nil
+}
+
+// set sets value below current, which sits at the path at, and returns the possibly
+// replaced container, since appending to a list can give it a new backing array
+func (s *pathSetter) set(current any, segments []pathSegment, value any, at string) (any, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+	segment := segments[0].asListIndex(current)
+	if segment.wildcard {
+		return nil, fmt.Errorf("wildcards in %s must be expanded before setting", s.path)
+	}
+	if segment.isIndex {
+		list, ok := current.([]any)
+		if !ok {
+			if err := s.conflict(at, current); err != nil {
+				return nil, err
+			}
+			list = []any{}
+		}
+		index, found := listIndex(segment.index, len(list))
+		if !found && index != len(list) {
+			return nil, fmt.Errorf("index %d out of range in %s (list has %d elements)", segment.index, s.path, len(list))
+		}
+		var existing any
+		if found {
+			existing = list[index]
+		} else if len(segments) > 1 {
+			existing = emptyContainerFor(segments[1])
+		}
+		updated, err := s.set(existing, segments[1:], value, fmt.Sprintf("%s[%d]", at, segment.index))
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return append(list, updated), nil
+		}
+		list[index] = updated
+		return list, nil
+	}
+
+	currentMap, ok := current.(map[string]any)
+	if !ok {
+		if err := s.conflict(at, current); err != nil {
+			return nil, err
+		}
+		currentMap = make(map[string]any)
+	}
+	existing, found := currentMap[segment.key]
+	if len(segments) > 1 && (!found || existing == nil) {
+		existing = emptyContainerFor(segments[1])
+	}
+	updated, err := s.set(existing, segments[1:], value, joinKeyPath(at, segment.key))
+	if err != nil {
+		return nil, err
+	}
+	currentMap[segment.key] = updated
+	return currentMap, nil
+}
+
+// listIndex resolves a possibly negative index against a list of length elements and
+// reports whether it addresses an existing element
+func listIndex(index, length int) (int, bool) {
+	if index < 0 {
+		index += length
+	}
+	return index, index >= 0 && index < length
+}
+
+// emptyContainerFor returns the container a missing value must be for segment to address it
+func emptyContainerFor(segment pathSegment) any {
+	if segment.isIndex {
+		return []any{}
+	}
+	return make(map[string]any)
+}
+
+// getValueByPath retrieves a value from a nested map structure based on a dot-separated path.
+func getValueByPath(data map[string]any, path string) (any, bool) {
+	var currentValue any = data
+	for _, segment := range parseKeyPath(path) {
+		segment = segment.asListIndex(currentValue)
+		if segment.wildcard {
+			return nil, false
+		}
+		if segment.isIndex {
+			list, ok := currentValue.([]any)
+			if !ok {
+				return nil, false
+			}
+			index, found := listIndex(segment.index, len(list))
+			if !found {
+				return nil, false
+			}
+			currentValue = list[index]
+			continue
+		}
+		currentMap, ok := currentValue.(map[string]any)
+		if !ok {
+			// If at any point the path does not lead to a map, the key is not found as specified.
+			return nil, false
+		}
+		value, found := currentMap[segment.key]
+		if !found {
+			return nil, false
+		}
+		currentValue = value
+	}
+	return currentValue, true
+}
+
+// deleteKeyEverywhere removes a key from every map in value, at any depth and inside
+// lists, for delete --recursive
+func deleteKeyEverywhere(value any, key string) {
+	switch v := value.(type) {
+	case map[string]any:
+		delete(v, key)
+		for _, nested := range v {
+			deleteKeyEverywhere(nested, key)
+		}
+	case []any:
+		for _, nested := range v {
+			deleteKeyEverywhere(nested, key)
+		}
+	}
+}
+
+// deleteValueByPath removes a value from a nested map structure based on a dot-separated path.
+// Deleting a list element shifts the following elements down.
+func deleteValueByPath(data map[string]any, path string) bool {
+	segments := parseKeyPath(path)
+	if hasWildcard(path) {
+		return false
+	}
+	parentPath := segments[:len(segments)-1]
+	last := segments[len(segments)-1]
+
+	// Navigate to the parent of the value to delete, remembering how to replace a list
+	var parent any = data
+	replace := func(any) {}
+	for _, segment := range parentPath {
+		container := parent
+		segment = segment.asListIndex(container)
+		if segment.isIndex {
+			list, ok := container.([]any)
+			if !ok {
+				// Path doesn't exist, nothing to delete
+				return false
+			}
+			index, found := listIndex(segment.index, len(list))
+			if !found {
+				return false
+			}
+			parent, replace = list[index], func(updated any) { list[index] = updated }
+			continue
+		}
+		currentMap, ok := container.(map[string]any)
+		if !ok {
+			return false
+		}
+		value, found := currentMap[segment.key]
+		if !found {
+			return false
+		}
+		key := segment.key
+		parent, replace = value, func(updated any) { currentMap[key] = updated }
+	}
+
+	last = last.asListIndex(parent)
+	if last.isIndex {
+		list, ok := parent.([]any)
+		if !ok {
+			return false
+		}
+		index, found := listIndex(last.index, len(list))
+		if !found {
+			return false
+		}
+		replace(slices.Delete(list, index, index+1))
+		return true
+	}
+	if finalMap, ok := parent.(map[string]any); ok {
+		_, existed := finalMap[last.key]
+		delete(finalMap, last.key)
+		return existed
+	}
+	return false
+}
+
+// queryExpr is a parsed search expression such as
+// tags contains "go" AND (draft == false OR NOT body contains "wip")
+type queryExpr interface {
+	matches(doc *queryDoc) (bool, error)
+}
+
+// queryDoc is the file a query is evaluated against. The body is only read when a
+// predicate needs it, so metadata-only queries run off the parse cache.
+type queryDoc struct {
+	filePath string
+	data     map[string]any
+	body     *string
+}
+
+func (doc *queryDoc) bodyText() (string, error) {
+	if doc.body == nil {
+		_, body, err := readFileContent(doc.filePath)
+		if err != nil {
+			return "", err
+		}
+		doc.body = &body
+	}
+	return *doc.body, nil
+}
+
+type queryAnd struct{ left, right queryExpr }
+type queryOr struct{ left, right queryExpr }
+type queryNot struct{ operand queryExpr }
+
+// queryComparison compares the value at a key path, or the body for the path "body",
+// with a literal. An empty op tests whether the value is set and truthy.
+type queryComparison struct {
+	path  string
+	op    string
+	value any
+}
+
+func (q queryAnd) matches(doc *queryDoc) (bool, error) {
+	ok, err := q.left.matches(doc)
+	if err != nil || !ok {
+		return false, err
+	}
+	return q.right.matches(doc)
+}
+
+func (q queryOr) matches(doc *queryDoc) (bool, error) {
+	ok, err := q.left.matches(doc)
+	if err != nil || ok {
+		return ok, err
+	}
+	return q.right.matches(doc)
+}
+
+func (q queryNot) matches(doc *queryDoc) (bool, error) {
+	ok, err := q.operand.matches(doc)
+	return !ok, err
+}
+
+func (q queryComparison) matches(doc *queryDoc) (bool, error) {
+	if q.path == queryBodyKey {
+		body, err := doc.bodyText()
+		if err != nil {
+			return false, err
+		}
+		text := fmt.Sprint(q.value)
+		switch q.op {
+		case "contains":
+			// Full-text matching ignores case, like most search boxes
+			return strings.Contains(strings.ToLower(body), strings.ToLower(text)), nil
+		case "matches":
+			return regexp.MatchString(text, body)
+		case "":
+			return strings.TrimSpace(body) != "", nil
+		default:
+			return false, fmt.Errorf("body only supports contains and matches, not %s", q.op)
+		}
+	}
+
+	value, found := getValueByPath(doc.data, q.path)
+	switch q.op {
+	case "":
+		return found && isTruthy(value), nil
+	case "==":
+		return found && queryEqual(value, q.value) || !found && q.value == nil, nil
+	case "!=":
+		return !(found && queryEqual(value, q.value) || !found && q.value == nil), nil
+	case "contains":
+		switch v := value.(type) {
+		case []any:
+			return slices.ContainsFunc(v, func(item any) bool { return queryEqual(item, q.value) }), nil
+		case string:
+			return strings.Contains(v, fmt.Sprint(q.value)), nil
+		}
+		return false, nil
+	case "matches":
+		if !found || value == nil {
+			return false, nil
+		}
+		return regexp.MatchString(fmt.Sprint(q.value), fmt.Sprint(value))
+	}
+	order, comparable := queryCompare(value, q.value)
+	if !found || !comparable {
+		return false, nil
+	}
+	switch q.op {
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	default:
+		return order >= 0, nil
+	}
+}
+
+// queryBodyKey is the pseudo key addressing the document body in queries
+const queryBodyKey = "body"
+
+// isTruthy reports whether a value counts as set: not null, false, empty or zero
+func isTruthy(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	}
+	if number, ok := queryNumber(value); ok {
+		return number != 0
+	}
+	return true
+}
+
+// queryNumber converts the numeric types the YAML parser produces to float64
+func queryNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case decimal:
+		n, err := strconv.ParseFloat(strings.ReplaceAll(string(v), "_", ""), 64)
+		return n, err == nil
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func queryEqual(value, literal any) bool {
+	if order, ok := queryCompare(value, literal); ok {
+		return order == 0
+	}
+	return valuesEqual(value, literal)
+}
+
+// queryCompare orders a frontmatter value against a literal: numerically when both are
+// numbers, chronologically when both read as dates and otherwise as text. ok is false
+// for values without an order, such as lists, maps and null.
+func queryCompare(value, literal any) (int, bool) {
+	_, valueIsDecimal := value.(decimal)
+	_, literalIsDecimal := literal.(decimal)
+	if valueIsDecimal || literalIsDecimal {
+		if a, ok := exactNumber(value); ok {
+			if b, ok := exactNumber(literal); ok {
+				return a.Cmp(b), true
+			}
+		}
+	}
+	if a, ok := queryNumber(value); ok {
+		if b, ok := queryNumber(literal); ok {
+			return cmp.Compare(a, b), true
+		}
+	}
+	if a, ok := parseDateValue(value); ok {
+		if b, ok := parseDateValue(literal); ok {
+			return a.Compare(b), true
+		}
+	}
+	if a, ok := parseDurationValue(value); ok {
+		if b, ok := parseDurationValue(literal); ok {
+			return cmp.Compare(a, b), true
+		}
+	}
+	if a, ok := parseTimeOfDay(value); ok {
+		if b, ok := parseTimeOfDay(literal); ok {
+			return cmp.Compare(a, b), true
+		}
+	}
+	switch value.(type) {
+	case nil, []any, map[string]any:
+		return 0, false
+	}
+	if literal == nil {
+		return 0, false
+	}
+	return strings.Compare(fmt.Sprint(value), fmt.Sprint(literal)), true
+}
+
+// queryToken is a word, operator or quoted string of a query
+type queryToken struct {
+	text   string
+	quoted bool
+}
+
+// queryOperators are the comparison operators, symbolic ones longest first
+var queryOperators = []string{"==", "!=", "<=", ">=", "<", ">", "contains", "matches"}
+
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(query) && query[end] != c {
+				if query[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(query) {
+				return nil, fmt.Errorf("unterminated string in query")
+			}
+			text := query[i+1 : end]
+			if c == '"' {
+				unquoted, err := strconv.Unquote(query[i : end+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid string %s in query", query[i:end+1])
+				}
+				text = unquoted
+			}
+			tokens = append(tokens, queryToken{text: text, quoted: true})
+			i = end + 1
+		case strings.ContainsRune("()", rune(c)):
+			tokens = append(tokens, queryToken{text: string(c)})
+			i++
+		case strings.HasPrefix(query[i:], "&&") || strings.HasPrefix(query[i:], "||"):
+			tokens = append(tokens, queryToken{text: query[i : i+2]})
+			i += 2
+		case strings.ContainsRune("=!<>", rune(c)):
+			if i+1 < len(query) && query[i+1] == '=' {
+				tokens = append(tokens, queryToken{text: query[i : i+2]})
+				i += 2
+			} else {
+				tokens = append(tokens, queryToken{text: string(c)})
+				i++
+			}
+		default:
+			end := i
+			for end < len(query) && !strings.ContainsRune(" \t\r\n()\"'=!<>&|", rune(query[end])) {
+				end++
+			}
+			if end == i {
+				// A lone & or | stops the scan before it consumed anything
+				return nil, fmt.Errorf("unexpected character %q at offset %d in query", string(c), i)
+			}
+			tokens = append(tokens, queryToken{text: query[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// queryParser is a recursive descent parser over query tokens where NOT binds
+// tighter than AND, and AND tighter than OR
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+// resolveQuery parses a query, or looks up @name among the config's saved queries
+func resolveQuery(text string) (queryExpr, error) {
+	name, saved := strings.CutPrefix(text, "@")
+	if !saved {
+		return parseQuery(text)
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	query, ok := config.Queries[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown query @%s (define it under queries in %s)", name, configFileName)
+	}
+	expr, err := parseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("query @%s: %w", name, err)
+	}
+	return expr, nil
+}
+
+// parseQuery parses a search expression
+func parseQuery(query string) (queryExpr, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	parser := &queryParser{tokens: tokens}
+	expr, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(parser.tokens) {
+		return nil, fmt.Errorf("unexpected %q in query", parser.tokens[parser.pos].text)
+	}
+	return expr, nil
+}
+
+// accept consumes the next token when it is an unquoted keyword out of words
+func (p *queryParser) accept(words ...string) bool {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].quoted {
+		return false
+	}
+	for _, word := range words {
+		if strings.EqualFold(p.tokens[p.pos].text, word) {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *queryParser) parseOr() (queryExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("OR", "||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = queryOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("AND", "&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = queryAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseUnary() (queryExpr, error) {
+	if p.accept("NOT", "!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return queryNot{operand}, nil
+	}
+	if p.accept("(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing ) in query")
+		}
+		return expr, nil
+	}
+
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("query ends where a key was expected")
+	}
+	key := p.tokens[p.pos]
+	if !key.quoted && strings.Contains("()", key.text) || isQueryOperator(key) {
+		return nil, fmt.Errorf("expected a key, found %q in query", key.text)
+	}
+	p.pos++
+	comparison := queryComparison{path: key.text}
+	if p.pos >= len(p.tokens) || !isQueryOperator(p.tokens[p.pos]) {
+		return comparison, nil
+	}
+	comparison.op = strings.ToLower(p.tokens[p.pos].text)
+	p.pos++
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("missing value after %s in query", comparison.op)
+	}
+	comparison.value = queryLiteral(p.tokens[p.pos])
+	p.pos++
+	if comparison.op == "matches" {
+		if _, err := regexp.Compile(fmt.Sprint(comparison.value)); err != nil {
+			return nil, fmt.Errorf("invalid regular expression in query: %w", err)
+		}
+	}
+	return comparison, nil
+}
+
+// relativeQueryDate resolves now, today and offsets from them such as now-180d or today+1w
+func relativeQueryDate(word string, now time.Time) (time.Time, bool) {
+	var base time.Time
+	var offset string
+	if rest, ok := strings.CutPrefix(word, "now"); ok {
+		base, offset = now, rest
+	} else if rest, ok := strings.CutPrefix(word, "today"); ok {
+		year, month, day := now.Date()
+		base, offset = time.Date(year, month, day, 0, 0, 0, 0, time.UTC), rest
+	} else {
+		return time.Time{}, false
+	}
+	if offset == "" {
+		return base, true
+	}
+	if offset[0] != '-' && offset[0] != '+' {
+		return time.Time{}, false
+	}
+	age, err := parseAge(offset[1:])
+	if err != nil {
+		return time.Time{}, false
+	}
+	if offset[0] == '-' {
+		age = -age
+	}
+	return base.Add(age), true
+}
+
+func isQueryOperator(token queryToken) bool {
+	if token.quoted {
+		return false
+	}
+	for _, op := range queryOperators {
+		if strings.EqualFold(token.text, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// queryLiteral reads an unquoted value as a number, boolean or null where it is one,
+// and now, today or now-180d style offsets as times; quoted values and other words
+// are strings. Fractions stay decimals, so they compare exactly with decimal keys
+// instead of being rounded to the nearest float64 first.
+func queryLiteral(token queryToken) any {
+	if token.quoted {
+		return token.text
+	}
+	if date, ok := relativeQueryDate(token.text, time.Now()); ok {
+		return date
+	}
+	if valInt, err := strconv.ParseInt(token.text, 10, 64); err == nil {
+		return valInt
+	}
+	if valFloat, err := strconv.ParseFloat(token.text, 64); err == nil {
+		if _, exact := exactNumber(decimal(token.text)); exact {
+			return decimal(token.text)
+		}
+		return valFloat
+	}
+	switch token.text {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	return token.text
+}
+
+// evaluateJSONPath returns the values a JSONPath expression selects from data. The
+// supported subset covers $, .key and ['key'], .* and [*], [N] with negative indices,
+// [start:end] slices, .. recursive descent and [?(...)] filters, whose condition is a
+// query in which @ stands for the element, e.g. [?(@.id == "X" && @.year > 2000)].
+func evaluateJSONPath(data map[string]any, expression string) ([]any, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(expression), "$")
+	if !ok {
+		return nil, fmt.Errorf("JSONPath must start with $")
+	}
+	nodes := []any{data}
+	for rest != "" {
+		recursive := false
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			recursive, rest = true, rest[2:]
+			if !strings.HasPrefix(rest, "[") {
+				rest = "." + rest
+			}
+		case rest[0] != '.' && rest[0] != '[':
+			return nil, fmt.Errorf("unexpected %q in JSONPath", rest)
+		}
+		if recursive {
+			var all []any
+			for _, node := range nodes {
+				all = append(all, jsonPathDescendants(node)...)
+			}
+			nodes = all
+		}
+
+		var selector string
+		if rest[0] == '.' {
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			selector, rest = rest[1:end+1], rest[end+1:]
+			if selector == "" {
+				return nil, fmt.Errorf("empty key in JSONPath")
+			}
+			if selector != "*" {
+				selector = strconv.Quote(selector)
+			}
+		} else {
+			end := jsonPathBracketEnd(rest)
+			if end < 0 {
+				return nil, fmt.Errorf("missing ] in JSONPath")
+			}
+			selector, rest = strings.TrimSpace(rest[1:end]), rest[end+1:]
+		}
+
+		var err error
+		if nodes, err = applyJSONPathSelector(nodes, selector); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// jsonPathBracketEnd finds the ] closing the bracket that opens rest, skipping quoted
+// strings and the parentheses of filters
+func jsonPathBracketEnd(rest string) int {
+	depth := 0
+	var quote byte
+	for i := 1; i < len(rest); i++ {
+		c := rest[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ']' && depth == 0:
+			return i
+		}
+	}
+	return -1
+}
+
+// jsonPathDescendants returns node and everything below it, depth first in key order
+func jsonPathDescendants(node any) []any {
+	result := []any{node}
+	switch v := node.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			result = append(result, jsonPathDescendants(v[key])...)
+		}
+	case []any:
+		for _, item := range v {
+			result = append(result, jsonPathDescendants(item)...)
+		}
+	}
+	return result
+}
+
+// applyJSONPathSelector applies the content of one bracket (or a dotted key, passed
+// quoted) to every node
+func applyJSONPathSelector(nodes []any, selector string) ([]any, error) {
+	var result []any
+	switch {
+	case selector == "*":
+		for _, node := range nodes {
+			switch v := node.(type) {
+			case map[string]any:
+				for _, key := range sortedKeys(v) {
+					result = append(result, v[key])
+				}
+			case []any:
+				result = append(result, v...)
+			}
+		}
+
+	case strings.HasPrefix(selector, "?(") && strings.HasSuffix(selector, ")"):
+		filter, err := parseQuery(selector[2 : len(selector)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSONPath filter: %w", err)
+		}
+		for _, node := range nodes {
+			var children []any
+			switch v := node.(type) {
+			case map[string]any:
+				for _, key := range sortedKeys(v) {
+					children = append(children, v[key])
+				}
+			case []any:
+				children = v
+			}
+			for _, child := range children {
+				// @ is an ordinary key path root for the query language
+				ok, err := filter.matches(&queryDoc{data: map[string]any{"@": child}})
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					result = append(result, child)
+				}
+			}
+		}
+
+	case strings.HasPrefix(selector, "'") || strings.HasPrefix(selector, `"`):
+		key := selector
+		if strings.HasPrefix(selector, "'") && strings.HasSuffix(selector, "'") && len(selector) >= 2 {
+			key = selector[1 : len(selector)-1]
+		} else if unquoted, err := strconv.Unquote(selector); err == nil {
+			key = unquoted
+		} else {
+			return nil, fmt.Errorf("invalid key %s in JSONPath", selector)
+		}
+		for _, node := range nodes {
+			if m, ok := node.(map[string]any); ok {
+				if value, found := m[key]; found {
+					result = append(result, value)
+				}
+			}
+		}
+
+	case strings.Contains(selector, ":"):
+		startText, endText, _ := strings.Cut(selector, ":")
+		for _, node := range nodes {
+			list, ok := node.([]any)
+			if !ok {
+				continue
+			}
+			start, end := 0, len(list)
+			if startText != "" {
+				n, err := strconv.Atoi(strings.TrimSpace(startText))
+				if err != nil {
+					return nil, fmt.Errorf("invalid slice %s in JSONPath", selector)
+				}
+				start = n
+			}
+			if endText != "" {
+				n, err := strconv.Atoi(strings.TrimSpace(endText))
+				if err != nil {
+					return nil, fmt.Errorf("invalid slice %s in JSONPath", selector)
+				}
+				end = n
+			}
+			if start < 0 {
+				start = max(start+len(list), 0)
+			}
+			if end < 0 {
+				end += len(list)
+			}
+			end = min(end, len(list))
+			if start < end {
+				result = append(result, list[start:end]...)
+			}
+		}
+
+	default:
+		index, err := strconv.Atoi(selector)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported selector [%s] in JSONPath", selector)
+		}
+		for _, node := range nodes {
+			if list, ok := node.([]any); ok {
+				if i, found := listIndex(index, len(list)); found {
+					result = append(result, list[i])
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// jqFunctions are the functions get --expr adds to jq for the duration and time-of-day
+// values of frontmatter, working in seconds like jq's own date functions
+var jqFunctions = []gojq.CompilerOption{
+	gojq.WithFunction("fromduration", 0, 0, func(input any, _ []any) any {
+		duration, ok := parseDurationValue(input)
+		if !ok {
+			return fmt.Errorf("cannot parse %s as a duration", jqType(input))
+		}
+		return duration.Seconds()
+	}),
+	gojq.WithFunction("toduration", 0, 0, func(input any, _ []any) any {
+		seconds, ok := jqSeconds(input)
+		if !ok {
+			return fmt.Errorf("%s cannot be written as a duration", jqType(input))
+		}
+		text, err := formatDuration(time.Duration(seconds*float64(time.Second)), "compact")
+		if err != nil {
+			return err
+		}
+		return text
+	}),
+	gojq.WithFunction("fromtime", 0, 0, func(input any, _ []any) any {
+		timeOfDay, ok := parseTimeOfDay(input)
+		if !ok {
+			return fmt.Errorf("cannot parse %s as a time of day", jqType(input))
+		}
+		return timeOfDay.Seconds()
+	}),
+	gojq.WithFunction("totime", 0, 0, func(input any, _ []any) any {
+		seconds, ok := jqSeconds(input)
+		if !ok {
+			return fmt.Errorf("%s cannot be written as a time of day", jqType(input))
+		}
+		return formatTimeOfDay(time.Duration(seconds*float64(time.Second)), "")
+	}),
+}
+
+// jqSeconds returns a jq number as float64 seconds
+func jqSeconds(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// jqType names the jq type of a value for error messages
+func jqType(value any) string {
+	return gojq.TypeOf(value)
+}
+
+// evaluateJQ runs a get --expr filter over the frontmatter with gojq. The data goes
+// through JSON first so the filter sees the same value types jq would. Filters cannot
+// read the environment ($ENV, env), further inputs or modules.
+func evaluateJQ(data map[string]any, expression string) ([]any, error) {
+	query, err := gojq.Parse(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression: %w", err)
+	}
+	code, err := gojq.Compile(query, jqFunctions...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression: %w", err)
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert frontmatter to JSON: %w", err)
+	}
+	var input any
+	if err := json.Unmarshal(encoded, &input); err != nil {
+		return nil, fmt.Errorf("failed to convert frontmatter to JSON: %w", err)
+	}
+
+	var outputs []any
+	iter := code.Run(input)
+	for {
+		output, ok := iter.Next()
+		if !ok {
+			return outputs, nil
+		}
+		if err, isError := output.(error); isError {
+			return nil, err
+		}
+		outputs = append(outputs, output)
+	}
 }